@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/censys/scan-takehome/internal/api"
+	"github.com/censys/scan-takehome/internal/logging"
+	"github.com/censys/scan-takehome/internal/repositories"
+)
+
+func main() {
+	addr := flag.String("addr", getEnv("API_ADDR", ":8080"), "HTTP listen address")
+	dbHost := flag.String("db-host", getEnv("DB_HOST", "localhost"), "Database host")
+	dbPort := flag.String("db-port", getEnv("DB_PORT", "5432"), "Database port")
+	dbName := flag.String("db-name", getEnv("DB_NAME", "scans"), "Database name")
+	dbUser := flag.String("db-user", getEnv("DB_USER", "postgres"), "Database user")
+	dbPassword := flag.String("db-password", getEnv("DB_PASSWORD", "postgres"), "Database password")
+	logLevel := flag.String("log-level", getEnv("LOG_LEVEL", "info"), "Log level (debug, info, warn or error)")
+	logFormat := flag.String("log-format", getEnv("LOG_FORMAT", "json"), "Log format (json or text)")
+	flag.Parse()
+
+	logger, err := logging.New(os.Stderr, logging.Config{Level: *logLevel, Format: *logFormat})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	if err := run(*addr, *dbHost, *dbPort, *dbName, *dbUser, *dbPassword); err != nil {
+		slog.Error("Application error", "error", err)
+		os.Exit(1)
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func run(addr, dbHost, dbPort, dbName, dbUser, dbPassword string) error {
+	dbURL := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		dbHost, dbPort, dbUser, dbPassword, dbName)
+
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           api.NewServer(repositories.NewPostgresRepository(db)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		slog.Info("Received shutdown signal, stopping API server")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Failed to shut down API server", "error", err)
+		}
+	}()
+
+	slog.Info("API listening", "addr", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server error: %w", err)
+	}
+
+	slog.Info("API server stopped")
+	return nil
+}
@@ -0,0 +1,623 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/censys/scan-takehome/internal/db"
+	"github.com/censys/scan-takehome/internal/logging"
+	"github.com/censys/scan-takehome/internal/repositories"
+	"github.com/censys/scan-takehome/internal/services"
+	"github.com/censys/scan-takehome/internal/sources"
+	"github.com/censys/scan-takehome/internal/tracing"
+	"github.com/censys/scan-takehome/internal/workers"
+)
+
+// Config is every setting of the consumer. Values are layered in increasing
+// precedence: defaults, the YAML file given by -config or CONFIG_FILE,
+// environment variables and finally flags set on the command line.
+type Config struct {
+	PubSub        PubSubConfig     `yaml:"pubsub"`
+	Source        SourceConfig     `yaml:"source"`
+	DeadLetter    DeadLetterConfig `yaml:"dead_letter"`
+	Events        EventsConfig     `yaml:"events"`
+	Batch         BatchConfig      `yaml:"batch"`
+	AdminAddr     string           `yaml:"admin_addr"`
+	ShutdownGrace time.Duration    `yaml:"shutdown_grace"`
+	Logging       LoggingConfig    `yaml:"logging"`
+	Tracing       TracingConfig    `yaml:"tracing"`
+	Database      db.Config        `yaml:"database"`
+	Retry         RetryConfig      `yaml:"retry"`
+	Breaker       BreakerConfig    `yaml:"circuit_breaker"`
+	// SchemaCheck is require, warn or off; see checkSchema
+	SchemaCheck string `yaml:"schema_check"`
+	// Store is postgres, sqlite or memory; database and retry only apply to
+	// postgres
+	Store  string       `yaml:"store"`
+	SQLite SQLiteConfig `yaml:"sqlite"`
+	Cache  CacheConfig  `yaml:"cache"`
+}
+
+type PubSubConfig struct {
+	Project                string         `yaml:"project"`
+	Subscription           string         `yaml:"subscription"`
+	MaxOutstandingMessages int            `yaml:"max_outstanding_messages"`
+	MaxOutstandingBytes    int            `yaml:"max_outstanding_bytes"`
+	NumGoroutines          int            `yaml:"num_goroutines"`
+	MaxExtension           time.Duration  `yaml:"max_extension"`
+	SynchronousPull        bool           `yaml:"synchronous_pull"`
+	Adaptive               AdaptiveConfig `yaml:"adaptive"`
+}
+
+type AdaptiveConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	TargetLatency  time.Duration `yaml:"target_latency"`
+	MinOutstanding int           `yaml:"min_outstanding"`
+	Interval       time.Duration `yaml:"interval"`
+}
+
+type SourceConfig struct {
+	// Type is pubsub or file
+	Type string `yaml:"type"`
+	File string `yaml:"file"`
+}
+
+type DeadLetterConfig struct {
+	// Mode is table, topic or none
+	Mode  string `yaml:"mode"`
+	Topic string `yaml:"topic"`
+}
+
+type EventsConfig struct {
+	// Mode is topic, webhook, file or none
+	Mode         string        `yaml:"mode"`
+	Topic        string        `yaml:"topic"`
+	WebhookURL   string        `yaml:"webhook_url"`
+	File         string        `yaml:"file"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// MaxAttempts is how many failed publishes park an event; 0 retries forever
+	MaxAttempts int `yaml:"max_attempts"`
+}
+
+type BatchConfig struct {
+	Size        int           `yaml:"size"`
+	Wait        time.Duration `yaml:"wait"`
+	Concurrency int           `yaml:"concurrency"`
+}
+
+type LoggingConfig struct {
+	Level            string `yaml:"level"`
+	Format           string `yaml:"format"`
+	SampleInitial    int    `yaml:"sample_initial"`
+	SampleThereafter int    `yaml:"sample_thereafter"`
+}
+
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`
+	File        string  `yaml:"file"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+type SQLiteConfig struct {
+	Path string `yaml:"path"`
+}
+
+type CacheConfig struct {
+	// Type is none, lru or redis
+	Type  string           `yaml:"type"`
+	Size  int              `yaml:"size"`
+	TTL   time.Duration    `yaml:"ttl"`
+	Redis RedisCacheConfig `yaml:"redis"`
+}
+
+type RedisCacheConfig struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
+type RetryConfig struct {
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+type BreakerConfig struct {
+	FailureThreshold int           `yaml:"failure_threshold"`
+	Cooldown         time.Duration `yaml:"cooldown"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		PubSub: PubSubConfig{
+			Project:      "test-project",
+			Subscription: "scan-sub",
+			Adaptive: AdaptiveConfig{
+				TargetLatency:  250 * time.Millisecond,
+				MinOutstanding: 10,
+				Interval:       5 * time.Second,
+			},
+		},
+		Source:     SourceConfig{Type: "pubsub"},
+		DeadLetter: DeadLetterConfig{Mode: "table", Topic: "scan-dead-letter"},
+		Events: EventsConfig{
+			Mode:         "none",
+			Topic:        "scan-changes",
+			File:         "changes.jsonl",
+			PollInterval: time.Second,
+			MaxAttempts:  10,
+		},
+		Batch:         BatchConfig{Size: 100, Wait: 50 * time.Millisecond, Concurrency: 4},
+		AdminAddr:     ":9090",
+		ShutdownGrace: 25 * time.Second,
+		Logging:       LoggingConfig{Level: "info", Format: "json", SampleInitial: 100, SampleThereafter: 100},
+		Tracing:       TracingConfig{Exporter: "none", File: "traces.jsonl", SampleRatio: 1},
+		Database: db.Config{
+			Host:     "localhost",
+			Port:     5432,
+			Name:     "scans",
+			User:     "postgres",
+			Password: "postgres",
+			SSLMode:  "disable",
+
+			MaxOpenConns:    20,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+		Retry:       RetryConfig(repositories.DefaultRetryPolicy),
+		Breaker:     BreakerConfig{FailureThreshold: 5, Cooldown: 5 * time.Second},
+		SchemaCheck: "require",
+		Store:       "postgres",
+		SQLite:      SQLiteConfig{Path: "scans.db"},
+		Cache: CacheConfig{
+			Type:  "none",
+			Size:  100000,
+			TTL:   5 * time.Minute,
+			Redis: RedisCacheConfig{Addr: "localhost:6379"},
+		},
+	}
+}
+
+// envOverrides lists the variables that do not follow the flag name
+var envOverrides = map[string]string{
+	"project":      "PUBSUB_PROJECT_ID",
+	"subscription": "PUBSUB_SUBSCRIPTION_ID",
+}
+
+// envName maps a flag such as db-host to its variable DB_HOST
+func envName(flagName string) string {
+	if name, ok := envOverrides[flagName]; ok {
+		return name
+	}
+	return strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+//nolint:lll // one line per flag reads better than wrapped help text
+func (c *Config) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.PubSub.Project, "project", c.PubSub.Project, "GCP Project ID")
+	fs.StringVar(&c.PubSub.Subscription, "subscription", c.PubSub.Subscription, "GCP PubSub Subscription ID")
+	fs.IntVar(&c.PubSub.MaxOutstandingMessages, "max-outstanding-messages", c.PubSub.MaxOutstandingMessages, "Unacked Pub/Sub messages held at once (0 uses the client default of 1000)")
+	fs.IntVar(&c.PubSub.MaxOutstandingBytes, "max-outstanding-bytes", c.PubSub.MaxOutstandingBytes, "Unacked Pub/Sub message bytes held at once (0 uses the client default of 1e9)")
+	fs.IntVar(&c.PubSub.NumGoroutines, "num-goroutines", c.PubSub.NumGoroutines, "Pub/Sub pull streams (0 uses the client default of 10)")
+	fs.DurationVar(&c.PubSub.MaxExtension, "max-extension", c.PubSub.MaxExtension, "Longest a message's ack deadline is extended (0 uses the client default of 60m)")
+	fs.BoolVar(&c.PubSub.SynchronousPull, "synchronous-pull", c.PubSub.SynchronousPull, "Use unary Pull instead of StreamingPull")
+	fs.BoolVar(&c.PubSub.Adaptive.Enabled, "adaptive-flow-control", c.PubSub.Adaptive.Enabled, "Lower -max-outstanding-messages while database latency is above -adaptive-target-latency")
+	fs.DurationVar(&c.PubSub.Adaptive.TargetLatency, "adaptive-target-latency", c.PubSub.Adaptive.TargetLatency, "Average database write latency adaptive flow control aims for")
+	fs.IntVar(&c.PubSub.Adaptive.MinOutstanding, "adaptive-min-outstanding", c.PubSub.Adaptive.MinOutstanding, "Lowest outstanding message limit adaptive flow control will set")
+	fs.DurationVar(&c.PubSub.Adaptive.Interval, "adaptive-interval", c.PubSub.Adaptive.Interval, "How often adaptive flow control adjusts the limit")
+
+	fs.StringVar(&c.Source.Type, "source", c.Source.Type, "Message source (pubsub or file)")
+	fs.StringVar(&c.Source.File, "source-file", c.Source.File, "JSONL file to read scans from when -source=file")
+
+	fs.StringVar(&c.DeadLetter.Mode, "dead-letter", c.DeadLetter.Mode, "Dead-letter sink for permanent failures (table, topic or none)")
+	fs.StringVar(&c.DeadLetter.Topic, "dead-letter-topic", c.DeadLetter.Topic, "GCP PubSub Topic ID for -dead-letter=topic")
+
+	fs.StringVar(&c.Events.Mode, "events", c.Events.Mode, "Change event sink (topic, webhook, file or none)")
+	fs.StringVar(&c.Events.Topic, "events-topic", c.Events.Topic, "GCP PubSub Topic ID for -events=topic")
+	fs.StringVar(&c.Events.WebhookURL, "events-webhook-url", c.Events.WebhookURL, "URL to POST events to for -events=webhook")
+	fs.StringVar(&c.Events.File, "events-file", c.Events.File, "File to append events to for -events=file")
+	fs.DurationVar(&c.Events.PollInterval, "events-poll-interval", c.Events.PollInterval, "How often the outbox is polled for unpublished events")
+	fs.IntVar(&c.Events.MaxAttempts, "events-max-attempts", c.Events.MaxAttempts, "Failed publishes after which an event is parked (0 retries forever)")
+
+	fs.IntVar(&c.Batch.Size, "batch-size", c.Batch.Size, "Scans written per database batch (1 disables batching)")
+	fs.DurationVar(&c.Batch.Wait, "batch-wait", c.Batch.Wait, "Longest a scan waits for its batch to fill")
+	fs.IntVar(&c.Batch.Concurrency, "batch-concurrency", c.Batch.Concurrency, "Batches written to the database concurrently")
+
+	fs.StringVar(&c.AdminAddr, "admin-addr", c.AdminAddr, "Listen address for /metrics, /healthz and /readyz (empty disables them)")
+	fs.DurationVar(&c.ShutdownGrace, "shutdown-grace", c.ShutdownGrace, "How long in-flight messages may finish after SIGTERM before they are abandoned")
+
+	fs.StringVar(&c.Logging.Level, "log-level", c.Logging.Level, "Log level (debug, info, warn or error)")
+	fs.StringVar(&c.Logging.Format, "log-format", c.Logging.Format, "Log format (json or text)")
+	fs.IntVar(&c.Logging.SampleInitial, "log-sample-initial", c.Logging.SampleInitial, "Info and debug lines with the same message logged per second before sampling (0 disables sampling)")
+	fs.IntVar(&c.Logging.SampleThereafter, "log-sample-thereafter", c.Logging.SampleThereafter, "Once sampling, log every nth line with the same message")
+
+	fs.StringVar(&c.Tracing.Exporter, "trace-exporter", c.Tracing.Exporter, "OpenTelemetry span exporter (none, otlp, stdout or file)")
+	fs.StringVar(&c.Tracing.Endpoint, "trace-endpoint", c.Tracing.Endpoint, "OTLP/HTTP collector URL for -trace-exporter=otlp (defaults to OTEL_EXPORTER_OTLP_ENDPOINT or http://localhost:4318)")
+	fs.StringVar(&c.Tracing.File, "trace-file", c.Tracing.File, "File to append spans to for -trace-exporter=file")
+	fs.Float64Var(&c.Tracing.SampleRatio, "trace-sample-ratio", c.Tracing.SampleRatio, "Fraction of traces started by the consumer that are recorded")
+
+	fs.StringVar(&c.Store, "store", c.Store, "Where scans are stored (postgres, sqlite, or memory to keep them in this process until it exits)")
+	fs.StringVar(&c.SQLite.Path, "sqlite-path", c.SQLite.Path, "SQLite database file for -store=sqlite")
+	fs.StringVar(&c.Cache.Type, "cache", c.Cache.Type, "Cache of the latest scan per service that lets stale scans skip the database (none, lru or redis)")
+	fs.IntVar(&c.Cache.Size, "cache-size", c.Cache.Size, "Most services kept by -cache=lru")
+	fs.DurationVar(&c.Cache.TTL, "cache-ttl", c.Cache.TTL, "Longest a cached scan is used (0 means until evicted)")
+	fs.StringVar(&c.Cache.Redis.Addr, "cache-redis-addr", c.Cache.Redis.Addr, "Redis host:port for -cache=redis")
+	fs.StringVar(&c.Cache.Redis.Password, "cache-redis-password", c.Cache.Redis.Password, "Redis password for -cache=redis")
+	fs.IntVar(&c.Cache.Redis.DB, "cache-redis-db", c.Cache.Redis.DB, "Redis database number for -cache=redis")
+	fs.StringVar(&c.Database.DSN, "db-dsn", c.Database.DSN, "Full Postgres connection string or URL; replaces the other -db-* connection flags")
+	fs.StringVar(&c.Database.Host, "db-host", c.Database.Host, "Database host")
+	fs.IntVar(&c.Database.Port, "db-port", c.Database.Port, "Database port")
+	fs.StringVar(&c.Database.Name, "db-name", c.Database.Name, "Database name")
+	fs.StringVar(&c.Database.User, "db-user", c.Database.User, "Database user")
+	fs.StringVar(&c.Database.Password, "db-password", c.Database.Password, "Database password")
+	fs.StringVar(&c.Database.PasswordFile, "db-password-file", c.Database.PasswordFile, "File holding the database password; takes precedence over -db-password")
+	fs.StringVar(&c.Database.SSLMode, "db-sslmode", c.Database.SSLMode, "Postgres sslmode (disable, require, verify-ca or verify-full)")
+	fs.StringVar(&c.Database.SSLRootCert, "db-sslrootcert", c.Database.SSLRootCert, "CA certificate used to verify the server")
+	fs.StringVar(&c.Database.SSLCert, "db-sslcert", c.Database.SSLCert, "Client certificate for TLS authentication")
+	fs.StringVar(&c.Database.SSLKey, "db-sslkey", c.Database.SSLKey, "Client key for TLS authentication")
+	fs.IntVar(&c.Database.MaxOpenConns, "db-max-open-conns", c.Database.MaxOpenConns, "Most open database connections (0 means no limit)")
+	fs.IntVar(&c.Database.MaxIdleConns, "db-max-idle-conns", c.Database.MaxIdleConns, "Most idle database connections kept in the pool")
+	fs.DurationVar(&c.Database.ConnMaxLifetime, "db-conn-max-lifetime", c.Database.ConnMaxLifetime, "Longest a database connection is reused (0 means forever)")
+	fs.DurationVar(&c.Database.ConnMaxIdleTime, "db-conn-max-idle-time", c.Database.ConnMaxIdleTime, "Longest a database connection stays idle (0 means forever)")
+
+	fs.IntVar(&c.Retry.MaxAttempts, "db-retry-attempts", c.Retry.MaxAttempts, "Tries per database operation on transient errors, including the first (1 disables retries)")
+	fs.DurationVar(&c.Retry.InitialBackoff, "db-retry-initial-backoff", c.Retry.InitialBackoff, "Wait before the first database retry; doubles with every retry")
+	fs.DurationVar(&c.Retry.MaxBackoff, "db-retry-max-backoff", c.Retry.MaxBackoff, "Longest wait between database retries")
+
+	fs.IntVar(&c.Breaker.FailureThreshold, "breaker-failure-threshold", c.Breaker.FailureThreshold, "Consecutive failed writes with the database unavailable that pause message handling (0 disables the breaker)")
+	fs.DurationVar(&c.Breaker.Cooldown, "breaker-cooldown", c.Breaker.Cooldown, "How often a paused consumer lets one message through to probe the database")
+
+	fs.StringVar(&c.SchemaCheck, "schema-check", c.SchemaCheck, "On startup, refuse to run (require), log (warn) or ignore (off) pending migrations")
+}
+
+// loadConfig registers the configuration flags and -config on fs, parses
+// args and layers the sources by precedence. Settings that cannot be read
+// from the file or the environment are returned together as one error, so
+// they can be reported alongside Validate's.
+func loadConfig(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	config := defaultConfig()
+
+	settings := flag.NewFlagSet("", flag.ContinueOnError)
+	config.registerFlags(settings)
+	settings.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, fmt.Sprintf("%s (env %s)", f.Usage, envName(f.Name)))
+	})
+	configFile := fs.String("config", "", "YAML file to read settings from (env CONFIG_FILE)")
+
+	if err := fs.Parse(args); err != nil {
+		return config, err
+	}
+
+	// Flags are applied again last, so remember the ones given on the command line
+	explicit := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+
+	var errs []error
+	path := *configFile
+	if path == "" {
+		path, _ = lookupEnv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := readConfigFile(path, &config); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	settings.VisitAll(func(f *flag.Flag) {
+		name := envName(f.Name)
+		if value, ok := lookupEnv(name); ok && value != "" {
+			previous := f.Value.String()
+			if err := f.Value.Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid value %q: %w", name, value, err))
+				// A failed Set may still zero the value; keep the previous layer's
+				_ = f.Value.Set(previous)
+			}
+		}
+	})
+
+	for name, value := range explicit {
+		if settings.Lookup(name) == nil {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			errs = append(errs, fmt.Errorf("-%s: %w", name, err))
+		}
+	}
+
+	return config, errors.Join(errs...)
+}
+
+// readConfigFile overlays the settings present in a YAML file onto config
+func readConfigFile(path string, config *Config) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once, each prefixed with its
+// path in the config file
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+	oneOf := func(field, value string, allowed ...string) bool {
+		if slices.Contains(allowed, value) {
+			return true
+		}
+		invalid(field, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+		return false
+	}
+
+	usesPubSub := c.Source.Type == "pubsub" || c.DeadLetter.Mode == "topic" || c.Events.Mode == "topic"
+	if usesPubSub && c.PubSub.Project == "" {
+		invalid("pubsub.project", "is required when Pub/Sub is used")
+	}
+
+	if oneOf("source.type", c.Source.Type, "pubsub", "file") {
+		switch c.Source.Type {
+		case "pubsub":
+			if c.PubSub.Subscription == "" {
+				invalid("pubsub.subscription", "is required when source.type is pubsub")
+			}
+		case "file":
+			if c.Source.File == "" {
+				invalid("source.file", "is required when source.type is file")
+			}
+		}
+	}
+
+	if c.PubSub.NumGoroutines < 0 {
+		invalid("pubsub.num_goroutines", "must not be negative")
+	}
+	if c.PubSub.MaxExtension < 0 {
+		invalid("pubsub.max_extension", "must not be negative")
+	}
+	if adaptive := c.PubSub.Adaptive; adaptive.Enabled {
+		if c.Source.Type != "pubsub" {
+			invalid("pubsub.adaptive.enabled", "requires source.type pubsub")
+		}
+		if adaptive.TargetLatency <= 0 {
+			invalid("pubsub.adaptive.target_latency", "must be positive")
+		}
+		if adaptive.MinOutstanding < 1 {
+			invalid("pubsub.adaptive.min_outstanding", "must be at least 1")
+		}
+		if adaptive.Interval <= 0 {
+			invalid("pubsub.adaptive.interval", "must be positive")
+		}
+	}
+
+	if oneOf("dead_letter.mode", c.DeadLetter.Mode, "table", "topic", "none") &&
+		c.DeadLetter.Mode == "topic" && c.DeadLetter.Topic == "" {
+		invalid("dead_letter.topic", "is required when dead_letter.mode is topic")
+	}
+
+	if oneOf("events.mode", c.Events.Mode, "topic", "webhook", "file", "none") {
+		if c.Events.Mode != "none" && c.Store != "postgres" {
+			invalid("events.mode", "requires store postgres, which holds the change event outbox")
+		}
+		switch c.Events.Mode {
+		case "topic":
+			if c.Events.Topic == "" {
+				invalid("events.topic", "is required when events.mode is topic")
+			}
+		case "webhook":
+			if parsed, err := url.Parse(c.Events.WebhookURL); err != nil || parsed.Host == "" ||
+				(parsed.Scheme != "http" && parsed.Scheme != "https") {
+				invalid("events.webhook_url", "must be an http or https URL when events.mode is webhook, got %q", c.Events.WebhookURL)
+			}
+		case "file":
+			if c.Events.File == "" {
+				invalid("events.file", "is required when events.mode is file")
+			}
+		}
+		if c.Events.Mode != "none" && c.Events.PollInterval <= 0 {
+			invalid("events.poll_interval", "must be positive")
+		}
+		if c.Events.MaxAttempts < 0 {
+			invalid("events.max_attempts", "must not be negative")
+		}
+	}
+
+	if c.Batch.Size < 1 {
+		invalid("batch.size", "must be at least 1")
+	}
+	if c.Batch.Size > 1 && c.Batch.Wait <= 0 {
+		invalid("batch.wait", "must be positive when batching")
+	}
+	if c.Batch.Concurrency < 1 {
+		invalid("batch.concurrency", "must be at least 1")
+	}
+
+	if c.AdminAddr != "" {
+		if _, _, err := net.SplitHostPort(c.AdminAddr); err != nil {
+			invalid("admin_addr", "must be host:port, got %q", c.AdminAddr)
+		}
+	}
+	if c.ShutdownGrace < 0 {
+		invalid("shutdown_grace", "must not be negative")
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Logging.Level)); err != nil {
+		invalid("logging.level", "must be debug, info, warn or error, got %q", c.Logging.Level)
+	}
+	oneOf("logging.format", strings.ToLower(c.Logging.Format), "json", "text")
+	if c.Logging.SampleInitial < 0 {
+		invalid("logging.sample_initial", "must not be negative")
+	}
+	if c.Logging.SampleInitial > 0 && c.Logging.SampleThereafter < 1 {
+		invalid("logging.sample_thereafter", "must be at least 1 when sampling")
+	}
+
+	if oneOf("tracing.exporter", c.Tracing.Exporter, "none", "otlp", "stdout", "file") &&
+		c.Tracing.Exporter == "file" && c.Tracing.File == "" {
+		invalid("tracing.file", "is required when tracing.exporter is file")
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		invalid("tracing.sample_ratio", "must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	}
+
+	if c.Store == "postgres" {
+		if c.Retry.MaxAttempts < 1 {
+			invalid("retry.max_attempts", "must be at least 1")
+		}
+		if c.Retry.MaxAttempts > 1 {
+			if c.Retry.InitialBackoff <= 0 {
+				invalid("retry.initial_backoff", "must be positive when retrying")
+			}
+			if c.Retry.MaxBackoff < c.Retry.InitialBackoff {
+				invalid("retry.max_backoff", "must be at least retry.initial_backoff")
+			}
+		}
+	}
+	if c.Breaker.FailureThreshold < 0 {
+		invalid("circuit_breaker.failure_threshold", "must not be negative")
+	}
+	if c.Breaker.FailureThreshold > 0 && c.Breaker.Cooldown <= 0 {
+		invalid("circuit_breaker.cooldown", "must be positive")
+	}
+
+	oneOf("schema_check", c.SchemaCheck, "require", "warn", "off")
+
+	if oneOf("store", c.Store, "postgres", "sqlite", "memory") {
+		errs = append(errs, c.validateStore())
+	}
+
+	if oneOf("cache.type", c.Cache.Type, "none", "lru", "redis") {
+		if c.Cache.Type == "lru" && c.Cache.Size < 1 {
+			invalid("cache.size", "must be at least 1")
+		}
+		if c.Cache.Type == "redis" {
+			if _, _, err := net.SplitHostPort(c.Cache.Redis.Addr); err != nil {
+				invalid("cache.redis.addr", "must be host:port, got %q", c.Cache.Redis.Addr)
+			}
+			if c.Cache.Redis.DB < 0 {
+				invalid("cache.redis.db", "must not be negative")
+			}
+		}
+	}
+	if c.Cache.TTL < 0 {
+		invalid("cache.ttl", "must not be negative")
+	}
+	return errors.Join(errs...)
+}
+
+// validateStore checks the settings of the configured store only
+func (c *Config) validateStore() error {
+	switch c.Store {
+	case "postgres":
+		return c.Database.Validate("database.")
+	case "sqlite":
+		if c.SQLite.Path == "" {
+			return errors.New("sqlite.path: is required when store is sqlite")
+		}
+	}
+	return nil
+}
+
+// Redacted returns a copy without secrets, for -print-config
+func (c Config) Redacted() Config {
+	c.Database = c.Database.Redacted()
+	if c.Cache.Redis.Password != "" {
+		c.Cache.Redis.Password = "REDACTED"
+	}
+	c.Events.WebhookURL = redactURL(c.Events.WebhookURL)
+	return c
+}
+
+// redactURL hides the userinfo and query values of raw, where webhook URLs
+// usually carry their tokens. A value that does not parse is hidden whole.
+func redactURL(raw string) string {
+	if raw == "" {
+		return raw
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "REDACTED"
+	}
+	if parsed.User != nil {
+		parsed.User = url.User("REDACTED")
+	}
+	if parsed.RawQuery != "" {
+		query := parsed.Query()
+		for key := range query {
+			query.Set(key, "REDACTED")
+		}
+		parsed.RawQuery = query.Encode()
+	}
+	return parsed.String()
+}
+
+// writeConfig prints config in the config file format
+func writeConfig(w io.Writer, config Config) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(config); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	return encoder.Close()
+}
+
+func (c *Config) receiveSettings() sources.ReceiveSettings {
+	return sources.ReceiveSettings{
+		MaxOutstandingMessages: c.PubSub.MaxOutstandingMessages,
+		MaxOutstandingBytes:    c.PubSub.MaxOutstandingBytes,
+		NumGoroutines:          c.PubSub.NumGoroutines,
+		MaxExtension:           c.PubSub.MaxExtension,
+		Synchronous:            c.PubSub.SynchronousPull,
+	}
+}
+
+func (c *Config) adaptiveConfig() workers.AdaptiveConfig {
+	return workers.AdaptiveConfig(c.PubSub.Adaptive)
+}
+
+func (c *Config) batchConfig() services.BatchConfig {
+	return services.BatchConfig{
+		MaxSize:     c.Batch.Size,
+		MaxWait:     c.Batch.Wait,
+		Concurrency: c.Batch.Concurrency,
+	}
+}
+
+func (c *Config) retryPolicy() repositories.RetryPolicy {
+	return repositories.RetryPolicy(c.Retry)
+}
+
+func (c *Config) breakerConfig() workers.BreakerConfig {
+	return workers.BreakerConfig(c.Breaker)
+}
+
+func (c *Config) loggingConfig() logging.Config {
+	return logging.Config(c.Logging)
+}
+
+func (c *Config) tracingConfig() tracing.Config {
+	return tracing.Config(c.Tracing)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func load(t *testing.T, args []string, env map[string]string) (Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("consumer", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return loadConfig(fs, args, func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	})
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadConfigDefaultsAreValid(t *testing.T) {
+	config, err := load(t, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, defaultConfig(), config)
+	assert.NoError(t, config.Validate())
+	assert.Equal(t, "require", config.SchemaCheck, "writes need the migrated key, so a stale schema must stop startup")
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeFile(t, "consumer.yaml", `
+batch:
+  size: 10
+  wait: 1s
+  concurrency: 2
+database:
+  host: file-host
+  name: file-db
+`)
+
+	config, err := load(t,
+		[]string{"-config", path, "-batch-size", "30"},
+		map[string]string{"BATCH_SIZE": "20", "BATCH_WAIT": "2s", "DB_HOST": "env-host"},
+	)
+	require.NoError(t, err)
+
+	// flag > env > file > default
+	assert.Equal(t, 30, config.Batch.Size)
+	assert.Equal(t, 2*time.Second, config.Batch.Wait)
+	assert.Equal(t, 2, config.Batch.Concurrency)
+	assert.Equal(t, "env-host", config.Database.Host)
+	assert.Equal(t, "file-db", config.Database.Name)
+	assert.Equal(t, "postgres", config.Database.User)
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	path := writeFile(t, "consumer.yaml", "pubsub:\n  subscription: from-file\n")
+
+	config, err := load(t, nil, map[string]string{"CONFIG_FILE": path, "PUBSUB_PROJECT_ID": "prod"})
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", config.PubSub.Subscription)
+	assert.Equal(t, "prod", config.PubSub.Project)
+}
+
+func TestLoadConfigReportsFileAndEnvProblems(t *testing.T) {
+	path := writeFile(t, "consumer.yaml", "batch:\n  sise: 10\n")
+
+	config, err := load(t, []string{"-config", path}, map[string]string{"DB_PORT": "postgres", "BATCH_WAIT": "soon"})
+	require.Error(t, err)
+	assert.Equal(t, defaultConfig().Batch.Wait, config.Batch.Wait, "a bad variable keeps the previous value")
+	assert.Contains(t, err.Error(), "field sise not found")
+	assert.Contains(t, err.Error(), "DB_PORT")
+	assert.Contains(t, err.Error(), "BATCH_WAIT")
+}
+
+func TestValidateReportsEverySetting(t *testing.T) {
+	config := defaultConfig()
+	config.Source.Type = "kafka"
+	config.Events.Mode = "webhook"
+	config.Batch.Concurrency = 0
+	config.Logging.Level = "loud"
+	config.Tracing.SampleRatio = 2
+	config.Database.SSLMode = "prefer"
+
+	err := config.Validate()
+	require.Error(t, err)
+	lines := strings.Split(err.Error(), "\n")
+	assert.Len(t, lines, 6)
+	for _, field := range []string{
+		"source.type", "events.webhook_url", "batch.concurrency", "logging.level", "tracing.sample_ratio", "database.sslmode",
+	} {
+		assert.Contains(t, err.Error(), field+":")
+	}
+}
+
+func TestValidateAdaptiveNeedsPubSub(t *testing.T) {
+	config := defaultConfig()
+	config.Source = SourceConfig{Type: "file", File: "scans.jsonl"}
+	config.PubSub.Adaptive.Enabled = true
+
+	err := config.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pubsub.adaptive.enabled")
+}
+
+func TestValidateMemoryStore(t *testing.T) {
+	config := defaultConfig()
+	config.Store = "memory"
+	// Database and retry settings are not used, so they are not checked either
+	config.Database.SSLMode = "prefer"
+	config.Retry.MaxAttempts = 0
+	require.NoError(t, config.Validate())
+
+	config.Events = EventsConfig{Mode: "file", File: "changes.jsonl", PollInterval: time.Second}
+	err := config.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "events.mode: requires store postgres")
+
+	config.Store = "mongo"
+	err = config.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `store: must be one of postgres, sqlite, memory, got "mongo"`)
+}
+
+func TestValidateSQLiteStore(t *testing.T) {
+	config := defaultConfig()
+	config.Store = "sqlite"
+	config.Database.Port = 0
+	require.NoError(t, config.Validate())
+
+	config.SQLite.Path = ""
+	err := config.Validate()
+	require.Error(t, err)
+	assert.Equal(t, "sqlite.path: is required when store is sqlite", err.Error())
+}
+
+func TestValidateCache(t *testing.T) {
+	config := defaultConfig()
+	config.Cache.Type = "lru"
+	require.NoError(t, config.Validate())
+
+	config.Cache.Size = 0
+	config.Cache.TTL = -time.Second
+	err := config.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cache.size: must be at least 1")
+	assert.Contains(t, err.Error(), "cache.ttl: must not be negative")
+
+	config = defaultConfig()
+	config.Cache.Type = "redis"
+	config.Cache.Redis.Addr = "redis"
+	err = config.Validate()
+	require.Error(t, err)
+	assert.Equal(t, `cache.redis.addr: must be host:port, got "redis"`, err.Error())
+}
+
+func TestWriteConfigRedactsSecrets(t *testing.T) {
+	config := defaultConfig()
+	config.Database.Password = "hunter2"
+	config.Cache.Redis.Password = "hunter2"
+	config.Database.DSN = "postgres://app:hunter2@db:5432/scans"
+	config.Events.WebhookURL = "https://hunter2@hooks.example.com/scans?token=hunter2&channel=hunter2"
+
+	var out strings.Builder
+	require.NoError(t, writeConfig(&out, config.Redacted()))
+	assert.NotContains(t, out.String(), "hunter2")
+	assert.Contains(t, out.String(), "webhook_url: https://REDACTED@hooks.example.com/scans?channel=REDACTED&token=REDACTED")
+	assert.Contains(t, out.String(), "batch:\n  size: 100\n  wait: 50ms")
+
+	// The printed config can be loaded back
+	path := writeFile(t, "printed.yaml", out.String())
+	loaded, err := load(t, []string{"-config", path}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, config.Batch, loaded.Batch)
+}
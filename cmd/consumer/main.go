@@ -1,72 +1,372 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
 
+	"github.com/censys/scan-takehome/internal/cache"
+	"github.com/censys/scan-takehome/internal/deadletter"
+	"github.com/censys/scan-takehome/internal/events"
+	"github.com/censys/scan-takehome/internal/health"
+	"github.com/censys/scan-takehome/internal/logging"
+	"github.com/censys/scan-takehome/internal/metrics"
 	"github.com/censys/scan-takehome/internal/repositories"
+	"github.com/censys/scan-takehome/internal/sources"
+	"github.com/censys/scan-takehome/internal/tracing"
 	"github.com/censys/scan-takehome/internal/workers"
 )
 
 func main() {
-	projectId := flag.String("project", "test-project", "GCP Project ID")
-	subscriptionId := flag.String("subscription", "scan-sub", "GCP PubSub Subscription ID")
-	dbHost := flag.String("db-host", getEnv("DB_HOST", "localhost"), "Database host")
-	dbPort := flag.String("db-port", getEnv("DB_PORT", "5432"), "Database port")
-	dbName := flag.String("db-name", getEnv("DB_NAME", "scans"), "Database name")
-	dbUser := flag.String("db-user", getEnv("DB_USER", "postgres"), "Database user")
-	dbPassword := flag.String("db-password", getEnv("DB_PASSWORD", "postgres"), "Database password")
-	flag.Parse()
-
-	if err := run(*projectId, *subscriptionId, *dbHost, *dbPort, *dbName, *dbUser, *dbPassword); err != nil {
-		log.Fatalf("Application error: %v", err)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
 	}
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(runVerify(os.Args[2:]))
+	}
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	printConfig := fs.Bool("print-config", false, "Print the effective configuration with secrets redacted and exit")
+	validateConfig := fs.Bool("validate-config", false, "Validate the configuration, report every problem and exit")
+
+	config, err := loadConfig(fs, os.Args[1:], os.LookupEnv)
+	invalid := errors.Join(err, config.Validate())
+
+	if *printConfig {
+		if err := writeConfig(os.Stdout, config.Redacted()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if invalid != nil {
+		reportInvalid(invalid)
+		os.Exit(2)
+	}
+	if *validateConfig {
+		fmt.Fprintln(os.Stderr, "configuration is valid")
+	}
+	if *printConfig || *validateConfig {
+		return
+	}
+
+	logger, err := logging.New(os.Stderr, config.loggingConfig())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	if err := run(config); err != nil {
+		slog.Error("Application error", "error", err)
+		os.Exit(1)
+	}
+}
+
+// reportInvalid lists every configuration problem on stderr
+func reportInvalid(err error) {
+	fmt.Fprintln(os.Stderr, "invalid configuration:")
+	for _, line := range strings.Split(err.Error(), "\n") {
+		fmt.Fprintln(os.Stderr, "  "+line)
+	}
+}
+
+func newMessageSource(config Config) (workers.MessageSource, error) {
+	switch config.Source.Type {
+	case "pubsub":
+		return sources.NewPubSubSource(context.Background(), config.PubSub.Project, config.PubSub.Subscription)
+	case "file":
+		return sources.NewFileSource(config.Source.File)
+	default:
+		return nil, fmt.Errorf("unknown message source %q", config.Source.Type)
+	}
+}
+
+// newDeadLetterSink returns table, the store's own dead-letter table, for
+// -dead-letter=table
+func newDeadLetterSink(config Config, table workers.DeadLetterSink) (workers.DeadLetterSink, func(), error) {
+	switch config.DeadLetter.Mode {
+	case "none":
+		return nil, func() {}, nil
+	case "table":
+		return table, func() {}, nil
+	case "topic":
+		sink, err := deadletter.NewPubSubSink(context.Background(), config.PubSub.Project, config.DeadLetter.Topic)
+		if err != nil {
+			return nil, nil, err
+		}
+		return sink, func() {
+			if err := sink.Close(); err != nil {
+				slog.Error("Failed to close dead-letter sink", "error", err)
+			}
+		}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown dead-letter sink %q", config.DeadLetter.Mode)
+	}
+}
+
+// newEventPublisher returns a nil publisher when change events are disabled
+func newEventPublisher(config Config) (events.Publisher, func(), error) {
+	switch config.Events.Mode {
+	case "none":
+		return nil, func() {}, nil
+	case "topic":
+		publisher, err := events.NewPubSubPublisher(context.Background(), config.PubSub.Project, config.Events.Topic)
+		if err != nil {
+			return nil, nil, err
+		}
+		return publisher, func() {
+			if err := publisher.Close(); err != nil {
+				slog.Error("Failed to close event publisher", "error", err)
+			}
+		}, nil
+	case "webhook":
+		return events.NewWebhookPublisher(config.Events.WebhookURL, 10*time.Second), func() {}, nil
+	case "file":
+		publisher, err := events.NewFilePublisher(config.Events.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		return publisher, func() {
+			if err := publisher.Close(); err != nil {
+				slog.Error("Failed to close event publisher", "error", err)
+			}
+		}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown change event sink %q", config.Events.Mode)
+	}
+}
+
+// startAdminServer serves metrics and health probes until the returned
+// function is called
+func startAdminServer(addr string, probes *health.Probes) func() {
+	if addr == "" {
+		return func() {}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	probes.Register(mux)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		slog.Info("Serving metrics and health probes", "addr", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Admin server failed", "error", err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Error("Failed to stop admin server", "error", err)
+		}
+	}
+}
+
+// scanStore is the storage backend the worker writes to
+type scanStore interface {
+	cache.Backend
+	Ping(ctx context.Context) error
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// newCache opens the configured cache store, or returns nil when caching is
+// off. The returned function closes the connection to Redis.
+func newCache(config Config) (cache.Store, func(), error) {
+	var store cache.Store
+	closeStore := func() {}
+	switch config.Cache.Type {
+	case "none":
+		return nil, closeStore, nil
+	case "lru":
+		store = cache.NewLRU(config.Cache.Size, config.Cache.TTL)
+	case "redis":
+		client := redis.NewClient(&redis.Options{
+			Addr:     config.Cache.Redis.Addr,
+			Password: config.Cache.Redis.Password,
+			DB:       config.Cache.Redis.DB,
+		})
+		closeStore = func() { client.Close() }
+		redisStore := cache.NewRedis(client, config.Cache.TTL)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		// The cache fails open, so an unreachable Redis only costs database round trips
+		if err := redisStore.Ping(ctx); err != nil {
+			slog.Warn("Redis cache is unreachable; scans go to the database until it recovers", "error", err)
+		}
+		store = redisStore
+	default:
+		return nil, nil, fmt.Errorf("unknown cache type %q", config.Cache.Type)
 	}
-	return defaultValue
+
+	slog.Info("Caching latest scans", "type", config.Cache.Type, "ttl", config.Cache.TTL)
+	return store, closeStore, nil
 }
 
-func run(projectId, subscriptionId, dbHost, dbPort, dbName, dbUser, dbPassword string) error {
-	dbURL := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
+// openPostgres connects to the database, checks its schema and starts the
+// change event relay when events are enabled. The returned function waits for
+// the relay to stop and then closes the connections.
+func openPostgres(config Config) (*repositories.PostgresRepository, *sql.DB, func(), error) {
+	database, migrator, err := openMigrator(context.Background(), config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := checkSchema(context.Background(), migrator, config.SchemaCheck); err != nil {
+		database.Close()
+		return nil, nil, nil, err
+	}
 
-	db, err := sql.Open("postgres", dbURL)
+	publisher, closePublisher, err := newEventPublisher(config)
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+		database.Close()
+		return nil, nil, nil, fmt.Errorf("failed to create event publisher: %w", err)
 	}
-	defer db.Close()
 
-	if err := db.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
+	repoOpts := []repositories.PostgresOption{repositories.WithRetry(config.retryPolicy())}
+	stopRelay := func() {}
+	if publisher != nil {
+		outbox := repositories.NewPostgresOutboxRepository(database, config.Events.MaxAttempts)
+		relay := events.NewOutboxRelay(outbox, publisher, events.RelayConfig{
+			PollInterval: config.Events.PollInterval,
+		})
+		relayCtx, cancelRelay := context.WithCancel(context.Background())
+		relayDone := make(chan struct{})
+		go func() {
+			defer close(relayDone)
+			relay.Run(relayCtx)
+		}()
+		// The publisher and the database stay open until an in-progress
+		// publish has given up and released its row locks
+		stopRelay = func() {
+			cancelRelay()
+			<-relayDone
+		}
+
+		repoOpts = append(repoOpts, repositories.WithChangeEvents(relay.Notify))
 	}
 
-	repo := repositories.NewPostgresRepository(db)
+	return repositories.NewPostgresRepository(database, repoOpts...), database, func() {
+		stopRelay()
+		closePublisher()
+		database.Close()
+	}, nil
+}
+
+// openSQLite opens the database file and checks its schema. The returned
+// function closes it.
+func openSQLite(config Config) (*repositories.SQLiteRepository, *sql.DB, func(), error) {
+	database, migrator, err := openMigrator(context.Background(), config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-	config := workers.Config{
-		ProjectID:      projectId,
-		SubscriptionID: subscriptionId,
-		Repository:     repo,
+	if err := checkSchema(context.Background(), migrator, config.SchemaCheck); err != nil {
+		database.Close()
+		return nil, nil, nil, err
 	}
 
-	scanWorker, err := workers.NewScanWorker(config)
+	return repositories.NewSQLiteRepository(database), database, func() { database.Close() }, nil
+}
+
+func run(config Config) error {
+	shutdownTracing, err := tracing.Setup(context.Background(), "scan-consumer", config.tracingConfig())
 	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Failed to flush traces", "error", err)
+		}
+	}()
+
+	var repo scanStore
+	var deadLetterTable workers.DeadLetterSink
+	switch config.Store {
+	case "memory":
+		memory := repositories.NewMemoryRepository()
+		repo, deadLetterTable = memory, memory
+		slog.Warn("Storing scans in memory; they are lost when the consumer exits")
+	case "sqlite":
+		sqlite, database, closeSQLite, err := openSQLite(config)
+		if err != nil {
+			return err
+		}
+		defer closeSQLite()
+		repo, deadLetterTable = sqlite, repositories.NewSQLiteDeadLetterRepository(database)
+	default:
+		postgres, database, closePostgres, err := openPostgres(config)
+		if err != nil {
+			return err
+		}
+		defer closePostgres()
+		repo, deadLetterTable = postgres, repositories.NewPostgresDeadLetterRepository(database)
+	}
+
+	scanCache, closeCache, err := newCache(config)
+	if err != nil {
+		return fmt.Errorf("failed to create cache: %w", err)
+	}
+	defer closeCache()
+
+	deadLetters, closeDeadLetters, err := newDeadLetterSink(config, deadLetterTable)
+	if err != nil {
+		return fmt.Errorf("failed to create dead-letter sink: %w", err)
+	}
+	defer closeDeadLetters()
+
+	// The source is opened last, as nothing closes it until the worker owns it
+	source, err := newMessageSource(config)
+	if err != nil {
+		return fmt.Errorf("failed to create message source: %w", err)
+	}
+
+	scanWorker, err := workers.NewScanWorker(workers.Config{
+		Source:        source,
+		Repository:    repo,
+		DeadLetters:   deadLetters,
+		Batch:         config.batchConfig(),
+		Receive:       config.receiveSettings(),
+		Adaptive:      config.adaptiveConfig(),
+		ShutdownGrace: config.ShutdownGrace,
+		Breaker:       config.breakerConfig(),
+		Cache:         scanCache,
+	})
+	if err != nil {
+		if err := source.Close(); err != nil {
+			slog.Error("Failed to close message source", "error", err)
+		}
 		return fmt.Errorf("failed to create scan worker: %w", err)
 	}
 	defer func() {
 		if err := scanWorker.Stop(); err != nil {
-			log.Printf("Error stopping scan worker: %v", err)
+			slog.Error("Failed to stop scan worker", "error", err)
 		}
 	}()
 
+	probes := health.NewProbes()
+	probes.AddLivenessCheck("receiver", scanWorker.CheckLive)
+	probes.AddReadinessCheck("receiver", scanWorker.CheckReady)
+	probes.AddReadinessCheck("database", repo.Ping)
+	stopAdmin := startAdminServer(config.AdminAddr, probes)
+	defer stopAdmin()
+
 	if err := scanWorker.Run(); err != nil {
 		return fmt.Errorf("worker error: %w", err)
 	}
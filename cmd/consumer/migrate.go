@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/censys/scan-takehome/internal/db"
+	"github.com/censys/scan-takehome/internal/logging"
+)
+
+const migrateUsage = "usage: consumer migrate up|down|status [flags]"
+
+// runMigrate implements `consumer migrate up|down|status`. It reads the same
+// store and database settings as the consumer and returns the exit code.
+func runMigrate(args []string) int {
+	if len(args) == 0 || (args[0] != "up" && args[0] != "down" && args[0] != "status") {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("consumer migrate "+action, flag.ExitOnError)
+	steps := fs.Int("steps", 1, "Migrations to revert with down")
+	config, err := loadConfig(fs, args[1:], os.LookupEnv)
+	if err == nil && config.Store == "memory" {
+		err = errors.New("store: memory has no schema to migrate")
+	}
+	if invalid := errors.Join(err, config.validateStore()); invalid != nil {
+		reportInvalid(invalid)
+		return 2
+	}
+	if action == "down" && *steps < 1 {
+		fmt.Fprintln(os.Stderr, "-steps must be at least 1")
+		return 2
+	}
+
+	logger, err := logging.New(os.Stderr, config.loggingConfig())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	slog.SetDefault(logger)
+
+	if err := migrate(context.Background(), config, action, *steps); err != nil {
+		slog.Error("Migration failed", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// openMigrator opens the database of the configured store along with the
+// Migrator for its dialect
+func openMigrator(ctx context.Context, config Config) (*sql.DB, *db.Migrator, error) {
+	var database *sql.DB
+	var err error
+	newMigrator := db.NewMigrator
+	switch config.Store {
+	case "postgres":
+		database, err = db.Open(ctx, config.Database)
+	case "sqlite":
+		database, err = db.OpenSQLite(ctx, config.SQLite.Path)
+		newMigrator = db.NewSQLiteMigrator
+	default:
+		return nil, nil, fmt.Errorf("store %q has no schema to migrate", config.Store)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	migrator, err := newMigrator(database)
+	if err != nil {
+		database.Close()
+		return nil, nil, err
+	}
+	return database, migrator, nil
+}
+
+func migrate(ctx context.Context, config Config, action string, steps int) error {
+	database, migrator, err := openMigrator(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	switch action {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			slog.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		slog.Info("Schema is up to date", "applied", len(applied))
+	case "down":
+		reverted, err := migrator.Down(ctx, steps)
+		for _, migration := range reverted {
+			slog.Info("Reverted migration", "version", migration.Version, "name", migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	}
+	return nil
+}
+
+// checkSchema compares the database with the embedded migrations according
+// to mode: require refuses to start when migrations are pending, warn only
+// logs them and off skips the check
+func checkSchema(ctx context.Context, migrator *db.Migrator, mode string) error {
+	if mode == "off" {
+		return nil
+	}
+
+	err := migrator.Check(ctx)
+	if errors.Is(err, db.ErrSchemaBehind) && mode == "warn" {
+		slog.Warn("Database schema is behind, run `consumer migrate up`", "error", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("schema check failed, run `consumer migrate up`: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/logging"
+	"github.com/censys/scan-takehome/internal/manifest"
+	"github.com/censys/scan-takehome/internal/repositories"
+)
+
+// verifyPageSize is how many stored records each ListScans call reads
+const verifyPageSize = 1000
+
+// scanLister is the part of a repository the verifier reads from
+type scanLister interface {
+	ListScans(ctx context.Context, filter domain.ScanFilter) ([]domain.ServiceScan, error)
+}
+
+type verifyOptions struct {
+	ignoreExtra bool
+	// wait keeps re-auditing until the store converges or wait has passed
+	wait     time.Duration
+	interval time.Duration
+}
+
+// runVerify implements `consumer verify`. It compares the configured store
+// with what the scanner published, prints each discrepancy as a JSON line on
+// stdout and returns 0 only when the store matches.
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("consumer verify", flag.ExitOnError)
+	manifestPath := fs.String("manifest", "", "Manifest written by the scanner's -manifest flag")
+	scansPath := fs.String("scans", "", "JSONL file of published scan messages, such as the scanner's -output")
+	var opts verifyOptions
+	fs.BoolVar(&opts.ignoreExtra, "ignore-extra", false, "Do not report stored records that were never published")
+	fs.DurationVar(&opts.wait, "wait", 0, "Keep checking until the store converges or this long has passed")
+	fs.DurationVar(&opts.interval, "interval", 5*time.Second, "Time between checks with -wait")
+
+	config, err := loadConfig(fs, args, os.LookupEnv)
+	if err == nil && config.Store == "memory" {
+		err = errors.New("store: memory keeps no records to verify")
+	}
+	if invalid := errors.Join(err, config.validateStore()); invalid != nil {
+		reportInvalid(invalid)
+		return 2
+	}
+	if (*manifestPath == "") == (*scansPath == "") {
+		fmt.Fprintln(os.Stderr, "exactly one of -manifest or -scans is required")
+		return 2
+	}
+	if opts.wait < 0 || opts.interval <= 0 {
+		fmt.Fprintln(os.Stderr, "-wait must not be negative and -interval must be positive")
+		return 2
+	}
+
+	logger, err := logging.New(os.Stderr, config.loggingConfig())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	slog.SetDefault(logger)
+
+	entries, err := loadExpected(*manifestPath, *scansPath)
+	if err != nil {
+		slog.Error("Failed to load published scans", "error", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	discrepancies, err := verify(ctx, config, entries, opts, os.Stdout)
+	if err != nil {
+		slog.Error("Verification failed", "error", err)
+		return 1
+	}
+	if discrepancies > 0 {
+		return 1
+	}
+	return 0
+}
+
+// loadExpected reads the expected records from a manifest, or derives them
+// from a file of published messages
+func loadExpected(manifestPath, scansPath string) ([]manifest.Entry, error) {
+	path := manifestPath
+	if path == "" {
+		path = scansPath
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if manifestPath != "" {
+		return manifest.Read(f)
+	}
+
+	builder := manifest.NewBuilder()
+	if err := builder.ObserveLines(f); err != nil {
+		return nil, err
+	}
+	if builder.Invalid > 0 {
+		slog.Info("Skipped messages the consumer would reject", "count", builder.Invalid)
+	}
+	return builder.Entries(), nil
+}
+
+// verify opens the store and audits it, repeating while opts.wait allows,
+// then writes the discrepancies of the last audit to out and returns how
+// many there were
+func verify(ctx context.Context, config Config, entries []manifest.Entry, opts verifyOptions, out io.Writer) (int, error) {
+	database, migrator, err := openMigrator(ctx, config)
+	if err != nil {
+		return 0, err
+	}
+	defer database.Close()
+
+	if err := checkSchema(ctx, migrator, "require"); err != nil {
+		return 0, err
+	}
+
+	var repo scanLister
+	if config.Store == "sqlite" {
+		repo = repositories.NewSQLiteRepository(database)
+	} else {
+		repo = repositories.NewPostgresRepository(database)
+	}
+
+	deadline := time.Now().Add(opts.wait)
+	for {
+		discrepancies, err := audit(ctx, repo, entries, opts.ignoreExtra)
+		if err != nil {
+			return 0, err
+		}
+		if len(discrepancies) == 0 || !time.Now().Add(opts.interval).Before(deadline) {
+			return len(discrepancies), report(out, entries, discrepancies)
+		}
+
+		slog.Info("Store has not converged yet", "discrepancies", len(discrepancies), "retry_in", opts.interval.String())
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(opts.interval):
+		}
+	}
+}
+
+// audit pages through every stored record by key and compares it with the
+// expected entries
+func audit(ctx context.Context, repo scanLister, entries []manifest.Entry, ignoreExtra bool) ([]manifest.Discrepancy, error) {
+	check := manifest.NewAudit(entries)
+	var discrepancies []manifest.Discrepancy
+
+	filter := domain.ScanFilter{Limit: verifyPageSize}
+	for {
+		scans, err := repo.ListScans(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, scan := range scans {
+			discrepancy := check.Check(scan)
+			if discrepancy == nil || (ignoreExtra && discrepancy.Kind == manifest.Extra) {
+				continue
+			}
+			discrepancies = append(discrepancies, *discrepancy)
+		}
+
+		if len(scans) < filter.Limit {
+			break
+		}
+		last := scans[len(scans)-1].Key()
+		filter.After = &last
+	}
+
+	return append(discrepancies, check.Missing()...), nil
+}
+
+// report writes each discrepancy as a JSON line and logs a summary by kind
+func report(out io.Writer, entries []manifest.Entry, discrepancies []manifest.Discrepancy) error {
+	encoder := json.NewEncoder(out)
+	counts := map[string]int{}
+	for i := range discrepancies {
+		counts[discrepancies[i].Kind]++
+		if err := encoder.Encode(discrepancies[i]); err != nil {
+			return fmt.Errorf("failed to write discrepancy: %w", err)
+		}
+	}
+
+	if len(discrepancies) == 0 {
+		slog.Info("Store matches the published scans", "services", len(entries))
+		return nil
+	}
+	slog.Warn("Store does not match the published scans",
+		"services", len(entries),
+		"discrepancies", len(discrepancies),
+		manifest.Missing, counts[manifest.Missing],
+		manifest.Outdated, counts[manifest.Outdated],
+		manifest.WrongResponse, counts[manifest.WrongResponse],
+		manifest.Newer, counts[manifest.Newer],
+		manifest.Extra, counts[manifest.Extra],
+	)
+	return nil
+}
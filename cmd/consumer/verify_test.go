@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/censys/scan-takehome/internal/db"
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/manifest"
+	"github.com/censys/scan-takehome/internal/repositories"
+)
+
+func expected(ip string, timestamp int64, response string) manifest.Entry {
+	return manifest.Entry{IP: ip, Port: 80, Service: "HTTP", LastScanned: time.Unix(timestamp, 0).UTC(), Responses: []string{response}}
+}
+
+func storeScan(t *testing.T, repo *repositories.MemoryRepository, ip string, timestamp int64, response string) {
+	t.Helper()
+	_, err := repo.UpsertScan(context.Background(), &domain.ServiceScan{
+		IP: ip, Port: 80, Service: "HTTP", LastScanned: time.Unix(timestamp, 0).UTC(), Response: response,
+	})
+	require.NoError(t, err)
+}
+
+func kinds(discrepancies []manifest.Discrepancy) []string {
+	var kinds []string
+	for _, d := range discrepancies {
+		kinds = append(kinds, d.Kind+" "+d.IP)
+	}
+	return kinds
+}
+
+func TestAudit_PagesThroughTheStore(t *testing.T) {
+	repo := repositories.NewMemoryRepository()
+	var entries []manifest.Entry
+	// More than one page, so every record after the first page is read by key
+	for i := 0; i < verifyPageSize+5; i++ {
+		ip := "10.0." + strconv.Itoa(i/256) + "." + strconv.Itoa(i%256)
+		entries = append(entries, expected(ip, 100, "ok"))
+		storeScan(t, repo, ip, 100, "ok")
+	}
+
+	discrepancies, err := audit(context.Background(), repo, entries, false)
+	require.NoError(t, err)
+	assert.Empty(t, discrepancies)
+}
+
+func TestAudit_ReportsEveryKind(t *testing.T) {
+	repo := repositories.NewMemoryRepository()
+	storeScan(t, repo, "1.1.1.1", 100, "ok")
+	storeScan(t, repo, "1.1.1.2", 100, "old")
+	storeScan(t, repo, "1.1.1.3", 200, "unpublished")
+	storeScan(t, repo, "9.9.9.9", 100, "extra")
+	entries := []manifest.Entry{
+		expected("1.1.1.1", 100, "ok"),
+		expected("1.1.1.2", 200, "new"),
+		expected("1.1.1.3", 100, "published"),
+		expected("1.1.1.4", 100, "lost"),
+	}
+
+	discrepancies, err := audit(context.Background(), repo, entries, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"outdated 1.1.1.2", "newer 1.1.1.3", "extra 9.9.9.9", "missing 1.1.1.4"}, kinds(discrepancies))
+
+	discrepancies, err = audit(context.Background(), repo, entries, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"outdated 1.1.1.2", "newer 1.1.1.3", "missing 1.1.1.4"}, kinds(discrepancies))
+}
+
+func TestVerify_SQLiteStore(t *testing.T) {
+	config := defaultConfig()
+	config.Store = "sqlite"
+	config.SQLite.Path = t.TempDir() + "/scans.db"
+	require.NoError(t, migrate(context.Background(), config, "up", 0))
+
+	entries := []manifest.Entry{expected("1.1.1.1", 100, "ok")}
+	opts := verifyOptions{interval: time.Millisecond}
+
+	var out bytes.Buffer
+	discrepancies, err := verify(context.Background(), config, entries, opts, &out)
+	require.NoError(t, err)
+	assert.Equal(t, 1, discrepancies)
+
+	var reported manifest.Discrepancy
+	require.NoError(t, json.Unmarshal(out.Bytes(), &reported))
+	assert.Equal(t, manifest.Missing, reported.Kind)
+	assert.Equal(t, "1.1.1.1", reported.IP)
+
+	database, err := db.OpenSQLite(context.Background(), config.SQLite.Path)
+	require.NoError(t, err)
+	_, err = repositories.NewSQLiteRepository(database).UpsertScan(context.Background(), &domain.ServiceScan{
+		IP: "1.1.1.1", Port: 80, Service: "HTTP", LastScanned: time.Unix(100, 0).UTC(), Response: "ok",
+	})
+	require.NoError(t, err)
+	require.NoError(t, database.Close())
+
+	out.Reset()
+	discrepancies, err = verify(context.Background(), config, entries, opts, &out)
+	require.NoError(t, err)
+	assert.Zero(t, discrepancies)
+	assert.Empty(t, out.String())
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+
+	_ "github.com/lib/pq"
+
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/repositories"
+)
+
+// pageSize is how many records are fetched per query while paging through results
+const pageSize = 1000
+
+func main() {
+	var (
+		filter                         domain.ScanFilter
+		port, family, limit            int
+		cidr, ipFrom, ipTo             string
+		dbHost, dbPort, dbName, dbUser string
+		dbPassword                     string
+	)
+	flag.StringVar(&filter.IP, "ip", "", "Exact IP address")
+	flag.StringVar(&cidr, "cidr", "", "CIDR block to match, e.g. 1.1.1.0/24")
+	flag.StringVar(&ipFrom, "ip-from", "", "First address of an inclusive IP range")
+	flag.StringVar(&ipTo, "ip-to", "", "Last address of an inclusive IP range")
+	flag.IntVar(&family, "family", 0, "IP family to match (4 or 6)")
+	flag.IntVar(&port, "port", 0, "Port to match")
+	flag.StringVar(&filter.Service, "service", "", "Service to match")
+	flag.IntVar(&limit, "limit", 0, "Maximum records to print (0 prints all)")
+	flag.StringVar(&dbHost, "db-host", getEnv("DB_HOST", "localhost"), "Database host")
+	flag.StringVar(&dbPort, "db-port", getEnv("DB_PORT", "5432"), "Database port")
+	flag.StringVar(&dbName, "db-name", getEnv("DB_NAME", "scans"), "Database name")
+	flag.StringVar(&dbUser, "db-user", getEnv("DB_USER", "postgres"), "Database user")
+	flag.StringVar(&dbPassword, "db-password", getEnv("DB_PASSWORD", "postgres"), "Database password")
+	flag.Parse()
+
+	if port < 0 || port > 65535 {
+		log.Fatalf("-port must be between 1 and 65535")
+	}
+	filter.Port = uint32(port)
+	filter.IP = domain.CanonicalIP(filter.IP)
+	filter.Family = domain.IPFamily(family)
+
+	if err := parseAddresses(&filter, cidr, ipFrom, ipTo); err != nil {
+		log.Fatalf("Invalid query: %v", err)
+	}
+
+	dbURL := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		dbHost, dbPort, dbUser, dbPassword, dbName)
+
+	if err := run(dbURL, filter, limit); err != nil {
+		log.Fatalf("Application error: %v", err)
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func parseAddresses(filter *domain.ScanFilter, cidr, ipFrom, ipTo string) error {
+	var err error
+	if cidr != "" {
+		if filter.Network, err = netip.ParsePrefix(cidr); err != nil {
+			return fmt.Errorf("-cidr: %w", err)
+		}
+	}
+	if ipFrom != "" {
+		if filter.RangeStart, err = netip.ParseAddr(ipFrom); err != nil {
+			return fmt.Errorf("-ip-from: %w", err)
+		}
+	}
+	if ipTo != "" {
+		if filter.RangeEnd, err = netip.ParseAddr(ipTo); err != nil {
+			return fmt.Errorf("-ip-to: %w", err)
+		}
+	}
+	return filter.Validate()
+}
+
+// run prints every matching record as a JSON line, paging through the results by key
+func run(dbURL string, filter domain.ScanFilter, limit int) error {
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	repo := repositories.NewPostgresRepository(db)
+	encoder := json.NewEncoder(os.Stdout)
+	ctx := context.Background()
+
+	printed := 0
+	for {
+		filter.Limit = pageSize
+		if limit > 0 && limit-printed < pageSize {
+			filter.Limit = limit - printed
+		}
+
+		scans, err := repo.ListScans(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		for i := range scans {
+			if err := encoder.Encode(scans[i]); err != nil {
+				return fmt.Errorf("failed to write scan: %w", err)
+			}
+		}
+		printed += len(scans)
+
+		if len(scans) < filter.Limit || (limit > 0 && printed >= limit) {
+			return nil
+		}
+		last := scans[len(scans)-1].Key()
+		filter.After = &last
+	}
+}
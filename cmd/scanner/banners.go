@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// bannerFunc builds a plausible response of a service scanned at scanned
+type bannerFunc func(rng *rand.Rand, scanned time.Time) string
+
+// builtinBanners are the services the scanner can answer for without banners
+// in the profile
+var builtinBanners = map[string]bannerFunc{
+	"HTTP": httpBanner,
+	"SSH":  sshBanner,
+	"DNS":  dnsBanner,
+}
+
+func builtinServices() string {
+	names := make([]string, 0, len(builtinBanners))
+	for name := range builtinBanners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+var (
+	httpServers = []string{
+		"nginx/1.24.0", "nginx/1.18.0 (Ubuntu)", "Apache/2.4.58 (Ubuntu)", "Apache/2.4.6 (CentOS)",
+		"Microsoft-IIS/10.0", "cloudflare", "lighttpd/1.4.73", "Caddy",
+	}
+	httpStatuses = newWeighted(map[int]float64{
+		http.StatusOK:                 60,
+		http.StatusMovedPermanently:   10,
+		http.StatusFound:              5,
+		http.StatusForbidden:          10,
+		http.StatusNotFound:           10,
+		http.StatusServiceUnavailable: 5,
+	})
+	httpTitles = []string{"Welcome to nginx!", "Apache2 Ubuntu Default Page", "IIS Windows Server", "Login", "Dashboard", "Index of /"}
+
+	sshVersions = []string{
+		"SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13",
+		"SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6",
+		"SSH-2.0-OpenSSH_8.4p1 Debian-5+deb11u3",
+		"SSH-2.0-OpenSSH_7.4",
+		"SSH-2.0-dropbear_2022.83",
+		"SSH-2.0-Cisco-1.25",
+	}
+
+	dnsVersions = []string{"9.18.24-1-Debian", "9.16.48-Ubuntu", "PowerDNS Recursor 4.9.3", "dnsmasq-2.90", "unbound 1.19.1"}
+)
+
+func pick(rng *rand.Rand, values []string) string {
+	return values[rng.Intn(len(values))]
+}
+
+// httpBanner is a response header followed by a short HTML body
+func httpBanner(rng *rand.Rand, scanned time.Time) string {
+	status := httpStatuses.pick(rng)
+	server := pick(rng, httpServers)
+
+	var body string
+	switch {
+	case status == http.StatusOK:
+		title := pick(rng, httpTitles)
+		body = fmt.Sprintf("<!DOCTYPE html>\n<html><head><title>%s</title></head><body><h1>%s</h1></body></html>\n", title, title)
+	default:
+		text := http.StatusText(status)
+		body = fmt.Sprintf("<html><head><title>%d %s</title></head><body><center><h1>%d %s</h1></center><hr><center>%s</center></body></html>\n",
+			status, text, status, text, server)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+	fmt.Fprintf(&b, "Server: %s\r\n", server)
+	fmt.Fprintf(&b, "Date: %s\r\n", scanned.UTC().Format(http.TimeFormat))
+	b.WriteString("Content-Type: text/html; charset=utf-8\r\n")
+	fmt.Fprintf(&b, "Content-Length: %d\r\n", len(body))
+	if status == http.StatusMovedPermanently || status == http.StatusFound {
+		fmt.Fprintf(&b, "Location: https://www.example.com/%d\r\n", rng.Intn(1000))
+	}
+	b.WriteString("Connection: close\r\n\r\n")
+	b.WriteString(body)
+	return b.String()
+}
+
+// sshBanner is the protocol version exchange line servers send first
+func sshBanner(rng *rand.Rand, _ time.Time) string {
+	return pick(rng, sshVersions) + "\r\n"
+}
+
+// dnsBanner is dig's rendering of a version.bind query, which most servers
+// answer and some refuse
+func dnsBanner(rng *rand.Rand, _ time.Time) string {
+	id := rng.Intn(65536)
+	question := ";; QUESTION SECTION:\n;version.bind.\t\t\tCH\tTXT\n"
+	if rng.Intn(5) == 0 {
+		return fmt.Sprintf(";; ->>HEADER<<- opcode: QUERY, status: REFUSED, id: %d\n"+
+			";; flags: qr rd; QUERY: 1, ANSWER: 0, AUTHORITY: 0, ADDITIONAL: 0\n\n%s", id, question)
+	}
+	return fmt.Sprintf(";; ->>HEADER<<- opcode: QUERY, status: NOERROR, id: %d\n"+
+		";; flags: qr aa rd; QUERY: 1, ANSWER: 1, AUTHORITY: 0, ADDITIONAL: 0\n\n%s\n"+
+		";; ANSWER SECTION:\nversion.bind.\t\t0\tCH\tTXT\t%q\n", id, question, pick(rng, dnsVersions))
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/censys/scan-takehome/pkg/scanning"
+)
+
+// Faults the chaos settings inject, named like their profile settings
+const (
+	faultDuplicate      = "duplicate"
+	faultStale          = "stale"
+	faultFuture         = "future"
+	faultUnknownVersion = "unknown_version"
+	faultTruncatedJSON  = "truncated_json"
+	faultInvalidBase64  = "invalid_base64"
+)
+
+type fault struct {
+	name  string
+	share *float64
+}
+
+// faults lists the shares in a fixed order so a seeded run draws the same
+// faults. Each points into c, so a share can be set through it.
+func (c *ChaosProfile) faults() []fault {
+	return []fault{
+		{faultDuplicate, &c.Duplicate},
+		{faultStale, &c.Stale},
+		{faultFuture, &c.Future},
+		{faultUnknownVersion, &c.UnknownVersion},
+		{faultTruncatedJSON, &c.TruncatedJSON},
+		{faultInvalidBase64, &c.InvalidBase64},
+	}
+}
+
+// recentScans is how many sent scans duplicates and stale rescans are drawn from
+const recentScans = 1024
+
+type sentScan struct {
+	scan scanning.Scan
+	data []byte
+}
+
+// message returns the next message to publish and the fault it carries, or
+// an empty fault for a normal scan. Duplicates and stale rescans need an
+// earlier scan, so they are replaced by normal scans until one is sent.
+func (g *generator) message(scanned time.Time) ([]byte, string, error) {
+	chaos := g.profile.Chaos
+	name := g.pickFault()
+	switch {
+	case name == faultDuplicate && len(g.recent) > 0:
+		return g.recent[g.rng.Intn(len(g.recent))].data, name, nil
+
+	case name == faultStale && len(g.recent) > 0:
+		earlier := g.recent[g.rng.Intn(len(g.recent))].scan
+		scan := scanning.Scan{Ip: earlier.Ip, Port: earlier.Port, Service: earlier.Service}
+		g.fill(&scan, time.Unix(earlier.Timestamp, 0).Add(-g.between(time.Second, chaos.MaxStaleness)))
+		data, err := encodeScan(scan)
+		return data, name, err
+
+	case name == faultFuture:
+		data, err := g.remember(g.next(scanned.Add(g.between(time.Second, chaos.MaxFutureSkew))))
+		return data, name, err
+
+	case name == faultUnknownVersion:
+		scan := g.next(scanned)
+		scan.DataVersion = scanning.V2 + 1 + g.rng.Intn(100)
+		data, err := encodeScan(scan)
+		return data, name, err
+
+	case name == faultTruncatedJSON:
+		data, err := encodeScan(g.next(scanned))
+		if err != nil {
+			return nil, name, err
+		}
+		return data[:1+g.rng.Intn(len(data)-1)], name, nil
+
+	case name == faultInvalidBase64:
+		scan := g.next(scanned)
+		scan.DataVersion = scanning.V1
+		// '!' is outside the base64 alphabet
+		scan.Data = map[string]string{"response_bytes_utf8": "!" + base64.StdEncoding.EncodeToString([]byte(scan.Ip))}
+		data, err := encodeScan(scan)
+		return data, name, err
+	}
+
+	data, err := g.remember(g.next(scanned))
+	return data, "", err
+}
+
+// pickFault draws the fault of the next message. Without chaos nothing is
+// drawn, so the normal scans match a run from a profile without it.
+func (g *generator) pickFault() string {
+	if g.chaosTotal == 0 {
+		return ""
+	}
+	target := g.rng.Float64()
+	for _, fault := range g.profile.Chaos.faults() {
+		if target < *fault.share {
+			return fault.name
+		}
+		target -= *fault.share
+	}
+	return ""
+}
+
+// between returns a whole number of seconds in [low, high]
+func (g *generator) between(low, high time.Duration) time.Duration {
+	seconds := int64(low / time.Second)
+	return time.Duration(seconds+g.rng.Int63n(int64(high/time.Second)-seconds+1)) * time.Second
+}
+
+// remember encodes a valid scan and keeps it for later duplicates and stale rescans
+func (g *generator) remember(scan scanning.Scan) ([]byte, error) {
+	data, err := encodeScan(scan)
+	if err != nil {
+		return nil, err
+	}
+
+	sent := sentScan{scan: scan, data: data}
+	if len(g.recent) < recentScans {
+		g.recent = append(g.recent, sent)
+	} else {
+		g.recent[g.sent%recentScans] = sent
+	}
+	g.sent++
+	return data, nil
+}
+
+func encodeScan(scan scanning.Scan) ([]byte, error) {
+	data, err := json.Marshal(scan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode scan: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/handlers"
+	"github.com/censys/scan-takehome/internal/manifest"
+	"github.com/censys/scan-takehome/internal/repositories"
+	"github.com/censys/scan-takehome/internal/services"
+	"github.com/censys/scan-takehome/pkg/scanning"
+)
+
+func chaosProfile() Profile {
+	profile := defaultProfile()
+	profile.Seed = 11
+	profile.Rate = 1000
+	profile.Chaos = ChaosProfile{
+		Duplicate:      0.1,
+		Stale:          0.1,
+		MaxStaleness:   time.Hour,
+		Future:         0.05,
+		MaxFutureSkew:  time.Hour,
+		UnknownVersion: 0.05,
+		TruncatedJSON:  0.05,
+		InvalidBase64:  0.05,
+	}
+	return profile
+}
+
+type chaosMessage struct {
+	data    []byte
+	fault   string
+	scanned time.Time
+}
+
+func generateMessages(t *testing.T, profile Profile, n int) []chaosMessage {
+	gen := newTestGenerator(t, profile)
+	messages := make([]chaosMessage, n)
+	for i := range messages {
+		scanned := started.Add(time.Duration(i) * time.Second / time.Duration(profile.Rate))
+		data, fault, err := gen.message(scanned)
+		require.NoError(t, err)
+		messages[i] = chaosMessage{data: data, fault: fault, scanned: scanned}
+	}
+	return messages
+}
+
+func TestGenerator_ChaosShares(t *testing.T) {
+	counts := map[string]int{}
+	for _, msg := range generateMessages(t, chaosProfile(), 10000) {
+		counts[msg.fault]++
+	}
+
+	assert.InDelta(t, 6000, counts[""], 300)
+	assert.InDelta(t, 1000, counts[faultDuplicate], 150)
+	assert.InDelta(t, 1000, counts[faultStale], 150)
+	for _, fault := range []string{faultFuture, faultUnknownVersion, faultTruncatedJSON, faultInvalidBase64} {
+		assert.InDelta(t, 500, counts[fault], 100, fault)
+	}
+}
+
+func TestGenerator_ChaosFaults(t *testing.T) {
+	latest := map[domain.ServiceKey]time.Time{}
+	seen := map[string]bool{}
+
+	for _, msg := range generateMessages(t, chaosProfile(), 3000) {
+		var raw scanning.Scan
+		decodeErr := json.Unmarshal(msg.data, &raw)
+		if msg.fault == faultTruncatedJSON {
+			assert.Error(t, decodeErr)
+			continue
+		}
+		require.NoError(t, decodeErr)
+		scan, err := domain.ConvertScanToDomain(raw)
+
+		switch msg.fault {
+		case faultUnknownVersion:
+			assert.ErrorIs(t, err, domain.ErrUnsupportedDataVersion)
+			continue
+		case faultInvalidBase64:
+			assert.ErrorIs(t, err, domain.ErrMalformedData)
+			continue
+		}
+		require.NoError(t, err)
+
+		key := scan.Key()
+		switch msg.fault {
+		case faultDuplicate:
+			assert.True(t, seen[string(msg.data)], "duplicates repeat a message that was sent")
+		case faultStale:
+			assert.True(t, scan.LastScanned.Before(latest[key]), "stale scans are older than one already sent")
+		case faultFuture:
+			assert.True(t, scan.LastScanned.After(msg.scanned))
+			assert.False(t, scan.LastScanned.After(msg.scanned.Add(time.Hour)))
+		}
+
+		seen[string(msg.data)] = true
+		if scan.LastScanned.After(latest[key]) {
+			latest[key] = scan.LastScanned
+		}
+	}
+}
+
+// TestManifest_MatchesConsumer processes the messages in random order the
+// way the consumer does and expects to end up with the manifest
+func TestManifest_MatchesConsumer(t *testing.T) {
+	messages := generateMessages(t, chaosProfile(), 5000)
+
+	expected := manifest.NewBuilder()
+	for _, msg := range messages {
+		_ = expected.Observe(msg.data)
+	}
+
+	repo := repositories.NewMemoryRepository()
+	handler := handlers.NewMessageHandler(services.NewScanProcessor(repo))
+	rand.New(rand.NewSource(1)).Shuffle(len(messages), func(i, j int) { messages[i], messages[j] = messages[j], messages[i] })
+
+	rejected := 0
+	for _, msg := range messages {
+		if err := handler.HandleMessage(context.Background(), msg.data); err != nil {
+			require.True(t, handlers.IsPermanent(err), err)
+			rejected++
+		}
+	}
+	assert.Equal(t, expected.Invalid, rejected)
+
+	stored, err := repo.ListScans(context.Background(), domain.ScanFilter{})
+	require.NoError(t, err)
+	entries := expected.Entries()
+	require.Len(t, stored, len(entries))
+
+	tied := 0
+	for i, entry := range entries {
+		assert.Equal(t, entry.Key(), stored[i].Key())
+		assert.True(t, entry.LastScanned.Equal(stored[i].LastScanned), "%v: expected %v, stored %v", entry.Key(), entry.LastScanned, stored[i].LastScanned)
+		assert.Contains(t, entry.Responses, stored[i].Response)
+		if len(entry.Responses) > 1 {
+			tied++
+		}
+	}
+	assert.Positive(t, tied, "at 1000 scans per second some services are scanned twice in one second")
+}
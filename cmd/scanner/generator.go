@@ -0,0 +1,189 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand"
+	"net/netip"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/censys/scan-takehome/pkg/scanning"
+)
+
+// weighted picks values with probability proportional to their weight. Values
+// are sorted so a seeded generator makes the same picks on every run.
+type weighted[T cmp.Ordered] struct {
+	values     []T
+	cumulative []float64
+}
+
+func newWeighted[T cmp.Ordered](weights map[T]float64) weighted[T] {
+	var w weighted[T]
+	for value := range weights {
+		w.values = append(w.values, value)
+	}
+	slices.Sort(w.values)
+
+	total := 0.0
+	for _, value := range w.values {
+		total += weights[value]
+		w.cumulative = append(w.cumulative, total)
+	}
+	return w
+}
+
+func (w weighted[T]) pick(rng *rand.Rand) T {
+	target := rng.Float64() * w.cumulative[len(w.cumulative)-1]
+	i := sort.SearchFloat64s(w.cumulative, target)
+	// Float64 can return exactly 0, which matches the first value either way
+	if i == len(w.values) {
+		i--
+	}
+	return w.values[i]
+}
+
+type serviceGenerator struct {
+	ports   weighted[uint32]
+	banners []string
+	banner  bannerFunc
+}
+
+// generator turns a profile into scans. It is not safe for concurrent use.
+type generator struct {
+	profile  Profile
+	rng      *rand.Rand
+	networks weighted[string]
+	prefixes map[string]netip.Prefix
+	services weighted[string]
+	byName   map[string]serviceGenerator
+
+	// chaosTotal is the share of messages that carry a fault
+	chaosTotal float64
+	recent     []sentScan
+	sent       int
+}
+
+// newGenerator prepares a validated profile; the seed must already be chosen
+func newGenerator(profile Profile) (*generator, error) {
+	g := &generator{
+		profile:  profile,
+		rng:      rand.New(rand.NewSource(profile.Seed)), //nolint:gosec // reproducible test traffic, not secrets
+		networks: newWeighted(profile.Networks),
+		prefixes: map[string]netip.Prefix{},
+		byName:   map[string]serviceGenerator{},
+	}
+
+	for cidr := range profile.Networks {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse network %q: %w", cidr, err)
+		}
+		g.prefixes[cidr] = prefix.Masked()
+	}
+
+	serviceWeights := map[string]float64{}
+	for name, service := range profile.Services {
+		serviceWeights[name] = service.Weight
+		g.byName[name] = serviceGenerator{
+			ports:   newWeighted(service.Ports),
+			banners: service.Banners,
+			banner:  builtinBanners[name],
+		}
+	}
+	g.services = newWeighted(serviceWeights)
+
+	for _, fault := range profile.Chaos.faults() {
+		g.chaosTotal += *fault.share
+	}
+	return g, nil
+}
+
+// next returns the scan taken at scanned
+func (g *generator) next(scanned time.Time) scanning.Scan {
+	name := g.services.pick(g.rng)
+	service := g.byName[name]
+
+	scan := scanning.Scan{
+		Ip:      g.address().String(),
+		Port:    service.ports.pick(g.rng),
+		Service: name,
+	}
+	g.fill(&scan, scanned)
+	return scan
+}
+
+// fill stamps scan with scanned and gives it a new response in a random format
+func (g *generator) fill(scan *scanning.Scan, scanned time.Time) {
+	service := g.byName[scan.Service]
+	scan.Timestamp = scanned.Unix()
+
+	var response string
+	if len(service.banners) > 0 {
+		response = pick(g.rng, service.banners)
+	} else {
+		response = service.banner(g.rng, scanned)
+	}
+	response = g.resize(response)
+
+	if g.rng.Float64() < g.profile.V1Ratio {
+		scan.DataVersion = scanning.V1
+		scan.Data = &scanning.V1Data{ResponseBytesUtf8: []byte(response)}
+	} else {
+		scan.DataVersion = scanning.V2
+		scan.Data = &scanning.V2Data{ResponseStr: response}
+	}
+}
+
+// address picks a network and then a random address inside it
+func (g *generator) address() netip.Addr {
+	prefix := g.prefixes[g.networks.pick(g.rng)]
+	addr := prefix.Addr().AsSlice()
+	for i := range addr {
+		fixed := prefix.Bits() - i*8
+		if fixed >= 8 {
+			continue
+		}
+		random := byte(g.rng.Intn(256))
+		if fixed <= 0 {
+			addr[i] = random
+			continue
+		}
+		mask := byte(0xff >> fixed)
+		addr[i] = addr[i]&^mask | random&mask
+	}
+	result, _ := netip.AddrFromSlice(addr)
+	return result
+}
+
+const filler = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// resize pads the response with filler or truncates it to a length drawn from
+// the profile's response size range, like a scanner that reads a fixed
+// number of bytes
+func (g *generator) resize(response string) string {
+	size := g.profile.ResponseSize
+	if size.Max == 0 {
+		return response
+	}
+
+	target := size.Min + g.rng.Intn(size.Max-size.Min+1)
+	if len(response) >= target {
+		return truncateUTF8(response, target)
+	}
+
+	padding := make([]byte, target-len(response))
+	for i := range padding {
+		padding[i] = filler[g.rng.Intn(len(filler))]
+	}
+	return response + string(padding)
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	for n > 0 && n < len(s) && s[n]&0xc0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/pkg/scanning"
+)
+
+var started = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestGenerator(t *testing.T, profile Profile) *generator {
+	t.Helper()
+	require.NoError(t, profile.Validate())
+	gen, err := newGenerator(profile)
+	require.NoError(t, err)
+	return gen
+}
+
+func generateN(t *testing.T, profile Profile, n int) []scanning.Scan {
+	gen := newTestGenerator(t, profile)
+	scans := make([]scanning.Scan, n)
+	for i := range scans {
+		scans[i] = gen.next(started.Add(time.Duration(i) * time.Second))
+	}
+	return scans
+}
+
+func TestGenerator_SameSeedSameScans(t *testing.T) {
+	profile := defaultProfile()
+	profile.Seed = 42
+
+	first, err := json.Marshal(generateN(t, profile, 50))
+	require.NoError(t, err)
+	second, err := json.Marshal(generateN(t, profile, 50))
+	require.NoError(t, err)
+	assert.JSONEq(t, string(first), string(second))
+
+	profile.Seed = 43
+	other, err := json.Marshal(generateN(t, profile, 50))
+	require.NoError(t, err)
+	assert.NotEqual(t, string(first), string(other))
+}
+
+func TestGenerator_FollowsProfile(t *testing.T) {
+	profile := Profile{
+		Rate: 1,
+		Seed: 1,
+		Networks: map[string]float64{
+			"10.1.0.0/16":    1,
+			"2001:db8::/120": 1,
+		},
+		Services: map[string]ServiceProfile{
+			"SSH":  {Weight: 3, Ports: map[uint32]float64{22: 1, 2222: 1}},
+			"SMTP": {Weight: 1, Ports: map[uint32]float64{25: 1}, Banners: []string{"220 mx ESMTP\r\n"}},
+		},
+		V1Ratio: 0.25,
+	}
+	networks := []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16"), netip.MustParsePrefix("2001:db8::/120")}
+
+	counts := map[string]int{}
+	for _, scan := range generateN(t, profile, 4000) {
+		addr := netip.MustParseAddr(scan.Ip)
+		assert.True(t, networks[0].Contains(addr) || networks[1].Contains(addr), "address %s is outside the networks", addr)
+		counts[scan.Service]++
+		if scan.DataVersion == scanning.V1 {
+			counts["v1"]++
+		}
+
+		switch scan.Service {
+		case "SSH":
+			assert.Contains(t, []uint32{22, 2222}, scan.Port)
+		case "SMTP":
+			assert.Equal(t, uint32(25), scan.Port)
+		}
+
+		converted, err := domain.ConvertScanToDomain(roundTrip(t, scan))
+		require.NoError(t, err)
+		if scan.Service == "SMTP" {
+			assert.Equal(t, "220 mx ESMTP\r\n", converted.Response)
+		} else {
+			assert.True(t, strings.HasPrefix(converted.Response, "SSH-2.0-"), converted.Response)
+		}
+	}
+
+	assert.InDelta(t, 3000, counts["SSH"], 150)
+	assert.InDelta(t, 1000, counts["v1"], 150)
+}
+
+func TestGenerator_BuiltinBanners(t *testing.T) {
+	profile := defaultProfile()
+	profile.Seed = 3
+
+	for _, scan := range generateN(t, profile, 300) {
+		converted, err := domain.ConvertScanToDomain(roundTrip(t, scan))
+		require.NoError(t, err)
+
+		switch scan.Service {
+		case "HTTP":
+			assert.Regexp(t, `^HTTP/1\.1 \d{3} `, converted.Response)
+			assert.Contains(t, converted.Response, "\r\nDate: "+time.Unix(scan.Timestamp, 0).UTC().Format(http.TimeFormat)+"\r\n")
+		case "SSH":
+			assert.Regexp(t, `^SSH-2\.0-[^\r\n]+\r\n$`, converted.Response)
+		case "DNS":
+			assert.Contains(t, converted.Response, ";version.bind.")
+		default:
+			t.Fatalf("unexpected service %q", scan.Service)
+		}
+	}
+}
+
+func TestGenerator_ResizesResponses(t *testing.T) {
+	profile := defaultProfile()
+	profile.Seed = 5
+	profile.ResponseSize = SizeRange{Min: 40, Max: 60}
+
+	for _, scan := range generateN(t, profile, 200) {
+		converted, err := domain.ConvertScanToDomain(roundTrip(t, scan))
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, len(converted.Response), 40)
+		assert.LessOrEqual(t, len(converted.Response), 60)
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	assert.Equal(t, "ab", truncateUTF8("abcd", 2))
+	// "é" is two bytes and is not split
+	assert.Equal(t, "a", truncateUTF8("aé", 2))
+	assert.Equal(t, "aé", truncateUTF8("aé", 3))
+}
+
+// roundTrip decodes scan the way the consumer receives it
+func roundTrip(t *testing.T, scan scanning.Scan) scanning.Scan {
+	t.Helper()
+	data, err := json.Marshal(scan)
+	require.NoError(t, err)
+	var decoded scanning.Scan
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	return decoded
+}
@@ -1,61 +1,353 @@
 package main
 
 import (
+	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"math/rand"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/pubsub"
-	"github.com/censys/scan-takehome/pkg/scanning"
-)
+	"go.opentelemetry.io/otel/trace"
 
-var (
-	services = []string{"HTTP", "SSH", "DNS"}
+	"github.com/censys/scan-takehome/internal/manifest"
+	"github.com/censys/scan-takehome/internal/tracing"
 )
 
 func main() {
 	projectId := flag.String("project", "test-project", "GCP Project ID")
 	topicId := flag.String("topic", "scan-topic", "GCP PubSub Topic ID")
+	profilePath := flag.String("profile", getEnv("SCANNER_PROFILE", ""), "YAML traffic profile; the flags below override it")
+	output := flag.String("output", "", "Write scans as JSON lines to this file (- for stdout) instead of publishing them")
+	manifestPath := flag.String("manifest", "", "On exit, write the records the consumer should end up with to this file")
+	traceConfig := tracing.Config{SampleRatio: 1}
+	flag.StringVar(&traceConfig.Exporter, "trace-exporter", getEnv("TRACE_EXPORTER", "none"),
+		"OpenTelemetry span exporter (none, otlp, stdout or file)")
+	flag.StringVar(&traceConfig.Endpoint, "trace-endpoint", getEnv("TRACE_ENDPOINT", ""), "OTLP/HTTP collector URL")
+	flag.StringVar(&traceConfig.File, "trace-file", getEnv("TRACE_FILE", "scanner-traces.jsonl"), "File to append spans to")
 
-	ctx := context.Background()
+	overrides := profileFlags(flag.CommandLine)
+	flag.Parse()
 
-	client, err := pubsub.NewClient(ctx, *projectId)
+	profile, err := loadProfile(*profilePath)
+	if err == nil {
+		err = overrides(&profile)
+	}
+	if err == nil {
+		err = profile.Validate()
+	}
+	if err == nil && *output != "" && profile.Count == 0 {
+		err = errors.New("count: is required with -output")
+	}
 	if err != nil {
-		panic(err)
+		fmt.Fprintf(os.Stderr, "invalid profile:\n  %s\n", strings.ReplaceAll(err.Error(), "\n", "\n  "))
+		os.Exit(2)
+	}
+	if profile.Seed == 0 {
+		profile.Seed = time.Now().UnixNano()
 	}
 
-	topic := client.Topic(*topicId)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	for range time.Tick(time.Second) {
+	if err := run(ctx, profile, *projectId, *topicId, *output, *manifestPath, traceConfig); err != nil {
+		slog.Error("Scanner failed", "error", err)
+		os.Exit(1)
+	}
+}
 
-		scan := &scanning.Scan{
-			Ip:        fmt.Sprintf("1.1.1.%d", rand.Intn(255)),
-			Port:      uint32(rand.Intn(65535)),
-			Service:   services[rand.Intn(len(services))],
-			Timestamp: time.Now().Unix(),
-		}
+// profileFlags registers the flags that override profile settings. The
+// returned function applies the ones given on the command line.
+func profileFlags(fs *flag.FlagSet) func(profile *Profile) error {
+	rate := fs.Float64("rate", 0, "Scans published per second (default 1)")
+	count := fs.Int("count", 0, "Stop after this many scans (default 0, run until killed)")
+	seed := fs.Int64("seed", 0, "Seed for reproducible scans (default 0, pick one and log it)")
+	startTime := fs.String("start-time", "", "RFC 3339 time of the first scan; later scans are spaced by the rate instead of following the clock")
+	networks := fs.String("networks", "", "Comma-separated CIDRs to scan, equally weighted (default 1.1.1.0/24)")
+	v1Ratio := fs.Float64("v1-ratio", 0, "Share of scans published in the V1 format (default 0.5)")
+	chaos := map[string]*float64{}
+	for _, fault := range (&ChaosProfile{}).faults() {
+		chaos[fault.name] = fs.Float64(chaosFlag(fault.name), 0, fmt.Sprintf("Share of messages published with the %s fault", fault.name))
+	}
 
-		serviceResp := fmt.Sprintf("service response: %d", rand.Intn(100))
+	return func(profile *Profile) error {
+		var err error
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "rate":
+				profile.Rate = *rate
+			case "count":
+				profile.Count = *count
+			case "seed":
+				profile.Seed = *seed
+			case "start-time":
+				if profile.StartTime, err = time.Parse(time.RFC3339, *startTime); err != nil {
+					err = fmt.Errorf("-start-time: %w", err)
+				}
+			case "networks":
+				profile.Networks = map[string]float64{}
+				for _, cidr := range strings.Split(*networks, ",") {
+					profile.Networks[strings.TrimSpace(cidr)] = 1
+				}
+			case "v1-ratio":
+				profile.V1Ratio = *v1Ratio
+			}
+			for _, fault := range profile.Chaos.faults() {
+				if f.Name == chaosFlag(fault.name) {
+					*fault.share = *chaos[fault.name]
+				}
+			}
+		})
+		return err
+	}
+}
 
-		if rand.Intn(2) == 0 {
-			scan.DataVersion = scanning.V1
-			scan.Data = &scanning.V1Data{ResponseBytesUtf8: []byte(serviceResp)}
-		} else {
-			scan.DataVersion = scanning.V2
-			scan.Data = &scanning.V2Data{ResponseStr: serviceResp}
+// chaosFlag names the flag of a fault, such as -chaos-truncated-json
+func chaosFlag(fault string) string {
+	return "chaos-" + strings.ReplaceAll(fault, "_", "-")
+}
+
+func run(ctx context.Context, profile Profile, projectID, topicID, output, manifestPath string, traceConfig tracing.Config) error {
+	shutdownTracing, err := tracing.Setup(ctx, "scanner", traceConfig)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Failed to flush traces", "error", err)
 		}
+	}()
+
+	gen, err := newGenerator(profile)
+	if err != nil {
+		return err
+	}
 
-		encoded, err := json.Marshal(scan)
+	var out sink
+	paced := output == ""
+	if paced {
+		client, err := pubsub.NewClient(ctx, projectID)
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("failed to create Pub/Sub client: %w", err)
+		}
+		defer client.Close()
+		out = newTopicSink(client.Topic(topicID))
+	} else {
+		if out, err = newFileSink(output); err != nil {
+			return err
+		}
+	}
+
+	var expected *manifest.Builder
+	if manifestPath != "" {
+		expected = manifest.NewBuilder()
+	}
+
+	slog.Info("Generating scans", "seed", profile.Seed, "rate", profile.Rate, "count", profile.Count, "output", output)
+	stats, err := generate(ctx, profile, gen, out, paced, expected)
+	if closeErr := out.close(); err == nil {
+		err = closeErr
+	}
+	slog.Info("Scanner stopped", stats.logAttrs()...)
+	if err != nil {
+		return err
+	}
+
+	if expected != nil {
+		if err := writeManifest(manifestPath, expected); err != nil {
+			return err
+		}
+		slog.Info("Wrote manifest", "path", manifestPath, "records", len(expected.Entries()), "invalid_messages", expected.Invalid)
+	}
+	return nil
+}
+
+// generateStats counts the messages sent and the faults among them
+type generateStats struct {
+	sent   int
+	faults map[string]int
+}
+
+func (s generateStats) logAttrs() []any {
+	attrs := []any{"messages", s.sent}
+	names := make([]string, 0, len(s.faults))
+	for name := range s.faults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		attrs = append(attrs, name, s.faults[name])
+	}
+	return attrs
+}
+
+func writeManifest(path string, expected *manifest.Builder) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create manifest: %w", err)
+	}
+	if err := manifest.Write(file, expected.Entries()); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// generate sends messages until the profile's count is reached or ctx is
+// canceled. When paced, messages are spread out to match the profile's
+// rate. Every message sent is also applied to expected, if it is set.
+func generate(ctx context.Context, profile Profile, gen *generator, out sink, paced bool, expected *manifest.Builder) (generateStats, error) {
+	stats := generateStats{faults: map[string]int{}}
+	start := time.Now()
+	for ; profile.Count == 0 || stats.sent < profile.Count; stats.sent++ {
+		offset := time.Duration(float64(stats.sent) * float64(time.Second) / profile.Rate)
+		if paced {
+			if wait := time.Until(start.Add(offset)); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return stats, nil
+				case <-time.After(wait):
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			return stats, nil
 		}
 
-		_, err = topic.Publish(ctx, &pubsub.Message{Data: encoded}).Get(ctx)
+		scanned := time.Now()
+		if !profile.StartTime.IsZero() {
+			scanned = profile.StartTime.Add(offset)
+		}
+		data, fault, err := gen.message(scanned)
 		if err != nil {
-			panic(err)
+			return stats, err
+		}
+		if err := out.send(ctx, data); err != nil {
+			return stats, err
+		}
+
+		if fault != "" {
+			stats.faults[fault]++
+		}
+		if expected != nil {
+			// Faulty messages are meant to be rejected
+			_ = expected.Observe(data)
+		}
+	}
+	return stats, nil
+}
+
+// sink is where generated scans go
+type sink interface {
+	send(ctx context.Context, data []byte) error
+	// close waits for pending sends and reports any that failed
+	close() error
+}
+
+// topicSink publishes without waiting for each message to be acknowledged so
+// high rates are not limited by the round trip. The first failed publish is
+// returned by the next send.
+type topicSink struct {
+	topic   *pubsub.Topic
+	pending sync.WaitGroup
+	failed  chan error
+}
+
+func newTopicSink(topic *pubsub.Topic) *topicSink {
+	return &topicSink{topic: topic, failed: make(chan error, 1)}
+}
+
+// send publishes one scan in its own span, carrying the trace context in the
+// message attributes so the consumer continues the same trace
+func (s *topicSink) send(ctx context.Context, data []byte) error {
+	select {
+	case err := <-s.failed:
+		return err
+	default:
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "scanner.publish", trace.WithSpanKind(trace.SpanKindProducer))
+	attributes := make(map[string]string)
+	tracing.Inject(ctx, attributes)
+
+	result := s.topic.Publish(ctx, &pubsub.Message{Data: data, Attributes: attributes})
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		defer span.End()
+		// The scan is already handed to the client; let it finish after a shutdown signal
+		if _, err := result.Get(context.WithoutCancel(ctx)); err != nil {
+			span.RecordError(err)
+			select {
+			case s.failed <- fmt.Errorf("failed to publish scan: %w", err):
+			default:
+			}
 		}
+	}()
+	return nil
+}
+
+func (s *topicSink) close() error {
+	s.pending.Wait()
+	s.topic.Stop()
+	select {
+	case err := <-s.failed:
+		return err
+	default:
+		return nil
+	}
+}
+
+// fileSink writes one scan per line
+type fileSink struct {
+	file   io.WriteCloser
+	writer *bufio.Writer
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	if path == "-" {
+		return &fileSink{file: nopCloser{os.Stdout}, writer: bufio.NewWriter(os.Stdout)}, nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	return &fileSink{file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+func (s *fileSink) send(_ context.Context, data []byte) error {
+	if _, err := s.writer.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write scan: %w", err)
+	}
+	return nil
+}
+
+func (s *fileSink) close() error {
+	if err := s.writer.Flush(); err != nil {
+		s.file.Close()
+		return fmt.Errorf("failed to write scans: %w", err)
+	}
+	return s.file.Close()
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
 	}
+	return defaultValue
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/censys/scan-takehome/pkg/scanning"
+)
+
+func TestGenerate_PublishesAtRate(t *testing.T) {
+	server := pstest.NewServer()
+	defer server.Close()
+	t.Setenv("PUBSUB_EMULATOR_HOST", server.Addr)
+
+	ctx := context.Background()
+	client, err := pubsub.NewClient(ctx, "test")
+	require.NoError(t, err)
+	defer client.Close()
+	topic, err := client.CreateTopic(ctx, "scans")
+	require.NoError(t, err)
+
+	profile := defaultProfile()
+	profile.Rate = 100
+	profile.Count = 20
+	profile.Seed = 1
+	profile.StartTime = started
+	gen := newTestGenerator(t, profile)
+
+	start := time.Now()
+	out := newTopicSink(topic)
+	stats, err := generate(ctx, profile, gen, out, true, nil)
+	require.NoError(t, err)
+	require.NoError(t, out.close())
+	assert.Equal(t, 20, stats.sent)
+	assert.GreaterOrEqual(t, time.Since(start), 190*time.Millisecond, "20 scans at 100/s take 190ms")
+
+	messages := server.Messages()
+	require.Len(t, messages, 20)
+	var last scanning.Scan
+	require.NoError(t, json.Unmarshal(messages[19].Data, &last))
+	// Scans follow the simulated clock, which advanced 190ms
+	assert.Equal(t, started.Unix(), last.Timestamp)
+}
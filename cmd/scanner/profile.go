@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile describes the traffic the scanner generates. Weights are relative:
+// a service with weight 3 is picked three times as often as one with weight 1.
+type Profile struct {
+	// Rate is scans published per second
+	Rate float64 `yaml:"rate"`
+	// Count stops the scanner after that many scans; 0 runs until killed
+	Count int `yaml:"count"`
+	// Seed makes the generated scans reproducible; 0 picks one at random
+	Seed int64 `yaml:"seed"`
+	// StartTime, when set, replaces the wall clock: scan n is stamped
+	// StartTime + n/Rate, so a seeded run is reproduced exactly
+	StartTime time.Time `yaml:"start_time"`
+	// Networks maps CIDRs, IPv4 or IPv6, to their weight
+	Networks map[string]float64 `yaml:"networks"`
+	// Services maps a service name to how it is scanned
+	Services map[string]ServiceProfile `yaml:"services"`
+	// V1Ratio is the share of scans published in the V1 format
+	V1Ratio float64 `yaml:"v1_ratio"`
+	// ResponseSize pads or truncates responses to a length drawn from the range
+	ResponseSize SizeRange `yaml:"response_size"`
+	// Chaos publishes faulty messages among the generated scans
+	Chaos ChaosProfile `yaml:"chaos"`
+}
+
+type ServiceProfile struct {
+	Weight float64 `yaml:"weight"`
+	// Ports maps each port the service is found on to its weight
+	Ports map[uint32]float64 `yaml:"ports"`
+	// Banners replaces the built-in responses; one is picked at random. It is
+	// required for services without built-in responses.
+	Banners []string `yaml:"banners"`
+}
+
+// ChaosProfile sets the share of published messages that carry each fault.
+// The shares are exclusive, so they must add up to at most 1.
+type ChaosProfile struct {
+	// Duplicate republishes a recently sent message unchanged
+	Duplicate float64 `yaml:"duplicate"`
+	// Stale rescans a recently sent service with an older timestamp, up to
+	// MaxStaleness older, and a new response that must not replace it
+	Stale        float64       `yaml:"stale"`
+	MaxStaleness time.Duration `yaml:"max_staleness"`
+	// Future stamps a new scan up to MaxFutureSkew ahead of the clock
+	Future        float64       `yaml:"future"`
+	MaxFutureSkew time.Duration `yaml:"max_future_skew"`
+	// UnknownVersion uses a data_version the consumer has no decoder for
+	UnknownVersion float64 `yaml:"unknown_version"`
+	// TruncatedJSON cuts an encoded scan short
+	TruncatedJSON float64 `yaml:"truncated_json"`
+	// InvalidBase64 publishes a V1 scan whose response_bytes_utf8 is not base64
+	InvalidBase64 float64 `yaml:"invalid_base64"`
+}
+
+// SizeRange bounds the response length in bytes; a zero Max leaves responses
+// as generated
+type SizeRange struct {
+	Min int `yaml:"min"`
+	Max int `yaml:"max"`
+}
+
+func defaultProfile() Profile {
+	return Profile{
+		Rate:     1,
+		Networks: map[string]float64{"1.1.1.0/24": 1},
+		Services: map[string]ServiceProfile{
+			"HTTP": {Weight: 1, Ports: map[uint32]float64{80: 6, 443: 3, 8080: 1}},
+			"SSH":  {Weight: 1, Ports: map[uint32]float64{22: 9, 2222: 1}},
+			"DNS":  {Weight: 1, Ports: map[uint32]float64{53: 1}},
+		},
+		V1Ratio: 0.5,
+		Chaos:   ChaosProfile{MaxStaleness: 24 * time.Hour, MaxFutureSkew: 24 * time.Hour},
+	}
+}
+
+// loadProfile overlays the profile file at path onto the defaults. Networks
+// and services given in the file replace the default ones rather than being
+// merged into them.
+func loadProfile(path string) (Profile, error) {
+	profile := defaultProfile()
+	if path == "" {
+		return profile, nil
+	}
+	defaults := profile
+	profile.Networks, profile.Services = nil, nil
+
+	file, err := os.Open(path)
+	if err != nil {
+		return defaults, fmt.Errorf("failed to open profile: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&profile); err != nil && !errors.Is(err, io.EOF) {
+		return defaults, fmt.Errorf("failed to parse profile %s: %w", path, err)
+	}
+
+	if profile.Networks == nil {
+		profile.Networks = defaults.Networks
+	}
+	if profile.Services == nil {
+		profile.Services = defaults.Services
+	}
+	return profile, nil
+}
+
+// Validate reports every problem with the profile at once
+func (p *Profile) Validate() error {
+	var errs []error
+	invalid := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if p.Rate <= 0 {
+		invalid("rate", "must be positive")
+	}
+	if p.Count < 0 {
+		invalid("count", "must not be negative")
+	}
+
+	if len(p.Networks) == 0 {
+		invalid("networks", "must list at least one CIDR")
+	}
+	for cidr, weight := range p.Networks {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			invalid("networks", "%q is not a CIDR: %v", cidr, err)
+		}
+		if weight <= 0 {
+			invalid("networks."+cidr, "weight must be positive")
+		}
+	}
+
+	if len(p.Services) == 0 {
+		invalid("services", "must list at least one service")
+	}
+	for name, service := range p.Services {
+		field := "services." + name
+		if service.Weight <= 0 {
+			invalid(field+".weight", "must be positive")
+		}
+		if len(service.Ports) == 0 {
+			invalid(field+".ports", "must list at least one port")
+		}
+		for port, weight := range service.Ports {
+			if port < 1 || port > 65535 {
+				invalid(field+".ports", "%d is not between 1 and 65535", port)
+			}
+			if weight <= 0 {
+				invalid(fmt.Sprintf("%s.ports.%d", field, port), "weight must be positive")
+			}
+		}
+		if len(service.Banners) == 0 && builtinBanners[name] == nil {
+			invalid(field+".banners", "are required for services without built-in responses (%s)", builtinServices())
+		}
+	}
+
+	if p.V1Ratio < 0 || p.V1Ratio > 1 {
+		invalid("v1_ratio", "must be between 0 and 1, got %v", p.V1Ratio)
+	}
+	if p.ResponseSize.Min < 0 {
+		invalid("response_size.min", "must not be negative")
+	}
+	if p.ResponseSize.Max != 0 && p.ResponseSize.Max < p.ResponseSize.Min {
+		invalid("response_size.max", "must be at least response_size.min")
+	}
+
+	p.Chaos.validate(invalid)
+
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return errors.Join(errs...)
+}
+
+// validate reports problems through invalid, which Profile.Validate supplies
+func (c *ChaosProfile) validate(invalid func(field, format string, args ...any)) {
+	total := 0.0
+	for _, fault := range c.faults() {
+		if *fault.share < 0 || *fault.share > 1 {
+			invalid("chaos."+fault.name, "must be between 0 and 1, got %v", *fault.share)
+		}
+		total += *fault.share
+	}
+	if total > 1 {
+		invalid("chaos", "shares add up to %.3g, more than 1", total)
+	}
+	if c.Stale > 0 && c.MaxStaleness < time.Second {
+		invalid("chaos.max_staleness", "must be at least 1s")
+	}
+	if c.Future > 0 && c.MaxFutureSkew < time.Second {
+		invalid("chaos.max_future_skew", "must be at least 1s")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultProfileIsValid(t *testing.T) {
+	profile := defaultProfile()
+	assert.NoError(t, profile.Validate())
+}
+
+func TestLoadProfileReplacesMaps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profile.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+rate: 250
+start_time: 2024-03-01T12:00:00Z
+services:
+  SSH:
+    weight: 1
+    ports: {22: 1}
+`), 0o600))
+
+	profile, err := loadProfile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 250.0, profile.Rate)
+	assert.Equal(t, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), profile.StartTime)
+	assert.Equal(t, map[string]ServiceProfile{"SSH": {Weight: 1, Ports: map[uint32]float64{22: 1}}}, profile.Services)
+	// Settings missing from the file keep their defaults
+	assert.Equal(t, defaultProfile().Networks, profile.Networks)
+	assert.Equal(t, 0.5, profile.V1Ratio)
+}
+
+func TestLoadProfileRejectsUnknownFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profile.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("rates: 5\n"), 0o600))
+
+	_, err := loadProfile(path)
+	assert.ErrorContains(t, err, "field rates not found")
+}
+
+func TestProfileFlagsOverrideProfile(t *testing.T) {
+	fs := flag.NewFlagSet("scanner", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	apply := profileFlags(fs)
+	require.NoError(t, fs.Parse([]string{"-rate", "20", "-networks", "10.0.0.0/8, 2001:db8::/32", "-seed", "9"}))
+
+	profile := defaultProfile()
+	profile.V1Ratio = 0.1
+	require.NoError(t, apply(&profile))
+
+	assert.Equal(t, 20.0, profile.Rate)
+	assert.Equal(t, int64(9), profile.Seed)
+	assert.Equal(t, map[string]float64{"10.0.0.0/8": 1, "2001:db8::/32": 1}, profile.Networks)
+	assert.Equal(t, 0.1, profile.V1Ratio, "flags that are not given leave the profile alone")
+}
+
+func TestProfileValidateReportsEverySetting(t *testing.T) {
+	profile := defaultProfile()
+	profile.Rate = 0
+	profile.Networks = map[string]float64{"1.1.1.1": 1}
+	profile.Services["FTP"] = ServiceProfile{Weight: 1, Ports: map[uint32]float64{70000: 1}}
+	profile.ResponseSize = SizeRange{Min: 10, Max: 5}
+
+	err := profile.Validate()
+	require.Error(t, err)
+	assert.Equal(t, `networks: "1.1.1.1" is not a CIDR: netip.ParsePrefix("1.1.1.1"): no '/'
+rate: must be positive
+response_size.max: must be at least response_size.min
+services.FTP.banners: are required for services without built-in responses (DNS, HTTP, SSH)
+services.FTP.ports: 70000 is not between 1 and 65535`, err.Error())
+}
+
+func TestProfileValidateChaos(t *testing.T) {
+	profile := defaultProfile()
+	profile.Chaos = ChaosProfile{Duplicate: 0.6, Stale: 0.6, Future: -0.1, MaxFutureSkew: time.Millisecond}
+
+	err := profile.Validate()
+	require.Error(t, err)
+	assert.Equal(t, `chaos.future: must be between 0 and 1, got -0.1
+chaos.max_staleness: must be at least 1s
+chaos: shares add up to 1.1, more than 1`, err.Error())
+}
+
+func TestProfileFlagsSetChaos(t *testing.T) {
+	fs := flag.NewFlagSet("scanner", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	apply := profileFlags(fs)
+	require.NoError(t, fs.Parse([]string{"-chaos-truncated-json", "0.2", "-chaos-stale", "0.1"}))
+
+	profile := defaultProfile()
+	require.NoError(t, apply(&profile))
+	assert.Equal(t, 0.2, profile.Chaos.TruncatedJSON)
+	assert.Equal(t, 0.1, profile.Chaos.Stale)
+	assert.Equal(t, 24*time.Hour, profile.Chaos.MaxStaleness)
+}
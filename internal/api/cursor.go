@@ -0,0 +1,37 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor turns the key of the last record on a page into an opaque token
+func encodeCursor(key domain.ServiceKey) string {
+	data, _ := json.Marshal(cursor{IP: key.IP, Port: key.Port, Service: key.Service})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (*domain.ServiceKey, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.IP == "" {
+		return nil, errInvalidCursor
+	}
+
+	return &domain.ServiceKey{IP: c.IP, Port: c.Port, Service: c.Service}, nil
+}
+
+type cursor struct {
+	IP      string `json:"ip"`
+	Port    uint32 `json:"port"`
+	Service string `json:"service"`
+}
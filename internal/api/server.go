@@ -0,0 +1,299 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+//go:generate mockgen -source=server.go -destination=../mocks/mock_scan_reader.go -package=mocks
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// ScanReader is the read side of the scan store used by the API
+type ScanReader interface {
+	GetLatestScan(ctx context.Context, ip string, port uint32, service string) (*domain.ServiceScan, error)
+	ListScans(ctx context.Context, filter domain.ScanFilter) ([]domain.ServiceScan, error)
+	GetScanHistory(ctx context.Context, ip string, port uint32, service string) ([]domain.ScanHistoryEntry, error)
+}
+
+type Server struct {
+	reader ScanReader
+	mux    *http.ServeMux
+}
+
+func NewServer(reader ScanReader) *Server {
+	s := &Server{
+		reader: reader,
+		mux:    http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/v1/scans", s.handleListScans)
+	s.mux.HandleFunc("/v1/scans/", s.handleScan)
+	s.mux.HandleFunc("/v1/ips/", s.handleIPScans)
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListScansResponse is a page of records. NextCursor is empty on the last page.
+type ListScansResponse struct {
+	Scans      []domain.ServiceScan `json:"scans"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+// ScanHistoryResponse is the response timeline of one service
+type ScanHistoryResponse struct {
+	History []domain.ScanHistoryEntry `json:"history"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// handleListScans serves GET /v1/scans?ip=&port=&service=&scanned_after=&scanned_before=&limit=&cursor=
+func (s *Server) handleListScans(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.listScans(w, r, filter)
+}
+
+// handleIPScans serves GET /v1/ips/{ip}/scans, accepting the same query parameters as /v1/scans
+func (s *Server) handleIPScans(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	parts := splitPath(r.URL.Path, "/v1/ips/")
+	if len(parts) != 2 || parts[1] != "scans" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	filter.IP = domain.CanonicalIP(parts[0])
+
+	s.listScans(w, r, filter)
+}
+
+// handleScan serves GET /v1/scans/{ip}/{port}/{service} and .../history
+func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	parts := splitPath(r.URL.Path, "/v1/scans/")
+	if len(parts) != 3 && !(len(parts) == 4 && parts[3] == "history") {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	ip, service := domain.CanonicalIP(parts[0]), parts[2]
+	port, err := parsePort(parts[1])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(parts) == 4 {
+		history, err := s.reader.GetScanHistory(r.Context(), ip, port, service)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		if history == nil {
+			history = []domain.ScanHistoryEntry{}
+		}
+		writeJSON(w, http.StatusOK, ScanHistoryResponse{History: history})
+		return
+	}
+
+	scan, err := s.reader.GetLatestScan(r.Context(), ip, port, service)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if scan == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no scan for %s:%d/%s", ip, port, service))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, scan)
+}
+
+func (s *Server) listScans(w http.ResponseWriter, r *http.Request, filter domain.ScanFilter) {
+	pageSize := filter.Limit
+	// Fetch one extra record to learn whether another page exists
+	filter.Limit = pageSize + 1
+
+	scans, err := s.reader.ListScans(r.Context(), filter)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	response := ListScansResponse{Scans: scans}
+	if len(scans) > pageSize {
+		response.Scans = scans[:pageSize]
+		last := response.Scans[pageSize-1]
+		response.NextCursor = encodeCursor(last.Key())
+	}
+	if response.Scans == nil {
+		response.Scans = []domain.ServiceScan{}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func parseFilter(r *http.Request) (domain.ScanFilter, error) {
+	query := r.URL.Query()
+	filter := domain.ScanFilter{
+		IP:      domain.CanonicalIP(query.Get("ip")),
+		Service: query.Get("service"),
+		Limit:   defaultPageSize,
+	}
+
+	if value := query.Get("port"); value != "" {
+		port, err := parsePort(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.Port = port
+	}
+
+	if err := parseAddressFilter(query, &filter); err != nil {
+		return filter, err
+	}
+
+	for name, target := range map[string]*time.Time{
+		"scanned_after":  &filter.ScannedAfter,
+		"scanned_before": &filter.ScannedBefore,
+	} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+			}
+			*target = parsed
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		filter.Limit = limit
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		after, err := decodeCursor(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.After = after
+	}
+
+	return filter, nil
+}
+
+// parseAddressFilter reads the cidr, ip_from, ip_to and family parameters
+func parseAddressFilter(query url.Values, filter *domain.ScanFilter) error {
+	if value := query.Get("cidr"); value != "" {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return fmt.Errorf("cidr %q must be a CIDR block such as 10.0.0.0/8", value)
+		}
+		filter.Network = prefix
+	}
+
+	for name, target := range map[string]*netip.Addr{
+		"ip_from": &filter.RangeStart,
+		"ip_to":   &filter.RangeEnd,
+	} {
+		if value := query.Get(name); value != "" {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return fmt.Errorf("%s %q must be an IP address", name, value)
+			}
+			*target = addr.Unmap()
+		}
+	}
+
+	switch query.Get("family") {
+	case "":
+	case "4", "ipv4":
+		filter.Family = domain.IPv4
+	case "6", "ipv6":
+		filter.Family = domain.IPv6
+	default:
+		return fmt.Errorf("family must be 4 or 6")
+	}
+
+	return filter.Validate()
+}
+
+func parsePort(value string) (uint32, error) {
+	port, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || port == 0 || port > 65535 {
+		return 0, fmt.Errorf("port %q must be between 1 and 65535", value)
+	}
+	return uint32(port), nil
+}
+
+func splitPath(path, prefix string) []string {
+	return strings.Split(strings.Trim(strings.TrimPrefix(path, prefix), "/"), "/")
+}
+
+func allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return false
+	}
+	return true
+}
+
+func writeInternalError(w http.ResponseWriter, err error) {
+	slog.Error("API request failed", "error", err)
+	writeError(w, http.StatusInternalServerError, errors.New("internal error"))
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("Failed to write response", "error", err)
+	}
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/mocks"
+)
+
+func serve(server *Server, method, target string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+	return recorder
+}
+
+func TestServer_GetScan_Found(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReader := mocks.NewMockScanReader(ctrl)
+	server := NewServer(mockReader)
+
+	scan := &domain.ServiceScan{
+		IP:          "1.1.1.1",
+		Port:        22,
+		Service:     "SSH",
+		Response:    "SSH-2.0-OpenSSH_8.2",
+		LastScanned: time.Unix(1640995200, 0).UTC(),
+	}
+
+	mockReader.EXPECT().
+		GetLatestScan(gomock.Any(), "1.1.1.1", uint32(22), "SSH").
+		Return(scan, nil)
+
+	resp := serve(server, http.MethodGet, "/v1/scans/1.1.1.1/22/SSH")
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var body domain.ServiceScan
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, *scan, body)
+}
+
+func TestServer_GetScan_NotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReader := mocks.NewMockScanReader(ctrl)
+	server := NewServer(mockReader)
+
+	mockReader.EXPECT().
+		GetLatestScan(gomock.Any(), "1.1.1.1", uint32(22), "SSH").
+		Return(nil, nil)
+
+	resp := serve(server, http.MethodGet, "/v1/scans/1.1.1.1/22/SSH")
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestServer_GetScan_InvalidPort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	server := NewServer(mocks.NewMockScanReader(ctrl))
+
+	resp := serve(server, http.MethodGet, "/v1/scans/1.1.1.1/99999/SSH")
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestServer_GetScanHistory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReader := mocks.NewMockScanReader(ctrl)
+	server := NewServer(mockReader)
+
+	history := []domain.ScanHistoryEntry{
+		{IP: "1.1.1.1", Port: 22, Service: "SSH", Response: "SSH-2.0-OpenSSH_8.2", ResponseHash: "a"},
+		{IP: "1.1.1.1", Port: 22, Service: "SSH", Response: "SSH-2.0-OpenSSH_9.0", ResponseHash: "b", PreviousResponseHash: "a"},
+	}
+
+	mockReader.EXPECT().
+		GetScanHistory(gomock.Any(), "1.1.1.1", uint32(22), "SSH").
+		Return(history, nil)
+
+	resp := serve(server, http.MethodGet, "/v1/scans/1.1.1.1/22/SSH/history")
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var body ScanHistoryResponse
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Len(t, body.History, 2)
+	assert.Equal(t, "a", body.History[1].PreviousResponseHash)
+}
+
+func TestServer_ListScans_AppliesFiltersAndPaginates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReader := mocks.NewMockScanReader(ctrl)
+	server := NewServer(mockReader)
+
+	after := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	scans := []domain.ServiceScan{
+		{IP: "1.1.1.1", Port: 80, Service: "HTTP"},
+		{IP: "1.1.1.2", Port: 80, Service: "HTTP"},
+		{IP: "1.1.1.3", Port: 80, Service: "HTTP"},
+	}
+
+	mockReader.EXPECT().
+		ListScans(gomock.Any(), domain.ScanFilter{
+			Port:         80,
+			Service:      "HTTP",
+			ScannedAfter: after,
+			Limit:        3,
+		}).
+		Return(scans, nil)
+
+	resp := serve(server, http.MethodGet, "/v1/scans?port=80&service=HTTP&scanned_after=2022-01-01T00:00:00Z&limit=2")
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var body ListScansResponse
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, scans[:2], body.Scans)
+	require.NotEmpty(t, body.NextCursor)
+
+	key, err := decodeCursor(body.NextCursor)
+	require.NoError(t, err)
+	assert.Equal(t, scans[1].Key(), *key)
+}
+
+func TestServer_ListScans_AddressFilters(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReader := mocks.NewMockScanReader(ctrl)
+	server := NewServer(mockReader)
+
+	mockReader.EXPECT().
+		ListScans(gomock.Any(), domain.ScanFilter{
+			Network:    netip.MustParsePrefix("10.0.0.0/8"),
+			RangeStart: netip.MustParseAddr("10.0.0.1"),
+			RangeEnd:   netip.MustParseAddr("10.0.0.254"),
+			Family:     domain.IPv4,
+			Limit:      defaultPageSize + 1,
+		}).
+		Return(nil, nil)
+
+	resp := serve(server, http.MethodGet, "/v1/scans?cidr=10.0.0.0/8&ip_from=10.0.0.1&ip_to=10.0.0.254&family=4")
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestServer_ListScans_FollowsCursor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReader := mocks.NewMockScanReader(ctrl)
+	server := NewServer(mockReader)
+
+	key := domain.ServiceKey{IP: "1.1.1.2", Port: 80, Service: "HTTP"}
+
+	mockReader.EXPECT().
+		ListScans(gomock.Any(), domain.ScanFilter{After: &key, Limit: defaultPageSize + 1}).
+		Return(nil, nil)
+
+	resp := serve(server, http.MethodGet, "/v1/scans?cursor="+encodeCursor(key))
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"scans": []}`, resp.Body.String())
+}
+
+func TestServer_ListScans_RejectsInvalidParameters(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	server := NewServer(mocks.NewMockScanReader(ctrl))
+
+	for _, target := range []string{
+		"/v1/scans?port=abc",
+		"/v1/scans?limit=0",
+		"/v1/scans?limit=5000",
+		"/v1/scans?scanned_before=yesterday",
+		"/v1/scans?cursor=not-a-cursor",
+		"/v1/scans?cidr=10.0.0.0",
+		"/v1/scans?ip_from=10.0.0.1",
+		"/v1/scans?ip_from=10.0.0.9&ip_to=10.0.0.1",
+		"/v1/scans?ip_from=10.0.0.1&ip_to=2001:db8::1",
+		"/v1/scans?family=5",
+	} {
+		resp := serve(server, http.MethodGet, target)
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code, target)
+	}
+}
+
+func TestServer_ListIPScans(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReader := mocks.NewMockScanReader(ctrl)
+	server := NewServer(mockReader)
+
+	scans := []domain.ServiceScan{
+		{IP: "1.1.1.1", Port: 22, Service: "SSH"},
+		{IP: "1.1.1.1", Port: 80, Service: "HTTP"},
+	}
+
+	mockReader.EXPECT().
+		ListScans(gomock.Any(), domain.ScanFilter{IP: "1.1.1.1", Limit: defaultPageSize + 1}).
+		Return(scans, nil)
+
+	resp := serve(server, http.MethodGet, "/v1/ips/1.1.1.1/scans")
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var body ListScansResponse
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, scans, body.Scans)
+	assert.Empty(t, body.NextCursor)
+}
+
+func TestServer_RejectsNonGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	server := NewServer(mocks.NewMockScanReader(ctrl))
+
+	resp := serve(server, http.MethodPost, "/v1/scans")
+
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+}
@@ -0,0 +1,150 @@
+// Package cache keeps the latest scan of recently seen services close to the
+// consumer, so stale redeliveries are answered without a database round trip
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/logging"
+	"github.com/censys/scan-takehome/internal/metrics"
+)
+
+//go:generate mockgen -source=cache.go -destination=../mocks/mock_cache.go -package=mocks
+
+// Store holds the latest known scan per service. Entries may disappear at any
+// time, and a store may lag behind the database but never run ahead of it.
+type Store interface {
+	// Get returns nil without an error when the key is not cached
+	Get(ctx context.Context, key domain.ServiceKey) (*domain.ServiceScan, error)
+	Set(ctx context.Context, scan *domain.ServiceScan) error
+	Delete(ctx context.Context, keys ...domain.ServiceKey) error
+}
+
+// Backend is the repository the cache sits in front of
+type Backend interface {
+	GetLatestScan(ctx context.Context, ip string, port uint32, service string) (*domain.ServiceScan, error)
+	UpsertScan(ctx context.Context, scan *domain.ServiceScan) (domain.UpsertOutcome, error)
+	UpsertScans(ctx context.Context, scans []*domain.ServiceScan) ([]domain.UpsertOutcome, error)
+}
+
+// Repository is a read-through cache around a Backend. A scan no newer than
+// the cached record is reported stale without reaching the database. That is
+// safe because records only move forward, so a cached record is never newer
+// than the stored one. Cache errors are logged and treated as misses.
+type Repository struct {
+	backend Backend
+	store   Store
+}
+
+func NewRepository(backend Backend, store Store) *Repository {
+	return &Repository{
+		backend: backend,
+		store:   store,
+	}
+}
+
+// GetLatestScan serves the record from the cache, loading it from the backend
+// on a miss
+func (r *Repository) GetLatestScan(ctx context.Context, ip string, port uint32, service string) (*domain.ServiceScan, error) {
+	key := domain.ServiceKey{IP: ip, Port: port, Service: service}
+	if cached := r.lookup(ctx, key); cached != nil {
+		return cached, nil
+	}
+
+	scan, err := r.backend.GetLatestScan(ctx, ip, port, service)
+	if err != nil || scan == nil {
+		return scan, err
+	}
+	r.set(ctx, scan)
+	return scan, nil
+}
+
+// UpsertScan writes the scan unless the cache already holds a record at least
+// as new
+func (r *Repository) UpsertScan(ctx context.Context, scan *domain.ServiceScan) (domain.UpsertOutcome, error) {
+	outcomes, err := r.UpsertScans(ctx, []*domain.ServiceScan{scan})
+	if err != nil {
+		return 0, err
+	}
+
+	return outcomes[0], nil
+}
+
+// UpsertScans answers the scans the cache knows to be stale and writes the
+// rest in one backend call. Written records replace their cache entries; an
+// entry the database found stale is dropped, as it was behind.
+func (r *Repository) UpsertScans(ctx context.Context, scans []*domain.ServiceScan) ([]domain.UpsertOutcome, error) {
+	if len(scans) == 0 {
+		return nil, nil
+	}
+
+	outcomes := make([]domain.UpsertOutcome, len(scans))
+	var pending []*domain.ServiceScan
+	var pendingIndex []int
+	for i, scan := range scans {
+		if cached := r.lookup(ctx, scan.Key()); cached != nil && !cached.LastScanned.Before(roundTime(scan.LastScanned)) {
+			outcomes[i] = domain.OutcomeStale
+			metrics.CacheSkippedWrites.Inc()
+			continue
+		}
+		pending = append(pending, scan)
+		pendingIndex = append(pendingIndex, i)
+	}
+	if len(pending) == 0 {
+		return outcomes, nil
+	}
+
+	written, err := r.backend.UpsertScans(ctx, pending)
+	if err != nil {
+		return nil, err
+	}
+
+	var behind []domain.ServiceKey
+	for j, outcome := range written {
+		outcomes[pendingIndex[j]] = outcome
+		if outcome == domain.OutcomeStale {
+			behind = append(behind, pending[j].Key())
+			continue
+		}
+		r.set(ctx, pending[j])
+	}
+	if len(behind) > 0 {
+		if err := r.store.Delete(ctx, behind...); err != nil {
+			logging.FromContext(ctx).Warn("Failed to invalidate cached scans", "error", err)
+		}
+	}
+
+	return outcomes, nil
+}
+
+func (r *Repository) lookup(ctx context.Context, key domain.ServiceKey) *domain.ServiceScan {
+	scan, err := r.store.Get(ctx, key)
+	switch {
+	case err != nil:
+		metrics.CacheLookups.WithLabelValues(metrics.CacheError).Inc()
+		logging.FromContext(ctx).Warn("Failed to read scan cache", "error", err)
+		return nil
+	case scan == nil:
+		metrics.CacheLookups.WithLabelValues(metrics.CacheMiss).Inc()
+	default:
+		metrics.CacheLookups.WithLabelValues(metrics.CacheHit).Inc()
+	}
+	return scan
+}
+
+func (r *Repository) set(ctx context.Context, scan *domain.ServiceScan) {
+	cached := *scan
+	cached.LastScanned = roundTime(scan.LastScanned)
+	if err := r.store.Set(ctx, &cached); err != nil {
+		logging.FromContext(ctx).Warn("Failed to update scan cache", "error", err)
+	}
+}
+
+// roundTime matches the microsecond precision of the stores, so a scan that
+// only differs from the cached record below it is stale here as it would be
+// in the database
+func roundTime(t time.Time) time.Time {
+	return t.Round(time.Microsecond)
+}
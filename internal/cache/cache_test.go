@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/mocks"
+)
+
+var scanned = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func scanAt(ip, response string, offset time.Duration) *domain.ServiceScan {
+	return &domain.ServiceScan{IP: ip, Port: 80, Service: "HTTP", Response: response, LastScanned: scanned.Add(offset)}
+}
+
+func cached(t *testing.T, store Store, scan *domain.ServiceScan) *domain.ServiceScan {
+	t.Helper()
+	got, err := store.Get(context.Background(), scan.Key())
+	require.NoError(t, err)
+	return got
+}
+
+func TestRepository_StaleScanSkipsDatabase(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockBackend(ctrl)
+	store := NewLRU(10, time.Minute)
+	require.NoError(t, store.Set(context.Background(), scanAt("10.0.0.1", "current", time.Minute)))
+	repo := NewRepository(backend, store)
+
+	// No backend call is expected for either scan
+	for _, scan := range []*domain.ServiceScan{
+		scanAt("10.0.0.1", "older", 0),
+		scanAt("10.0.0.1", "same time", time.Minute+400*time.Nanosecond),
+	} {
+		outcome, err := repo.UpsertScan(context.Background(), scan)
+		require.NoError(t, err)
+		assert.Equal(t, domain.OutcomeStale, outcome)
+	}
+}
+
+func TestRepository_WrittenScansAreCached(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockBackend(ctrl)
+	store := NewLRU(10, time.Minute)
+	repo := NewRepository(backend, store)
+
+	newer := scanAt("10.0.0.1", "new", time.Minute)
+	backend.EXPECT().UpsertScans(gomock.Any(), []*domain.ServiceScan{newer}).Return([]domain.UpsertOutcome{domain.OutcomeUpdated}, nil)
+
+	outcome, err := repo.UpsertScan(context.Background(), newer)
+	require.NoError(t, err)
+	assert.Equal(t, domain.OutcomeUpdated, outcome)
+	assert.Equal(t, newer, cached(t, store, newer))
+
+	// A redelivery of the same scan is now answered from the cache
+	outcome, err = repo.UpsertScan(context.Background(), newer)
+	require.NoError(t, err)
+	assert.Equal(t, domain.OutcomeStale, outcome)
+}
+
+func TestRepository_BatchKeepsInputOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockBackend(ctrl)
+	store := NewLRU(10, time.Minute)
+	require.NoError(t, store.Set(context.Background(), scanAt("10.0.0.2", "cached", time.Hour)))
+	require.NoError(t, store.Set(context.Background(), scanAt("10.0.0.3", "behind", 0)))
+	repo := NewRepository(backend, store)
+
+	inserted := scanAt("10.0.0.1", "a", time.Minute)
+	skipped := scanAt("10.0.0.2", "b", time.Minute)
+	raced := scanAt("10.0.0.3", "c", time.Minute)
+	backend.EXPECT().UpsertScans(gomock.Any(), []*domain.ServiceScan{inserted, raced}).
+		Return([]domain.UpsertOutcome{domain.OutcomeInserted, domain.OutcomeStale}, nil)
+
+	outcomes, err := repo.UpsertScans(context.Background(), []*domain.ServiceScan{inserted, skipped, raced})
+	require.NoError(t, err)
+	assert.Equal(t, []domain.UpsertOutcome{domain.OutcomeInserted, domain.OutcomeStale, domain.OutcomeStale}, outcomes)
+
+	assert.Equal(t, inserted, cached(t, store, inserted))
+	// Another writer got ahead of the cached record, so it is dropped
+	assert.Nil(t, cached(t, store, raced))
+}
+
+func TestRepository_BackendErrorLeavesCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockBackend(ctrl)
+	store := NewLRU(10, time.Minute)
+	repo := NewRepository(backend, store)
+
+	scan := scanAt("10.0.0.1", "new", 0)
+	backend.EXPECT().UpsertScans(gomock.Any(), gomock.Any()).Return(nil, domain.ErrStoreUnavailable)
+
+	_, err := repo.UpsertScan(context.Background(), scan)
+	assert.ErrorIs(t, err, domain.ErrStoreUnavailable)
+	assert.Nil(t, cached(t, store, scan))
+}
+
+func TestRepository_GetLatestScanReadsThrough(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockBackend(ctrl)
+	repo := NewRepository(backend, NewLRU(10, time.Minute))
+
+	stored := scanAt("10.0.0.1", "stored", 0)
+	backend.EXPECT().GetLatestScan(gomock.Any(), "10.0.0.1", uint32(80), "HTTP").Return(stored, nil).Times(1)
+	backend.EXPECT().GetLatestScan(gomock.Any(), "10.0.0.2", uint32(80), "HTTP").Return(nil, nil).Times(2)
+
+	for i := 0; i < 2; i++ {
+		scan, err := repo.GetLatestScan(context.Background(), "10.0.0.1", 80, "HTTP")
+		require.NoError(t, err)
+		assert.Equal(t, stored, scan)
+
+		// Missing records are not cached
+		scan, err = repo.GetLatestScan(context.Background(), "10.0.0.2", 80, "HTTP")
+		require.NoError(t, err)
+		assert.Nil(t, scan)
+	}
+}
+
+func TestRepository_StoreErrorsFailOpen(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	backend := mocks.NewMockBackend(ctrl)
+	store := mocks.NewMockStore(ctrl)
+	repo := NewRepository(backend, store)
+
+	scan := scanAt("10.0.0.1", "new", 0)
+	storeErr := errors.New("connection refused")
+	store.EXPECT().Get(gomock.Any(), scan.Key()).Return(nil, storeErr)
+	store.EXPECT().Set(gomock.Any(), scan).Return(storeErr)
+	backend.EXPECT().UpsertScans(gomock.Any(), []*domain.ServiceScan{scan}).Return([]domain.UpsertOutcome{domain.OutcomeInserted}, nil)
+
+	outcome, err := repo.UpsertScan(context.Background(), scan)
+	require.NoError(t, err)
+	assert.Equal(t, domain.OutcomeInserted, outcome)
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+// LRU is an in-process Store that holds at most size entries and drops
+// entries older than ttl. The least recently used entry is evicted first.
+type LRU struct {
+	size int
+	// ttl of 0 keeps entries until they are evicted
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[domain.ServiceKey]*list.Element
+	// order holds *lruEntry values, most recently used at the front
+	order *list.List
+}
+
+type lruEntry struct {
+	scan    domain.ServiceScan
+	expires time.Time
+}
+
+func NewLRU(size int, ttl time.Duration) *LRU {
+	if size < 1 {
+		size = 1
+	}
+	return &LRU{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[domain.ServiceKey]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *LRU) Get(ctx context.Context, key domain.ServiceKey) (*domain.ServiceScan, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	entry := element.Value.(*lruEntry)
+	if c.ttl > 0 && !c.now().Before(entry.expires) {
+		c.remove(element)
+		return nil, nil
+	}
+	c.order.MoveToFront(element)
+
+	scan := entry.scan
+	return &scan, nil
+}
+
+func (c *LRU) Set(ctx context.Context, scan *domain.ServiceScan) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &lruEntry{scan: *scan, expires: c.now().Add(c.ttl)}
+	if element, ok := c.entries[scan.Key()]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return nil
+	}
+
+	c.entries[scan.Key()] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+func (c *LRU) Delete(ctx context.Context, keys ...domain.ServiceKey) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if element, ok := c.entries[key]; ok {
+			c.remove(element)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not yet dropped
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRU) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*lruEntry).scan.Key())
+}
@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	lru := NewLRU(2, 0)
+	a, b, c := scanAt("10.0.0.1", "a", 0), scanAt("10.0.0.2", "b", 0), scanAt("10.0.0.3", "c", 0)
+
+	require.NoError(t, lru.Set(ctx, a))
+	require.NoError(t, lru.Set(ctx, b))
+	// Reading a makes b the least recently used
+	assert.NotNil(t, cached(t, lru, a))
+	require.NoError(t, lru.Set(ctx, c))
+
+	assert.Equal(t, 2, lru.Len())
+	assert.Equal(t, a, cached(t, lru, a))
+	assert.Nil(t, cached(t, lru, b))
+	assert.Equal(t, c, cached(t, lru, c))
+}
+
+func TestLRU_SetReplacesEntry(t *testing.T) {
+	ctx := context.Background()
+	lru := NewLRU(2, 0)
+
+	require.NoError(t, lru.Set(ctx, scanAt("10.0.0.1", "old", 0)))
+	newer := scanAt("10.0.0.1", "new", time.Minute)
+	require.NoError(t, lru.Set(ctx, newer))
+
+	assert.Equal(t, 1, lru.Len())
+	assert.Equal(t, newer, cached(t, lru, newer))
+}
+
+func TestLRU_ExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	now := scanned
+	lru := NewLRU(10, time.Minute)
+	lru.now = func() time.Time { return now }
+
+	scan := scanAt("10.0.0.1", "a", 0)
+	require.NoError(t, lru.Set(ctx, scan))
+
+	now = now.Add(59 * time.Second)
+	assert.NotNil(t, cached(t, lru, scan))
+
+	now = now.Add(time.Second)
+	assert.Nil(t, cached(t, lru, scan))
+	assert.Zero(t, lru.Len(), "expired entries are dropped when read")
+}
+
+func TestLRU_Delete(t *testing.T) {
+	ctx := context.Background()
+	lru := NewLRU(10, 0)
+	a, b := scanAt("10.0.0.1", "a", 0), scanAt("10.0.0.2", "b", 0)
+	require.NoError(t, lru.Set(ctx, a))
+	require.NoError(t, lru.Set(ctx, b))
+
+	require.NoError(t, lru.Delete(ctx, a.Key(), scanAt("10.0.0.9", "missing", 0).Key()))
+
+	assert.Nil(t, cached(t, lru, a))
+	assert.Equal(t, b, cached(t, lru, b))
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+// keyPrefix namespaces cache entries in a shared Redis
+const keyPrefix = "scan-takehome:latest:"
+
+// Redis is a Store on any server that speaks the Redis protocol, so several
+// consumers share one cache. Entries are JSON and expire after ttl.
+type Redis struct {
+	client redis.UniversalClient
+	// ttl of 0 keeps entries until Redis evicts them
+	ttl time.Duration
+}
+
+func NewRedis(client redis.UniversalClient, ttl time.Duration) *Redis {
+	return &Redis{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+func redisKey(key domain.ServiceKey) string {
+	// Neither addresses nor ports contain a slash, so keys cannot collide
+	return fmt.Sprintf("%s%s/%d/%s", keyPrefix, key.IP, key.Port, key.Service)
+}
+
+func (c *Redis) Get(ctx context.Context, key domain.ServiceKey) (*domain.ServiceScan, error) {
+	data, err := c.client.Get(ctx, redisKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached scan: %w", err)
+	}
+
+	var scan domain.ServiceScan
+	if err := json.Unmarshal(data, &scan); err != nil {
+		return nil, fmt.Errorf("failed to decode cached scan: %w", err)
+	}
+	return &scan, nil
+}
+
+// Set overwrites the entry. Consumers racing on one key may leave an older
+// record behind, which only costs a database write later.
+func (c *Redis) Set(ctx context.Context, scan *domain.ServiceScan) error {
+	data, err := json.Marshal(scan)
+	if err != nil {
+		return fmt.Errorf("failed to encode cached scan: %w", err)
+	}
+	if err := c.client.Set(ctx, redisKey(scan.Key()), data, c.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to cache scan: %w", err)
+	}
+	return nil
+}
+
+func (c *Redis) Delete(ctx context.Context, keys ...domain.ServiceKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = redisKey(key)
+	}
+	if err := c.client.Del(ctx, redisKeys...).Err(); err != nil {
+		return fmt.Errorf("failed to delete cached scans: %w", err)
+	}
+	return nil
+}
+
+// Ping reports whether the server is reachable
+func (c *Redis) Ping(ctx context.Context) error {
+	if err := c.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to reach cache: %w", err)
+	}
+	return nil
+}
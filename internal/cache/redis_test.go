@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedis(t *testing.T, ttl time.Duration) (*Redis, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedis(client, ttl), server
+}
+
+func TestRedis_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store, server := newRedis(t, time.Minute)
+	scan := scanAt("2001:db8::1", "a", 0)
+
+	assert.Nil(t, cached(t, store, scan))
+	require.NoError(t, store.Set(ctx, scan))
+	assert.Equal(t, scan, cached(t, store, scan))
+	assert.True(t, server.Exists("scan-takehome:latest:2001:db8::1/80/HTTP"))
+
+	require.NoError(t, store.Delete(ctx, scan.Key()))
+	assert.Nil(t, cached(t, store, scan))
+}
+
+func TestRedis_EntriesExpire(t *testing.T) {
+	store, server := newRedis(t, time.Minute)
+	scan := scanAt("10.0.0.1", "a", 0)
+	require.NoError(t, store.Set(context.Background(), scan))
+
+	server.FastForward(time.Minute)
+	assert.Nil(t, cached(t, store, scan))
+}
+
+func TestRedis_ServerDown(t *testing.T) {
+	store, server := newRedis(t, time.Minute)
+	server.Close()
+
+	_, err := store.Get(context.Background(), scanAt("10.0.0.1", "a", 0).Key())
+	assert.Error(t, err)
+	assert.Error(t, store.Ping(context.Background()))
+}
@@ -0,0 +1,230 @@
+// Package db opens Postgres and SQLite connections and migrates their schemas
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SSL modes understood by lib/pq
+var sslModes = []string{"disable", "require", "verify-ca", "verify-full"}
+
+// Config describes how to reach Postgres. When DSN is set it is used as is
+// and the individual connection fields are ignored; a PasswordFile still
+// supplies the password.
+type Config struct {
+	// DSN is a full connection string, either postgres:// URL or key=value
+	DSN  string `yaml:"dsn"`
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	Name string `yaml:"name"`
+	User string `yaml:"user"`
+	// Password is ignored when PasswordFile is set
+	Password string `yaml:"password"`
+	// PasswordFile holds the password, such as a mounted secret; a trailing
+	// newline is dropped
+	PasswordFile string `yaml:"password_file"`
+	// SSLMode is disable, require, verify-ca or verify-full
+	SSLMode     string `yaml:"sslmode"`
+	SSLRootCert string `yaml:"sslrootcert"`
+	SSLCert     string `yaml:"sslcert"`
+	SSLKey      string `yaml:"sslkey"`
+
+	// Pool settings; zero keeps the database/sql default, which for
+	// MaxOpenConns means no limit
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+}
+
+// Validate reports every problem with the settings at once. Field names in
+// the errors are prefixed with prefix, such as "database.".
+func (c Config) Validate(prefix string) error {
+	var errs []error
+	invalid := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s%s: %s", prefix, field, fmt.Sprintf(format, args...)))
+	}
+
+	if c.DSN != "" {
+		if isURL(c.DSN) {
+			if _, err := pq.ParseURL(c.DSN); err != nil {
+				invalid("dsn", "is not a valid connection URL: %v", err)
+			}
+		}
+	} else {
+		if c.Host == "" {
+			invalid("host", "is required unless dsn is set")
+		}
+		if c.Port < 1 || c.Port > 65535 {
+			invalid("port", "must be between 1 and 65535, got %d", c.Port)
+		}
+		if c.Name == "" {
+			invalid("name", "is required unless dsn is set")
+		}
+		if c.User == "" {
+			invalid("user", "is required unless dsn is set")
+		}
+		if !slices.Contains(sslModes, c.SSLMode) {
+			invalid("sslmode", "must be one of %s, got %q", strings.Join(sslModes, ", "), c.SSLMode)
+		}
+		if (c.SSLCert == "") != (c.SSLKey == "") {
+			invalid("sslcert", "and sslkey must be set together")
+		}
+		for _, cert := range c.certificates() {
+			if cert[1] == "" {
+				continue
+			}
+			if _, err := os.Stat(cert[1]); err != nil {
+				invalid(cert[0], "%v", err)
+			}
+		}
+	}
+
+	if c.PasswordFile != "" {
+		if _, err := readPassword(c.PasswordFile); err != nil {
+			invalid("password_file", "%v", err)
+		}
+	}
+
+	if c.MaxOpenConns < 0 {
+		invalid("max_open_conns", "must not be negative")
+	}
+	if c.MaxIdleConns < 0 {
+		invalid("max_idle_conns", "must not be negative")
+	}
+	if c.MaxOpenConns > 0 && c.MaxIdleConns > c.MaxOpenConns {
+		invalid("max_idle_conns", "must not exceed max_open_conns (%d)", c.MaxOpenConns)
+	}
+	if c.ConnMaxLifetime < 0 {
+		invalid("conn_max_lifetime", "must not be negative")
+	}
+	if c.ConnMaxIdleTime < 0 {
+		invalid("conn_max_idle_time", "must not be negative")
+	}
+
+	return errors.Join(errs...)
+}
+
+// ConnString returns the lib/pq connection string, reading PasswordFile if set
+func (c Config) ConnString() (string, error) {
+	password := c.Password
+	if c.PasswordFile != "" {
+		var err error
+		if password, err = readPassword(c.PasswordFile); err != nil {
+			return "", err
+		}
+	}
+
+	if c.DSN != "" {
+		dsn := c.DSN
+		if isURL(dsn) {
+			var err error
+			if dsn, err = pq.ParseURL(dsn); err != nil {
+				return "", fmt.Errorf("failed to parse database URL: %w", err)
+			}
+		}
+		if c.PasswordFile != "" {
+			// Later keys win in lib/pq, so this overrides any password in the DSN
+			dsn += " password=" + quote(password)
+		}
+		return dsn, nil
+	}
+
+	params := []string{
+		"host=" + quote(c.Host),
+		"port=" + strconv.Itoa(c.Port),
+		"user=" + quote(c.User),
+		"password=" + quote(password),
+		"dbname=" + quote(c.Name),
+		"sslmode=" + quote(c.SSLMode),
+	}
+	for _, cert := range c.certificates() {
+		if cert[1] != "" {
+			params = append(params, cert[0]+"="+quote(cert[1]))
+		}
+	}
+	return strings.Join(params, " "), nil
+}
+
+// certificates pairs each TLS file setting with its connection string key
+func (c Config) certificates() [][2]string {
+	return [][2]string{
+		{"sslrootcert", c.SSLRootCert},
+		{"sslcert", c.SSLCert},
+		{"sslkey", c.SSLKey},
+	}
+}
+
+var dsnPassword = regexp.MustCompile(`password\s*=\s*('(?:[^'\\]|\\.)*'|\S+)`)
+
+// Redacted returns a copy that is safe to print
+func (c Config) Redacted() Config {
+	if c.Password != "" {
+		c.Password = "REDACTED"
+	}
+	if isURL(c.DSN) {
+		if parsed, err := url.Parse(c.DSN); err == nil {
+			c.DSN = parsed.Redacted()
+		}
+	}
+	c.DSN = dsnPassword.ReplaceAllString(c.DSN, "password=REDACTED")
+	return c
+}
+
+// Open connects to Postgres, applies the pool settings and checks the
+// connection with a ping
+func Open(ctx context.Context, config Config) (*sql.DB, error) {
+	dsn, err := config.ConnString()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	if config.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(config.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+	return db, nil
+}
+
+func readPassword(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func isURL(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// quote escapes a value for a key=value connection string
+func quote(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
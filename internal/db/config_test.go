@@ -0,0 +1,67 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validConfig() Config {
+	return Config{Host: "localhost", Port: 5432, Name: "scans", User: "postgres", Password: "postgres", SSLMode: "disable"}
+}
+
+func TestConnString(t *testing.T) {
+	config := validConfig()
+	config.Password = "it's secret"
+	config.SSLMode = "verify-full"
+	config.SSLRootCert = "/certs/ca.pem"
+
+	dsn, err := config.ConnString()
+	require.NoError(t, err)
+	assert.Equal(t,
+		`host=localhost port=5432 user=postgres password='it\'s secret' dbname=scans sslmode=verify-full sslrootcert=/certs/ca.pem`,
+		dsn)
+}
+
+func TestConnStringPasswordFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(path, []byte("from-file\n"), 0o600))
+
+	config := validConfig()
+	config.PasswordFile = path
+	dsn, err := config.ConnString()
+	require.NoError(t, err)
+	assert.Contains(t, dsn, "password=from-file ")
+
+	config = Config{DSN: "postgres://app@db:5432/scans?sslmode=require", PasswordFile: path}
+	dsn, err = config.ConnString()
+	require.NoError(t, err)
+	assert.Contains(t, dsn, "sslmode='require'")
+	assert.True(t, strings.HasSuffix(dsn, " password=from-file"), dsn)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, validConfig().Validate("database."))
+	assert.NoError(t, Config{DSN: "host=db dbname=scans"}.Validate("database."))
+
+	config := Config{Port: 0, SSLMode: "prefer", SSLCert: "/missing/client.pem", PasswordFile: "/missing/password"}
+	err := config.Validate("database.")
+	require.Error(t, err)
+	for _, field := range []string{"host", "port", "name", "user", "sslmode", "sslcert", "password_file"} {
+		assert.Contains(t, err.Error(), "database."+field+":")
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	config := Config{DSN: "host=db password='s3cret pass' dbname=scans", Password: "s3cret"}
+	redacted := config.Redacted()
+	assert.Equal(t, "host=db password=REDACTED dbname=scans", redacted.DSN)
+	assert.Equal(t, "REDACTED", redacted.Password)
+
+	redacted = Config{DSN: "postgres://app:s3cret@db/scans"}.Redacted()
+	assert.NotContains(t, redacted.DSN, "s3cret")
+}
@@ -0,0 +1,451 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql sqlite_migrations/*.sql
+var embedded embed.FS
+
+// ErrSchemaBehind is returned by Migrator.Check when migrations are pending
+var ErrSchemaBehind = errors.New("database schema is behind")
+
+// noTransaction marks a migration whose statements must run outside a
+// transaction, such as CREATE INDEX CONCURRENTLY. Its statements run one by
+// one, so they must be safe to run again after a partial failure.
+const noTransaction = "-- migrate:no-transaction"
+
+// migrationLockID serializes migrations from concurrent processes through a
+// Postgres advisory lock
+const migrationLockID = 7_246_031_118
+
+// migrationLockRetry is how long a process waits before trying to take the
+// migration lock again
+const migrationLockRetry = 500 * time.Millisecond
+
+// dialect holds what differs between the databases a Migrator manages
+type dialect struct {
+	dir           string
+	createTable   string
+	tableExists   string
+	insertVersion string
+	deleteVersion string
+	// lock keeps other processes from migrating until unlock is called
+	lock func(ctx context.Context, conn *sql.Conn) (unlock func(), err error)
+}
+
+var postgresDialect = dialect{
+	dir: "migrations",
+	createTable: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`,
+	tableExists:   `SELECT to_regclass('schema_migrations') IS NOT NULL`,
+	insertVersion: `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+	deleteVersion: `DELETE FROM schema_migrations WHERE version = $1`,
+	lock: func(ctx context.Context, conn *sql.Conn) (func(), error) {
+		// A blocking pg_advisory_lock would hold a snapshot while it waits,
+		// and CREATE INDEX CONCURRENTLY in the lock holder waits for every
+		// older snapshot to finish, so the two would deadlock. Polling holds
+		// no snapshot between attempts.
+		for {
+			var locked bool
+			if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, migrationLockID).Scan(&locked); err != nil {
+				return nil, err
+			}
+			if locked {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(migrationLockRetry):
+			}
+		}
+		return func() {
+			// Use a fresh context so the lock is released even after cancellation
+			_, _ = conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+		}, nil
+	},
+}
+
+var sqliteDialect = dialect{
+	dir: "sqlite_migrations",
+	createTable: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+	tableExists:   `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')`,
+	insertVersion: `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`,
+	deleteVersion: `DELETE FROM schema_migrations WHERE version = ?`,
+	// SQLite has no advisory locks. A migration and its schema_migrations row
+	// commit together, so a second process applying the same version fails on
+	// the primary key and rolls back instead of applying it twice.
+	lock: func(ctx context.Context, conn *sql.Conn) (func(), error) {
+		return func() {}, nil
+	},
+}
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one schema change, read from NNN_name.up.sql and the
+// optional NNN_name.down.sql
+type Migration struct {
+	Version       int64
+	Name          string
+	Up            string
+	Down          string
+	NoTransaction bool
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrations returns the Postgres migrations embedded in the binary, oldest first
+func Migrations() ([]Migration, error) {
+	return loadMigrations(embedded, postgresDialect.dir)
+}
+
+// SQLiteMigrations returns the SQLite migrations embedded in the binary. They
+// carry the same versions and names as the Postgres ones.
+func SQLiteMigrations() ([]Migration, error) {
+	return loadMigrations(embedded, sqliteDialect.dir)
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %s is not named NNN_name.up.sql or NNN_name.down.sql", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+
+		script := string(data)
+		if match[3] == "up" {
+			migration.Up = script
+			migration.NoTransaction = strings.HasPrefix(script, noTransaction)
+		} else {
+			migration.Down = script
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies migrations and records them in schema_migrations
+type Migrator struct {
+	db         *sql.DB
+	dialect    dialect
+	migrations []Migration
+}
+
+// NewMigrator returns a Migrator for the embedded Postgres migrations
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	return newMigrator(db, postgresDialect)
+}
+
+// NewSQLiteMigrator returns a Migrator for the embedded SQLite migrations
+func NewSQLiteMigrator(db *sql.DB) (*Migrator, error) {
+	return newMigrator(db, sqliteDialect)
+}
+
+func newMigrator(db *sql.DB, dialect dialect) (*Migrator, error) {
+	migrations, err := loadMigrations(embedded, dialect.dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// Up applies every pending migration in order and returns those it applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		done, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			if err := m.run(ctx, conn, migration, migration.Up, true); err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the latest steps applied migrations and returns them, newest first
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		done, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s cannot be reverted: it has no down file", migration.Version, migration.Name)
+			}
+			if err := m.run(ctx, conn, migration, migration.Down, false); err != nil {
+				return err
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every embedded migration and whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close()
+
+	done, err := m.appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		appliedAt, ok := done[migration.Version]
+		statuses[i] = MigrationStatus{Migration: migration, Applied: ok, AppliedAt: appliedAt}
+	}
+	return statuses, nil
+}
+
+// Check returns ErrSchemaBehind, naming the pending migrations, unless every
+// embedded migration has been applied
+func (m *Migrator) Check(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, status := range statuses {
+		if !status.Applied {
+			pending = append(pending, fmt.Sprintf("%03d_%s", status.Version, status.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: pending migrations %s", ErrSchemaBehind, strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// locked runs fn on one connection holding the migration lock, so consumers
+// starting together do not apply the same migration twice
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close()
+
+	unlock, err := m.dialect.lock(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("failed to take migration lock: %w", err)
+	}
+	defer unlock()
+
+	if _, err := conn.ExecContext(ctx, m.dialect.createTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+// appliedVersions returns when each applied migration ran. A database that
+// has never been migrated has no schema_migrations table and no versions.
+func (m *Migrator) appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	var exists bool
+	if err := conn.QueryRowContext(ctx, m.dialect.tableExists).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to look up schema_migrations: %w", err)
+	}
+	versions := map[int64]time.Time{}
+	if !exists {
+		return versions, nil
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+		versions[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	return versions, nil
+}
+
+// run executes one direction of a migration and records the new version
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, migration Migration, script string, up bool) error {
+	record := m.dialect.deleteVersion
+	args := []any{migration.Version}
+	if up {
+		record = m.dialect.insertVersion
+		args = append(args, migration.Name)
+	}
+	label := fmt.Sprintf("%03d_%s", migration.Version, migration.Name)
+
+	if migration.NoTransaction {
+		for _, statement := range splitStatements(script) {
+			if _, err := conn.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("failed to run migration %s: %w", label, err)
+			}
+		}
+		if _, err := conn.ExecContext(ctx, record, args...); err != nil {
+			return fmt.Errorf("failed to record migration %s: %w", label, err)
+		}
+		return nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin migration %s: %w", label, err)
+	}
+	defer func() {
+		// Rollback is a no-op once the transaction has been committed
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("failed to run migration %s: %w", label, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", label, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %s: %w", label, err)
+	}
+	return nil
+}
+
+// splitStatements splits a script on the semicolons that end statements,
+// skipping those inside quotes, dollar-quoted bodies and comments. Statements
+// that are only comments are dropped.
+func splitStatements(script string) []string {
+	var statements []string
+	start := 0
+	code := false // whether the current statement has anything but comments
+
+	flush := func(end int) {
+		if code {
+			statements = append(statements, strings.TrimSpace(script[start:end]))
+		}
+		start, code = end+1, false
+	}
+
+	for i := 0; i < len(script); i++ {
+		switch c := script[i]; {
+		case strings.HasPrefix(script[i:], "--"):
+			i = skipTo(script, i, "\n") - 1
+		case strings.HasPrefix(script[i:], "/*"):
+			i = skipTo(script, i+2, "*/") + 1
+		case c == '\'' || c == '"':
+			code = true
+			i = skipTo(script, i+1, string(c))
+		case c == '$':
+			code = true
+			if tag := dollarTag(script[i:]); tag != "" {
+				i = skipTo(script, i+len(tag), tag) + len(tag) - 1
+			}
+		case c == ';':
+			flush(i)
+		case c != ' ' && c != '\t' && c != '\n' && c != '\r':
+			code = true
+		}
+	}
+	flush(len(script))
+	return statements
+}
+
+// skipTo returns the index of the first occurrence of end at or after from,
+// or the end of script
+func skipTo(script string, from int, end string) int {
+	if from >= len(script) {
+		return len(script)
+	}
+	if index := strings.Index(script[from:], end); index >= 0 {
+		return from + index
+	}
+	return len(script)
+}
+
+var dollarQuote = regexp.MustCompile(`^\$[A-Za-z_]*\$`)
+
+// dollarTag returns the opening tag, such as $$ or $body$, at the start of s
+func dollarTag(s string) string {
+	return dollarQuote.FindString(s)
+}
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    message_id TEXT NOT NULL,
+    reason VARCHAR(50) NOT NULL,
+    error TEXT NOT NULL,
+    delivery_attempt INTEGER NOT NULL,
+    payload BYTEA NOT NULL,
+    failed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_dead_letters_reason ON dead_letters(reason);
+CREATE INDEX IF NOT EXISTS idx_dead_letters_failed_at ON dead_letters(failed_at);
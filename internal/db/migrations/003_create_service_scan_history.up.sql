@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS service_scan_history (
+    id BIGSERIAL PRIMARY KEY,
+    ip VARCHAR(45) NOT NULL,
+    port INTEGER NOT NULL,
+    service VARCHAR(50) NOT NULL,
+    response TEXT NOT NULL,
+    response_hash CHAR(64) NOT NULL,
+    previous_response_hash CHAR(64),
+    first_seen TIMESTAMP NOT NULL,
+    last_seen TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_service_scan_history_timeline ON service_scan_history(ip, port, service, first_seen);
@@ -0,0 +1,7 @@
+-- migrate:no-transaction
+
+DROP INDEX CONCURRENTLY IF EXISTS idx_service_scans_ip_addr;
+DROP TRIGGER IF EXISTS service_scans_ip_addr ON service_scans;
+DROP FUNCTION IF EXISTS service_scans_set_ip_addr();
+ALTER TABLE service_scans DROP COLUMN IF EXISTS ip_addr;
+DROP FUNCTION IF EXISTS try_inet(TEXT);
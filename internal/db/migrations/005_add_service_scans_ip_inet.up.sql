@@ -0,0 +1,63 @@
+-- migrate:no-transaction
+
+-- Adds an inet copy of ip for CIDR, range and family queries. The varchar ip
+-- column stays the conflict key, so running consumers are unaffected: the new
+-- column is nullable (no table rewrite), filled by a trigger for new writes
+-- and backfilled in small batches, and indexed without blocking writes.
+-- CREATE INDEX CONCURRENTLY and the batch commits cannot run inside a
+-- transaction, so each statement runs on its own and all are re-runnable.
+
+ALTER TABLE service_scans ADD COLUMN IF NOT EXISTS ip_addr INET;
+
+-- Returns NULL instead of failing for values that are not valid addresses
+CREATE OR REPLACE FUNCTION try_inet(value TEXT) RETURNS INET AS $$
+BEGIN
+    RETURN value::inet;
+EXCEPTION WHEN invalid_text_representation THEN
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION service_scans_set_ip_addr() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.ip_addr := try_inet(NEW.ip);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS service_scans_ip_addr ON service_scans;
+CREATE TRIGGER service_scans_ip_addr
+    BEFORE INSERT OR UPDATE OF ip ON service_scans
+    FOR EACH ROW EXECUTE FUNCTION service_scans_set_ip_addr();
+
+-- Backfill existing rows, committing every batch so locks are held briefly
+DO $$
+DECLARE
+    updated INTEGER;
+BEGIN
+    LOOP
+        UPDATE service_scans
+        SET ip_addr = try_inet(ip)
+        WHERE id IN (
+            SELECT id FROM service_scans
+            WHERE ip_addr IS NULL AND try_inet(ip) IS NOT NULL
+            LIMIT 10000
+        );
+        GET DIAGNOSTICS updated = ROW_COUNT;
+        EXIT WHEN updated = 0;
+        COMMIT;
+    END LOOP;
+END;
+$$;
+
+-- A CREATE INDEX CONCURRENTLY that was cancelled leaves an INVALID index,
+-- which IF NOT EXISTS would keep, so drop it and build it again
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_index WHERE indexrelid = to_regclass('idx_service_scans_ip_addr') AND NOT indisvalid) THEN
+        DROP INDEX idx_service_scans_ip_addr;
+    END IF;
+END;
+$$;
+
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_service_scans_ip_addr ON service_scans USING GIST (ip_addr inet_ops);
@@ -0,0 +1 @@
+ALTER TABLE change_events DROP COLUMN IF EXISTS failed_at;
@@ -0,0 +1,6 @@
+-- Events that keep failing, or whose payload cannot be decoded, are parked
+-- with failed_at so they stop holding up the events behind them. The pending
+-- index still covers the relay's query: parked rows are few and filtered out
+-- after the index scan.
+
+ALTER TABLE change_events ADD COLUMN IF NOT EXISTS failed_at TIMESTAMP;
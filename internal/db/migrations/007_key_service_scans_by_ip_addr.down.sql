@@ -0,0 +1,13 @@
+-- migrate:no-transaction
+
+-- Merged and respelled records are not split again
+DROP INDEX CONCURRENTLY IF EXISTS idx_service_scans_ip_addr_key;
+
+CREATE OR REPLACE FUNCTION service_scans_set_ip_addr() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.ip_addr := try_inet(NEW.ip);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS unmap_inet(INET);
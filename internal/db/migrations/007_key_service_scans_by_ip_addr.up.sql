@@ -0,0 +1,65 @@
+-- migrate:no-transaction
+
+-- Migration 005 kept the varchar ip as the conflict key, so addresses still
+-- compared as text and 1.1.1.1 and ::ffff:1.1.1.1, or two spellings of one
+-- IPv6 address, became separate records. This makes ip_addr the key instead:
+-- IPv4-mapped addresses are stored as IPv4, existing records are merged into
+-- the newest one per address and rewritten in canonical form, and a unique
+-- index on (ip_addr, port, service) backs the upsert. Converting ip itself
+-- would rewrite the table under an exclusive lock, so as in 005 nothing here
+-- takes long locks and every statement is re-runnable.
+--
+-- This is a release step of its own: stop consumers built before 007 first.
+-- Their ON CONFLICT (ip, port, service) does not cover the new index, so a
+-- scan spelling a stored address differently fails with a unique violation
+-- on every redelivery. Consumers built with 007 need its index for their
+-- ON CONFLICT (ip_addr, port, service), so start them once it is applied.
+-- UNIQUE(ip, port, service) is left in place; with ip in canonical form it
+-- follows from the new key.
+
+-- Stores IPv4-mapped IPv6 addresses as the IPv4 address they carry
+CREATE OR REPLACE FUNCTION unmap_inet(value INET) RETURNS INET AS $$
+    SELECT CASE
+        WHEN family(value) = 6 AND value <<= '::ffff:0.0.0.0/96'::inet
+        THEN '0.0.0.0'::inet + (value - '::ffff:0.0.0.0'::inet)
+        ELSE value
+    END;
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION service_scans_set_ip_addr() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.ip_addr := unmap_inet(try_inet(NEW.ip));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+UPDATE service_scans SET ip_addr = unmap_inet(ip_addr) WHERE ip_addr <<= '::ffff:0.0.0.0/96'::inet;
+
+-- Only a key with a non-canonical spelling can have duplicates, since the
+-- canonical spelling is unique under UNIQUE(ip, port, service)
+WITH respelled AS (
+    SELECT DISTINCT ip_addr, port, service FROM service_scans WHERE ip <> host(ip_addr)
+), ranked AS (
+    SELECT s.id, row_number() OVER (
+        PARTITION BY s.ip_addr, s.port, s.service ORDER BY s.last_scanned DESC, s.id
+    ) AS rank
+    FROM service_scans s JOIN respelled USING (ip_addr, port, service)
+)
+DELETE FROM service_scans WHERE id IN (SELECT id FROM ranked WHERE rank > 1);
+
+UPDATE service_scans SET ip = host(ip_addr) WHERE ip <> host(ip_addr);
+
+UPDATE service_scan_history SET ip = host(unmap_inet(try_inet(ip)))
+WHERE try_inet(ip) IS NOT NULL AND ip <> host(unmap_inet(try_inet(ip)));
+
+-- A CREATE INDEX CONCURRENTLY that was cancelled leaves an INVALID index,
+-- which IF NOT EXISTS would keep, so drop it and build it again
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_index WHERE indexrelid = to_regclass('idx_service_scans_ip_addr_key') AND NOT indisvalid) THEN
+        DROP INDEX idx_service_scans_ip_addr_key;
+    END IF;
+END;
+$$;
+
+CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS idx_service_scans_ip_addr_key ON service_scans(ip_addr, port, service);
@@ -0,0 +1,17 @@
+-- migrate:no-transaction
+
+-- ListScans orders and pages by (ip, port, service) under the "C" collation
+-- so every backend lists records in the same order. The unique key's index
+-- uses the database's default collation, so unless that is C this index is
+-- needed to page without sorting the whole table.
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_index WHERE indexrelid = to_regclass('idx_service_scans_key_c') AND NOT indisvalid) THEN
+        DROP INDEX idx_service_scans_key_c;
+    END IF;
+END;
+$$;
+
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_service_scans_key_c
+    ON service_scans (ip COLLATE "C", port, service COLLATE "C");
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, migration := range migrations {
+		assert.Equal(t, int64(i+1), migration.Version, "versions must be contiguous")
+		assert.NotEmpty(t, migration.Down, "migration %d_%s needs a down file", migration.Version, migration.Name)
+		assert.Equal(t, migration.NoTransaction, strings.HasPrefix(migration.Down, noTransaction),
+			"migration %d_%s must use the same transaction mode in both directions", migration.Version, migration.Name)
+	}
+
+	assert.Equal(t, "add_service_scans_ip_inet", migrations[4].Name)
+	assert.True(t, migrations[4].NoTransaction, "CREATE INDEX CONCURRENTLY cannot run in a transaction")
+	assert.Equal(t, "key_service_scans_by_ip_addr", migrations[6].Name)
+	assert.True(t, migrations[6].NoTransaction, "CREATE INDEX CONCURRENTLY cannot run in a transaction")
+}
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/002_second.up.sql":  {Data: []byte("-- migrate:no-transaction\nSELECT 2;")},
+		"m/001_first.up.sql":   {Data: []byte("SELECT 1;")},
+		"m/001_first.down.sql": {Data: []byte("SELECT -1;")},
+	}
+
+	migrations, err := loadMigrations(fsys, "m")
+	require.NoError(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Name: "first", Up: "SELECT 1;", Down: "SELECT -1;"},
+		{Version: 2, Name: "second", Up: "-- migrate:no-transaction\nSELECT 2;", NoTransaction: true},
+	}, migrations)
+}
+
+func TestLoadMigrationsRejectsBadFiles(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"bad name":     {"m/first.sql": {Data: []byte("SELECT 1;")}},
+		"missing up":   {"m/001_first.down.sql": {Data: []byte("SELECT 1;")}},
+		"name clashes": {"m/001_first.up.sql": {}, "m/001_other.down.sql": {}},
+	}
+
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadMigrations(fsys, "m")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- header; with a semicolon
+CREATE TABLE t (note TEXT DEFAULT 'a;b', "odd;name" INT);
+/* block; comment */
+CREATE FUNCTION f() RETURNS INT AS $body$
+BEGIN
+    RETURN 1; -- inside the body
+END;
+$body$ LANGUAGE plpgsql;
+DO $$ BEGIN PERFORM 'it''s;'; END $$;
+SELECT $1;
+-- trailing comment only
+`
+
+	statements := splitStatements(script)
+	require.Len(t, statements, 4)
+	assert.Equal(t, "-- header; with a semicolon\nCREATE TABLE t (note TEXT DEFAULT 'a;b', \"odd;name\" INT)", statements[0])
+	assert.Contains(t, statements[1], "RETURN 1; -- inside the body")
+	assert.True(t, strings.HasPrefix(statements[1], "/* block; comment */\nCREATE FUNCTION"))
+	assert.Equal(t, "DO $$ BEGIN PERFORM 'it''s;'; END $$", statements[2])
+	assert.Equal(t, "SELECT $1", statements[3])
+}
+
+func TestSplitStatementsOfInetMigration(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+
+	statements := splitStatements(migrations[4].Up)
+	require.Len(t, statements, 8)
+	assert.Contains(t, statements[5], "DO $$")
+	assert.Contains(t, statements[5], "COMMIT;")
+	assert.Contains(t, statements[6], "NOT indisvalid")
+	assert.Contains(t, statements[7], "CREATE INDEX CONCURRENTLY")
+}
+
+func TestSplitStatementsOfIPAddrKeyMigration(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+
+	statements := splitStatements(migrations[6].Up)
+	require.Len(t, statements, 8)
+	assert.Contains(t, statements[0], "CREATE OR REPLACE FUNCTION unmap_inet")
+	assert.Contains(t, statements[3], "DELETE FROM service_scans")
+	assert.Contains(t, statements[6], "NOT indisvalid")
+	assert.Contains(t, statements[7], "CREATE UNIQUE INDEX CONCURRENTLY")
+}
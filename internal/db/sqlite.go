@@ -0,0 +1,33 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	// Registers the pure Go "sqlite" driver, so no cgo is needed
+	_ "modernc.org/sqlite"
+)
+
+// sqliteParams wait for a lock instead of failing with SQLITE_BUSY when
+// another process writes, let readers run alongside the writer, and take the
+// write lock when a transaction begins so its reads cannot go stale before
+// it writes
+const sqliteParams = "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+
+// OpenSQLite opens the SQLite database at path, creating the file if needed.
+// SQLite has a single writer, so the pool holds one connection; that also
+// keeps ":memory:" from giving every connection its own empty database.
+func OpenSQLite(ctx context.Context, path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path+"?"+sqliteParams)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+	return db, nil
+}
@@ -0,0 +1,15 @@
+-- Timestamps are UTC text in the fixed-width form 'YYYY-MM-DD HH:MM:SS.ffffff',
+-- so comparing them as strings orders them by time
+
+CREATE TABLE IF NOT EXISTS service_scans (
+    id INTEGER PRIMARY KEY,
+    ip TEXT NOT NULL,
+    port INTEGER NOT NULL,
+    service TEXT NOT NULL,
+    response TEXT NOT NULL,
+    last_scanned TEXT NOT NULL,
+    UNIQUE(ip, port, service)
+);
+
+CREATE INDEX IF NOT EXISTS idx_service_scans_lookup ON service_scans(ip, port, service);
+CREATE INDEX IF NOT EXISTS idx_service_scans_last_scanned ON service_scans(last_scanned);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id INTEGER PRIMARY KEY,
+    message_id TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    error TEXT NOT NULL,
+    delivery_attempt INTEGER NOT NULL,
+    payload BLOB NOT NULL,
+    failed_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_dead_letters_reason ON dead_letters(reason);
+CREATE INDEX IF NOT EXISTS idx_dead_letters_failed_at ON dead_letters(failed_at);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS service_scan_history (
+    id INTEGER PRIMARY KEY,
+    ip TEXT NOT NULL,
+    port INTEGER NOT NULL,
+    service TEXT NOT NULL,
+    response TEXT NOT NULL,
+    response_hash TEXT NOT NULL,
+    previous_response_hash TEXT,
+    first_seen TEXT NOT NULL,
+    last_seen TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_service_scan_history_timeline ON service_scan_history(ip, port, service, first_seen);
@@ -0,0 +1,13 @@
+-- Change events need the Postgres outbox relay; the table keeps the SQLite
+-- schema in step with Postgres
+
+CREATE TABLE IF NOT EXISTS change_events (
+    id INTEGER PRIMARY KEY,
+    payload TEXT NOT NULL,
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000', 'now')),
+    published_at TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_change_events_pending ON change_events(id) WHERE published_at IS NULL;
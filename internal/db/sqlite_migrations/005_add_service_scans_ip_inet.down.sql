@@ -0,0 +1 @@
+-- Nothing to revert; see 005_add_service_scans_ip_inet.up.sql
@@ -0,0 +1,3 @@
+-- SQLite has no inet type. ListScans parses addresses to apply CIDR, range
+-- and family filters, so this version only keeps the numbering in step with
+-- Postgres.
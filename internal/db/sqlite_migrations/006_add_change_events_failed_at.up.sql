@@ -0,0 +1,4 @@
+-- Keeps the SQLite schema in step with Postgres; see
+-- migrations/006_add_change_events_failed_at.up.sql
+
+ALTER TABLE change_events ADD COLUMN failed_at TEXT;
@@ -0,0 +1 @@
+-- Nothing to revert; see 007_key_service_scans_by_ip_addr.up.sql
@@ -0,0 +1,3 @@
+-- SQLite has no inet type. The consumer stores every address in its
+-- canonical spelling, so the text ip already identifies one address and this
+-- version only keeps the numbering in step with Postgres.
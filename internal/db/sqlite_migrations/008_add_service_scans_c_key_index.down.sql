@@ -0,0 +1 @@
+-- Nothing to revert; see 008_add_service_scans_c_key_index.up.sql
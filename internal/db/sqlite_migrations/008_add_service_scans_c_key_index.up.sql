@@ -0,0 +1,3 @@
+-- SQLite compares text byte by byte already, so the unique key's index
+-- serves ListScans and this version only keeps the numbering in step with
+-- Postgres.
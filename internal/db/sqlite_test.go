@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteMigrationsMatchPostgres(t *testing.T) {
+	postgres, err := Migrations()
+	require.NoError(t, err)
+	sqlite, err := SQLiteMigrations()
+	require.NoError(t, err)
+
+	require.Len(t, sqlite, len(postgres))
+	for i := range postgres {
+		assert.Equal(t, postgres[i].Version, sqlite[i].Version)
+		assert.Equal(t, postgres[i].Name, sqlite[i].Name)
+		assert.NotEmpty(t, sqlite[i].Down, "migration %d_%s needs a down file", sqlite[i].Version, sqlite[i].Name)
+	}
+}
+
+func TestSQLiteMigrator(t *testing.T) {
+	ctx := context.Background()
+	database, err := OpenSQLite(ctx, filepath.Join(t.TempDir(), "scans.db"))
+	require.NoError(t, err)
+	defer database.Close()
+
+	migrator, err := NewSQLiteMigrator(database)
+	require.NoError(t, err)
+	migrations, err := SQLiteMigrations()
+	require.NoError(t, err)
+	assert.ErrorIs(t, migrator.Check(ctx), ErrSchemaBehind)
+
+	applied, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(migrations))
+	require.NoError(t, migrator.Check(ctx))
+
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	for _, status := range statuses {
+		assert.True(t, status.Applied)
+		assert.False(t, status.AppliedAt.IsZero())
+	}
+
+	applied, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied, "nothing is pending")
+
+	reverted, err := migrator.Down(ctx, len(migrations))
+	require.NoError(t, err)
+	assert.Len(t, reverted, len(migrations))
+	var tables int
+	require.NoError(t, database.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name <> 'schema_migrations'`).Scan(&tables))
+	assert.Zero(t, tables)
+
+	applied, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(migrations))
+}
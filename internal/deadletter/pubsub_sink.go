@@ -0,0 +1,55 @@
+package deadletter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+// PubSubSink republishes the original payload of a dead letter to a topic,
+// carrying the failure details as message attributes
+type PubSubSink struct {
+	client *pubsub.Client
+	topic  *pubsub.Topic
+}
+
+func NewPubSubSink(ctx context.Context, projectID, topicID string) (*PubSubSink, error) {
+	client, err := pubsub.NewClient(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PubSubSink{
+		client: client,
+		topic:  client.Topic(topicID),
+	}, nil
+}
+
+func (s *PubSubSink) SendDeadLetter(ctx context.Context, deadLetter *domain.DeadLetter) error {
+	msg := &pubsub.Message{
+		Data: deadLetter.Payload,
+		Attributes: map[string]string{
+			"original_message_id": deadLetter.MessageID,
+			"reason":              deadLetter.Reason,
+			"error":               deadLetter.Error,
+			"delivery_attempt":    strconv.Itoa(deadLetter.DeliveryAttempt),
+			"failed_at":           deadLetter.FailedAt.UTC().Format(time.RFC3339),
+		},
+	}
+
+	if _, err := s.topic.Publish(ctx, msg).Get(ctx); err != nil {
+		return fmt.Errorf("failed to publish dead letter: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PubSubSink) Close() error {
+	s.topic.Stop()
+	return s.client.Close()
+}
@@ -2,59 +2,116 @@ package domain
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/censys/scan-takehome/pkg/scanning"
 )
 
+var (
+	// ErrUnsupportedDataVersion is returned for a data_version with no registered decoder
+	ErrUnsupportedDataVersion = errors.New("unsupported data version")
+	// ErrMalformedData is returned when a scan's data cannot be decoded for its data_version
+	ErrMalformedData = errors.New("malformed data")
+)
+
+// ResponseDecoder extracts the service response from the JSON encoded data of a scan
+type ResponseDecoder func(data []byte) (string, error)
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[int]ResponseDecoder{
+		scanning.V1: decodeV1Response,
+		scanning.V2: decodeV2Response,
+	}
+)
+
+// RegisterDecoder makes a decoder available for the given data_version,
+// replacing any decoder already registered for it
+func RegisterDecoder(version int, decoder ResponseDecoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	decoders[version] = decoder
+}
+
+func lookupDecoder(version int) (ResponseDecoder, bool) {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+
+	decoder, ok := decoders[version]
+	return decoder, ok
+}
+
 func ConvertScanToDomain(rawScan scanning.Scan) (ServiceScan, error) {
 	response, err := extractServiceResponse(rawScan)
 	if err != nil {
 		return ServiceScan{}, err
 	}
 
-	return ServiceScan{
+	scan := ServiceScan{
 		IP:          rawScan.Ip,
 		Port:        rawScan.Port,
 		Service:     rawScan.Service,
 		Response:    response,
 		LastScanned: time.Unix(rawScan.Timestamp, 0),
-	}, nil
+	}
+	if err := scan.Validate(); err != nil {
+		return ServiceScan{}, err
+	}
+	scan.IP = CanonicalIP(scan.IP)
+
+	return scan, nil
 }
 
 func extractServiceResponse(rawScan scanning.Scan) (string, error) {
-	switch rawScan.DataVersion {
-	case scanning.V1:
-		// Try to unmarshal into V1Data struct
-		var v1Data scanning.V1Data
-		if err := unmarshalData(rawScan.Data, &v1Data); err != nil {
-			return "", err
-		}
-		// V1Data.ResponseBytesUtf8 is already decoded from base64 during JSON unmarshaling
-		return string(v1Data.ResponseBytesUtf8), nil
-	case scanning.V2:
-		// Try to unmarshal into V2Data struct
-		var v2Data scanning.V2Data
-		if err := unmarshalData(rawScan.Data, &v2Data); err != nil {
-			return "", err
-		}
-		return v2Data.ResponseStr, nil
-	}
-	return "", nil
+	decoder, ok := lookupDecoder(rawScan.DataVersion)
+	if !ok {
+		return "", fmt.Errorf("%w: %d", ErrUnsupportedDataVersion, rawScan.DataVersion)
+	}
+
+	data, err := marshalData(rawScan.Data)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := decoder(data)
+	if err != nil {
+		return "", fmt.Errorf("%w: data_version %d: %v", ErrMalformedData, rawScan.DataVersion, err)
+	}
+	return response, nil
 }
 
-func unmarshalData(data, target interface{}) error {
-	if data == nil {
-		return nil
+// marshalData turns the generically decoded data object back into JSON so a
+// decoder can unmarshal it into its own typed struct
+func marshalData(data interface{}) ([]byte, error) {
+	dataMap, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: expected a JSON object, got %T", ErrMalformedData, data)
 	}
 
-	if dataMap, ok := data.(map[string]interface{}); ok {
-		jsonBytes, err := json.Marshal(dataMap)
-		if err != nil {
-			return err
-		}
-		return json.Unmarshal(jsonBytes, target)
+	jsonBytes, err := json.Marshal(dataMap)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedData, err)
 	}
+	return jsonBytes, nil
+}
 
-	return nil
+func decodeV1Response(data []byte) (string, error) {
+	var v1Data scanning.V1Data
+	if err := json.Unmarshal(data, &v1Data); err != nil {
+		return "", err
+	}
+	// V1Data.ResponseBytesUtf8 is already decoded from base64 during JSON unmarshaling
+	return string(v1Data.ResponseBytesUtf8), nil
+}
+
+func decodeV2Response(data []byte) (string, error) {
+	var v2Data scanning.V2Data
+	if err := json.Unmarshal(data, &v2Data); err != nil {
+		return "", err
+	}
+	return v2Data.ResponseStr, nil
 }
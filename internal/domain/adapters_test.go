@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -65,12 +66,8 @@ func TestConvertScanToDomain_UnknownDataVersion(t *testing.T) {
 
 	result, err := ConvertScanToDomain(rawScan)
 
-	assert.NoError(t, err)
-	assert.Equal(t, "192.168.1.1", result.IP)
-	assert.Equal(t, uint32(8080), result.Port)
-	assert.Equal(t, "HTTP", result.Service)
-	assert.Equal(t, "", result.Response) // Empty response for unknown version
-	assert.Equal(t, time.Unix(1640995200, 0), result.LastScanned)
+	assert.ErrorIs(t, err, ErrUnsupportedDataVersion)
+	assert.Equal(t, ServiceScan{}, result)
 }
 
 func TestConvertScanToDomain_InvalidBase64(t *testing.T) {
@@ -87,7 +84,7 @@ func TestConvertScanToDomain_InvalidBase64(t *testing.T) {
 
 	result, err := ConvertScanToDomain(rawScan)
 
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrMalformedData)
 	assert.Equal(t, ServiceScan{}, result)
 }
 
@@ -103,10 +100,90 @@ func TestConvertScanToDomain_EmptyData(t *testing.T) {
 
 	result, err := ConvertScanToDomain(rawScan)
 
+	assert.ErrorIs(t, err, ErrMalformedData)
+	assert.Equal(t, ServiceScan{}, result)
+}
+
+func TestConvertScanToDomain_NonObjectData(t *testing.T) {
+	rawScan := scanning.Scan{
+		Ip:          "192.168.1.1",
+		Port:        8080,
+		Service:     "HTTP",
+		Timestamp:   1640995200,
+		DataVersion: scanning.V2,
+		Data:        "hello world",
+	}
+
+	result, err := ConvertScanToDomain(rawScan)
+
+	assert.ErrorIs(t, err, ErrMalformedData)
+	assert.Equal(t, ServiceScan{}, result)
+}
+
+func TestConvertScanToDomain_RegisteredDecoder(t *testing.T) {
+	const v3 = 3
+	RegisterDecoder(v3, func(data []byte) (string, error) {
+		var v3Data struct {
+			Banner string `json:"banner"`
+		}
+		if err := json.Unmarshal(data, &v3Data); err != nil {
+			return "", err
+		}
+		return v3Data.Banner, nil
+	})
+	defer func() {
+		decodersMu.Lock()
+		delete(decoders, v3)
+		decodersMu.Unlock()
+	}()
+
+	rawScan := scanning.Scan{
+		Ip:          "192.168.1.1",
+		Port:        8080,
+		Service:     "HTTP",
+		Timestamp:   1640995200,
+		DataVersion: v3,
+		Data: map[string]interface{}{
+			"banner": "nginx",
+		},
+	}
+
+	result, err := ConvertScanToDomain(rawScan)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "nginx", result.Response)
+}
+
+func TestConvertScanToDomain_CanonicalizesIP(t *testing.T) {
+	rawScan := scanning.Scan{
+		Ip:          "::ffff:192.168.1.1",
+		Port:        80,
+		Service:     "HTTP",
+		Timestamp:   1640995200,
+		DataVersion: scanning.V2,
+		Data:        map[string]interface{}{"response_str": "ok"},
+	}
+
+	result, err := ConvertScanToDomain(rawScan)
+
 	assert.NoError(t, err)
 	assert.Equal(t, "192.168.1.1", result.IP)
-	assert.Equal(t, uint32(8080), result.Port)
-	assert.Equal(t, "HTTP", result.Service)
-	assert.Equal(t, "", result.Response) // Empty response for nil data
-	assert.Equal(t, time.Unix(1640995200, 0), result.LastScanned)
+}
+
+func TestConvertScanToDomain_InvalidIP(t *testing.T) {
+	rawScan := scanning.Scan{
+		Ip:          "not-an-ip",
+		Port:        22,
+		Service:     "SSH",
+		Timestamp:   1640995200,
+		DataVersion: scanning.V2,
+		Data: map[string]interface{}{
+			"response_str": "SSH-2.0-OpenSSH_8.2",
+		},
+	}
+
+	result, err := ConvertScanToDomain(rawScan)
+
+	assert.ErrorIs(t, err, ErrInvalidScan)
+	assert.Equal(t, ServiceScan{}, result)
 }
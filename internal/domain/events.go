@@ -0,0 +1,55 @@
+package domain
+
+import "time"
+
+// ChangeKind classifies a ServiceChanged event
+type ChangeKind string
+
+const (
+	ChangeNew              ChangeKind = "new"
+	ChangeChanged          ChangeKind = "changed"
+	ChangeUnchangedRefresh ChangeKind = "unchanged_refresh"
+)
+
+// ServiceChanged is emitted whenever a scan wins the upsert for its
+// (ip, port, service). EventID is assigned by the outbox and lets downstream
+// consumers deduplicate redeliveries.
+type ServiceChanged struct {
+	EventID         int64      `json:"event_id"`
+	Kind            ChangeKind `json:"kind"`
+	IP              string     `json:"ip"`
+	Port            uint32     `json:"port"`
+	Service         string     `json:"service"`
+	OldResponseHash string     `json:"old_response_hash,omitempty"`
+	NewResponseHash string     `json:"new_response_hash"`
+	PreviousScanned *time.Time `json:"previous_scanned,omitempty"`
+	LastScanned     time.Time  `json:"last_scanned"`
+}
+
+// NewServiceChanged builds the event for an upsert outcome. It returns nil for
+// stale scans, which leave the stored record untouched.
+func NewServiceChanged(scan *ServiceScan, outcome UpsertOutcome, previousResponse string, previousScanned *time.Time) *ServiceChanged {
+	event := &ServiceChanged{
+		IP:              scan.IP,
+		Port:            scan.Port,
+		Service:         scan.Service,
+		NewResponseHash: HashResponse(scan.Response),
+		LastScanned:     scan.LastScanned,
+	}
+
+	switch outcome {
+	case OutcomeInserted:
+		event.Kind = ChangeNew
+		return event
+	case OutcomeUpdated:
+		event.Kind = ChangeChanged
+	case OutcomeIdentical:
+		event.Kind = ChangeUnchangedRefresh
+	default:
+		return nil
+	}
+
+	event.OldResponseHash = HashResponse(previousResponse)
+	event.PreviousScanned = previousScanned
+	return event
+}
@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewServiceChanged(t *testing.T) {
+	now := time.Unix(1640995200, 0)
+	previous := now.Add(-time.Hour)
+	scan := &ServiceScan{IP: "1.1.1.1", Port: 22, Service: "SSH", Response: "SSH-2.0-OpenSSH_9.0", LastScanned: now}
+
+	t.Run("inserted", func(t *testing.T) {
+		event := NewServiceChanged(scan, OutcomeInserted, "", nil)
+
+		assert.Equal(t, ChangeNew, event.Kind)
+		assert.Equal(t, HashResponse(scan.Response), event.NewResponseHash)
+		assert.Empty(t, event.OldResponseHash)
+		assert.Nil(t, event.PreviousScanned)
+		assert.Equal(t, now, event.LastScanned)
+	})
+
+	t.Run("updated", func(t *testing.T) {
+		event := NewServiceChanged(scan, OutcomeUpdated, "SSH-2.0-OpenSSH_8.2", &previous)
+
+		assert.Equal(t, ChangeChanged, event.Kind)
+		assert.Equal(t, HashResponse("SSH-2.0-OpenSSH_8.2"), event.OldResponseHash)
+		assert.Equal(t, &previous, event.PreviousScanned)
+	})
+
+	t.Run("identical", func(t *testing.T) {
+		event := NewServiceChanged(scan, OutcomeIdentical, scan.Response, &previous)
+
+		assert.Equal(t, ChangeUnchangedRefresh, event.Kind)
+		assert.Equal(t, event.OldResponseHash, event.NewResponseHash)
+	})
+
+	t.Run("stale", func(t *testing.T) {
+		assert.Nil(t, NewServiceChanged(scan, OutcomeStale, "", nil))
+	})
+}
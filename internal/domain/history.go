@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// ScanHistoryEntry is one period during which a service returned the same
+// response. A new entry starts whenever the response changes.
+type ScanHistoryEntry struct {
+	IP                   string    `json:"ip"`
+	Port                 uint32    `json:"port"`
+	Service              string    `json:"service"`
+	Response             string    `json:"response"`
+	ResponseHash         string    `json:"response_hash"`
+	PreviousResponseHash string    `json:"previous_response_hash,omitempty"`
+	FirstSeen            time.Time `json:"first_seen"`
+	LastSeen             time.Time `json:"last_seen"`
+}
+
+// HashResponse returns the hex encoded SHA-256 of a service response
+func HashResponse(response string) string {
+	sum := sha256.Sum256([]byte(response))
+	return hex.EncodeToString(sum[:])
+}
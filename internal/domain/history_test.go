@@ -0,0 +1,14 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashResponse(t *testing.T) {
+	hash := HashResponse("hello world")
+
+	assert.Equal(t, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", hash)
+	assert.NotEqual(t, hash, HashResponse("hello world!"))
+}
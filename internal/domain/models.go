@@ -1,6 +1,20 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+var (
+	// ErrInvalidScan is returned when a scan fails validation
+	ErrInvalidScan = errors.New("invalid scan")
+	// ErrStoreUnavailable is returned when the scan store cannot be reached,
+	// such as while the database restarts or fails over
+	ErrStoreUnavailable = errors.New("scan store unavailable")
+)
 
 // ServiceScan represents a service scan record
 type ServiceScan struct {
@@ -11,7 +25,67 @@ type ServiceScan struct {
 	LastScanned time.Time `json:"last_scanned"`
 }
 
+// ServiceKey identifies the unique (ip, port, service) a scan record is kept for
+type ServiceKey struct {
+	IP      string
+	Port    uint32
+	Service string
+}
+
+// Key returns the (ip, port, service) this scan belongs to
+func (ss *ServiceScan) Key() ServiceKey {
+	return ServiceKey{IP: ss.IP, Port: ss.Port, Service: ss.Service}
+}
+
+// Less orders keys by (ip, port, service), comparing strings byte by byte like
+// the "C" collation ListScans sorts by in Postgres
+func (k ServiceKey) Less(other ServiceKey) bool {
+	if k.IP != other.IP {
+		return k.IP < other.IP
+	}
+	if k.Port != other.Port {
+		return k.Port < other.Port
+	}
+	return k.Service < other.Service
+}
+
+// CanonicalIP returns the one spelling of ip that records are keyed by:
+// IPv4-mapped IPv6 addresses become IPv4 and IPv6 is written in RFC 5952
+// form, so 1.1.1.1 and ::ffff:1.1.1.1, or 2001:DB8:0::1 and 2001:db8::1, are
+// one record. A value that is not an address is returned unchanged.
+func CanonicalIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Zone() != "" {
+		return ip
+	}
+	return addr.Unmap().String()
+}
+
 // IsNewerThan checks if this scan is newer than the given timestamp
 func (ss *ServiceScan) IsNewerThan(timestamp time.Time) bool {
 	return ss.LastScanned.After(timestamp)
 }
+
+// Validate checks that the scan identifies a real (ip, port, service)
+func (ss *ServiceScan) Validate() error {
+	if net.ParseIP(ss.IP) == nil {
+		return fmt.Errorf("%w: ip %q is not a valid address", ErrInvalidScan, ss.IP)
+	}
+	if ss.Port == 0 || ss.Port > 65535 {
+		return fmt.Errorf("%w: port %d is out of range", ErrInvalidScan, ss.Port)
+	}
+	if ss.Service == "" {
+		return fmt.Errorf("%w: service is empty", ErrInvalidScan)
+	}
+	return nil
+}
+
+// DeadLetter records a message that can never be processed successfully
+type DeadLetter struct {
+	MessageID       string    `json:"message_id"`
+	Reason          string    `json:"reason"`
+	Error           string    `json:"error"`
+	DeliveryAttempt int       `json:"delivery_attempt"`
+	Payload         []byte    `json:"payload"`
+	FailedAt        time.Time `json:"failed_at"`
+}
@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceScan_Validate(t *testing.T) {
+	valid := ServiceScan{
+		IP:          "192.168.1.1",
+		Port:        443,
+		Service:     "HTTP",
+		LastScanned: time.Unix(1640995200, 0),
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(scan *ServiceScan)
+		wantErr bool
+	}{
+		{name: "valid IPv4", modify: func(scan *ServiceScan) {}},
+		{name: "valid IPv6", modify: func(scan *ServiceScan) { scan.IP = "2001:db8::1" }},
+		{name: "invalid IP", modify: func(scan *ServiceScan) { scan.IP = "1.1.1.256" }, wantErr: true},
+		{name: "empty IP", modify: func(scan *ServiceScan) { scan.IP = "" }, wantErr: true},
+		{name: "zero port", modify: func(scan *ServiceScan) { scan.Port = 0 }, wantErr: true},
+		{name: "port out of range", modify: func(scan *ServiceScan) { scan.Port = 70000 }, wantErr: true},
+		{name: "empty service", modify: func(scan *ServiceScan) { scan.Service = "" }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scan := valid
+			tt.modify(&scan)
+
+			err := scan.Validate()
+
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidScan)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCanonicalIP(t *testing.T) {
+	tests := map[string]string{
+		"1.1.1.1":        "1.1.1.1",
+		"::ffff:1.1.1.1": "1.1.1.1",
+		"2001:DB8:0::1":  "2001:db8::1",
+		"2001:db8::1":    "2001:db8::1",
+		"fe80::1%eth0":   "fe80::1%eth0",
+		"not-an-ip":      "not-an-ip",
+	}
+
+	for ip, want := range tests {
+		assert.Equal(t, want, CanonicalIP(ip), ip)
+	}
+}
+
+func TestServiceKey_Less(t *testing.T) {
+	ordered := []ServiceKey{
+		{IP: "1.1.1.10", Port: 80, Service: "HTTP"},
+		{IP: "1.1.1.2", Port: 22, Service: "SSH"},
+		{IP: "1.1.1.2", Port: 80, Service: "HTTP"},
+		{IP: "1.1.1.2", Port: 80, Service: "dns"},
+	}
+
+	for i := 1; i < len(ordered); i++ {
+		assert.True(t, ordered[i-1].Less(ordered[i]), "%v < %v", ordered[i-1], ordered[i])
+		assert.False(t, ordered[i].Less(ordered[i-1]), "%v < %v", ordered[i], ordered[i-1])
+	}
+	assert.False(t, ordered[0].Less(ordered[0]))
+}
@@ -0,0 +1,47 @@
+package domain
+
+// UpsertOutcome describes what an upsert actually did to the stored record
+type UpsertOutcome int
+
+const (
+	// OutcomeInserted means the scan created the record for its (ip, port, service)
+	OutcomeInserted UpsertOutcome = iota + 1
+	// OutcomeUpdated means the scan was newer and changed the stored response
+	OutcomeUpdated
+	// OutcomeIdentical means the scan was newer but had the same response, so
+	// only the last scanned time moved forward
+	OutcomeIdentical
+	// OutcomeStale means the stored record was at least as new and the scan was skipped
+	OutcomeStale
+)
+
+func (o UpsertOutcome) String() string {
+	switch o {
+	case OutcomeInserted:
+		return "inserted"
+	case OutcomeUpdated:
+		return "updated"
+	case OutcomeIdentical:
+		return "identical"
+	case OutcomeStale:
+		return "stale"
+	default:
+		return "unknown"
+	}
+}
+
+// ClassifyUpsert derives the outcome of an upsert from what the database
+// reported: whether a row was written at all, whether it was newly inserted,
+// and the response it held before the write
+func ClassifyUpsert(written, inserted bool, previousResponse, newResponse string) UpsertOutcome {
+	switch {
+	case !written:
+		return OutcomeStale
+	case inserted:
+		return OutcomeInserted
+	case previousResponse == newResponse:
+		return OutcomeIdentical
+	default:
+		return OutcomeUpdated
+	}
+}
@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyUpsert(t *testing.T) {
+	tests := []struct {
+		name             string
+		written          bool
+		inserted         bool
+		previousResponse string
+		want             UpsertOutcome
+	}{
+		{name: "no row written", written: false, want: OutcomeStale},
+		{name: "new row", written: true, inserted: true, want: OutcomeInserted},
+		{name: "changed response", written: true, previousResponse: "old", want: OutcomeUpdated},
+		{name: "same response", written: true, previousResponse: "new", want: OutcomeIdentical},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ClassifyUpsert(tt.written, tt.inserted, tt.previousResponse, "new")
+
+			assert.Equal(t, tt.want, got)
+			assert.NotEqual(t, "unknown", got.String())
+		})
+	}
+}
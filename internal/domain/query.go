@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+// ErrInvalidFilter is returned when a ScanFilter cannot be satisfied
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// IPFamily restricts a query to IPv4 or IPv6 addresses
+type IPFamily int
+
+const (
+	AnyFamily IPFamily = 0
+	IPv4      IPFamily = 4
+	IPv6      IPFamily = 6
+)
+
+// ScanFilter selects stored service records. Zero values match everything.
+type ScanFilter struct {
+	IP      string
+	Port    uint32
+	Service string
+	// Network matches addresses inside a CIDR block
+	Network netip.Prefix
+	// RangeStart and RangeEnd match addresses in an inclusive range
+	RangeStart    netip.Addr
+	RangeEnd      netip.Addr
+	Family        IPFamily
+	ScannedAfter  time.Time
+	ScannedBefore time.Time
+	// After continues a listing from the record following this key
+	After *ServiceKey
+	Limit int
+}
+
+// Validate checks that the address criteria of the filter are consistent
+func (f *ScanFilter) Validate() error {
+	if f.RangeStart.IsValid() != f.RangeEnd.IsValid() {
+		return fmt.Errorf("%w: an IP range needs both a start and an end", ErrInvalidFilter)
+	}
+	if f.RangeStart.IsValid() {
+		if f.RangeStart.Is4() != f.RangeEnd.Is4() {
+			return fmt.Errorf("%w: IP range %s - %s mixes address families", ErrInvalidFilter, f.RangeStart, f.RangeEnd)
+		}
+		if f.RangeEnd.Less(f.RangeStart) {
+			return fmt.Errorf("%w: IP range %s - %s ends before it starts", ErrInvalidFilter, f.RangeStart, f.RangeEnd)
+		}
+	}
+	if f.Family != AnyFamily && f.Family != IPv4 && f.Family != IPv6 {
+		return fmt.Errorf("%w: IP family must be 4 or 6", ErrInvalidFilter)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanFilter_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  ScanFilter
+		wantErr bool
+	}{
+		{name: "empty", filter: ScanFilter{}},
+		{name: "cidr", filter: ScanFilter{Network: netip.MustParsePrefix("1.1.1.0/24")}},
+		{
+			name:   "ipv4 range",
+			filter: ScanFilter{RangeStart: netip.MustParseAddr("1.1.1.1"), RangeEnd: netip.MustParseAddr("1.1.1.9")},
+		},
+		{
+			name:    "open range",
+			filter:  ScanFilter{RangeStart: netip.MustParseAddr("1.1.1.1")},
+			wantErr: true,
+		},
+		{
+			name:    "mixed family range",
+			filter:  ScanFilter{RangeStart: netip.MustParseAddr("1.1.1.1"), RangeEnd: netip.MustParseAddr("2001:db8::1")},
+			wantErr: true,
+		},
+		{
+			name:    "reversed range",
+			filter:  ScanFilter{RangeStart: netip.MustParseAddr("1.1.1.9"), RangeEnd: netip.MustParseAddr("1.1.1.1")},
+			wantErr: true,
+		},
+		{name: "ipv6 family", filter: ScanFilter{Family: IPv6}},
+		{name: "unknown family", filter: ScanFilter{Family: 5}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.filter.Validate()
+
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidFilter)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+func TestFilePublisher_Publish_AppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changes.jsonl")
+
+	publisher, err := NewFilePublisher(path)
+	require.NoError(t, err)
+
+	first := &domain.ServiceChanged{EventID: 1, Kind: domain.ChangeNew, IP: "1.1.1.1", Port: 22, Service: "SSH"}
+	second := &domain.ServiceChanged{EventID: 2, Kind: domain.ChangeChanged, IP: "1.1.1.1", Port: 22, Service: "SSH"}
+	require.NoError(t, publisher.Publish(context.Background(), first))
+	require.NoError(t, publisher.Publish(context.Background(), second))
+	require.NoError(t, publisher.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var written []domain.ServiceChanged
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event domain.ServiceChanged
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		written = append(written, event)
+	}
+
+	assert.Equal(t, []domain.ServiceChanged{*first, *second}, written)
+}
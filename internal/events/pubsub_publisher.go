@@ -0,0 +1,55 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"cloud.google.com/go/pubsub"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+type PubSubPublisher struct {
+	client *pubsub.Client
+	topic  *pubsub.Topic
+}
+
+func NewPubSubPublisher(ctx context.Context, projectID, topicID string) (*PubSubPublisher, error) {
+	client, err := pubsub.NewClient(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PubSubPublisher{
+		client: client,
+		topic:  client.Topic(topicID),
+	}, nil
+}
+
+func (p *PubSubPublisher) Publish(ctx context.Context, event *domain.ServiceChanged) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	msg := &pubsub.Message{
+		Data: data,
+		Attributes: map[string]string{
+			"event_id": strconv.FormatInt(event.EventID, 10),
+			"kind":     string(event.Kind),
+		},
+	}
+
+	if _, err := p.topic.Publish(ctx, msg).Get(ctx); err != nil {
+		return fmt.Errorf("failed to publish change event: %w", err)
+	}
+
+	return nil
+}
+
+func (p *PubSubPublisher) Close() error {
+	p.topic.Stop()
+	return p.client.Close()
+}
@@ -0,0 +1,94 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+//go:generate mockgen -source=relay.go -destination=../mocks/mock_outbox_store.go -package=mocks
+
+// Publisher delivers a ServiceChanged event to a downstream sink
+type Publisher interface {
+	Publish(ctx context.Context, event *domain.ServiceChanged) error
+}
+
+// OutboxStore hands pending outbox events to a publish function and records
+// which of them were delivered
+type OutboxStore interface {
+	PublishPending(ctx context.Context, limit int, publish func(ctx context.Context, event *domain.ServiceChanged) error) (int, error)
+}
+
+type RelayConfig struct {
+	// PollInterval bounds how long an event waits when no notification arrives
+	PollInterval time.Duration
+	// BatchSize is the number of events locked and published per transaction
+	BatchSize int
+}
+
+// OutboxRelay moves events from the transactional outbox to a Publisher.
+// Events are delivered at least once: a crash between publishing and marking
+// an event published causes it to be sent again.
+type OutboxRelay struct {
+	store     OutboxStore
+	publisher Publisher
+	config    RelayConfig
+	wake      chan struct{}
+}
+
+func NewOutboxRelay(store OutboxStore, publisher Publisher, config RelayConfig) *OutboxRelay {
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.BatchSize < 1 {
+		config.BatchSize = 100
+	}
+
+	return &OutboxRelay{
+		store:     store,
+		publisher: publisher,
+		config:    config,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes the relay without waiting for the next poll. It never blocks.
+func (r *OutboxRelay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes pending events until ctx is cancelled
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.drain(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// drain keeps publishing full batches until the outbox is empty or a publish fails
+func (r *OutboxRelay) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		published, err := r.store.PublishPending(ctx, r.config.BatchSize, r.publisher.Publish)
+		if err != nil {
+			slog.Error("Failed to relay change events", "error", err)
+			return
+		}
+		if published < r.config.BatchSize {
+			return
+		}
+	}
+}
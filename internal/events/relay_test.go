@@ -0,0 +1,99 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/mocks"
+)
+
+type publishFunc = func(ctx context.Context, event *domain.ServiceChanged) error
+
+func TestOutboxRelay_Run_PublishesPendingEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := mocks.NewMockOutboxStore(ctrl)
+	mockPublisher := mocks.NewMockPublisher(ctrl)
+	relay := NewOutboxRelay(mockStore, mockPublisher, RelayConfig{PollInterval: time.Hour, BatchSize: 10})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	event := &domain.ServiceChanged{EventID: 1, Kind: domain.ChangeNew, IP: "1.1.1.1", Port: 22, Service: "SSH"}
+
+	mockStore.EXPECT().
+		PublishPending(gomock.Any(), 10, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, limit int, publish publishFunc) (int, error) {
+			cancel()
+			return 1, publish(ctx, event)
+		})
+	mockPublisher.EXPECT().Publish(gomock.Any(), event).Return(nil)
+
+	relay.Run(ctx)
+}
+
+func TestOutboxRelay_Run_DrainsFullBatches(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := mocks.NewMockOutboxStore(ctrl)
+	mockPublisher := mocks.NewMockPublisher(ctrl)
+	relay := NewOutboxRelay(mockStore, mockPublisher, RelayConfig{PollInterval: time.Hour, BatchSize: 2})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	gomock.InOrder(
+		mockStore.EXPECT().PublishPending(gomock.Any(), 2, gomock.Any()).Return(2, nil),
+		mockStore.EXPECT().PublishPending(gomock.Any(), 2, gomock.Any()).Return(2, nil),
+		mockStore.EXPECT().
+			PublishPending(gomock.Any(), 2, gomock.Any()).
+			DoAndReturn(func(ctx context.Context, limit int, publish publishFunc) (int, error) {
+				cancel()
+				return 1, nil
+			}),
+	)
+
+	relay.Run(ctx)
+}
+
+func TestOutboxRelay_Notify_WakesRelay(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStore := mocks.NewMockOutboxStore(ctrl)
+	mockPublisher := mocks.NewMockPublisher(ctrl)
+	relay := NewOutboxRelay(mockStore, mockPublisher, RelayConfig{PollInterval: time.Hour, BatchSize: 10})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	woken := make(chan struct{})
+	gomock.InOrder(
+		mockStore.EXPECT().
+			PublishPending(gomock.Any(), 10, gomock.Any()).
+			DoAndReturn(func(ctx context.Context, limit int, publish publishFunc) (int, error) {
+				close(woken)
+				return 0, nil
+			}),
+		mockStore.EXPECT().
+			PublishPending(gomock.Any(), 10, gomock.Any()).
+			DoAndReturn(func(ctx context.Context, limit int, publish publishFunc) (int, error) {
+				cancel()
+				return 0, nil
+			}),
+	)
+
+	go func() {
+		<-woken
+		relay.Notify()
+		relay.Notify() // never blocks, even when a wake-up is already pending
+	}()
+
+	relay.Run(ctx)
+}
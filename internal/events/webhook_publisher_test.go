@@ -0,0 +1,48 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+func TestWebhookPublisher_Publish_PostsEvent(t *testing.T) {
+	var received domain.ServiceChanged
+	var eventID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		eventID = r.Header.Get("X-Event-Id")
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	publisher := NewWebhookPublisher(server.URL, time.Second)
+	event := &domain.ServiceChanged{EventID: 42, Kind: domain.ChangeChanged, IP: "1.1.1.1", Port: 80, Service: "HTTP"}
+
+	err := publisher.Publish(context.Background(), event)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "42", eventID)
+	assert.Equal(t, *event, received)
+}
+
+func TestWebhookPublisher_Publish_FailsOnErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	publisher := NewWebhookPublisher(server.URL, time.Second)
+
+	err := publisher.Publish(context.Background(), &domain.ServiceChanged{EventID: 1})
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+// Reasons attached to permanent failures so dead letters can be grouped
+const (
+	ReasonMalformedJSON          = "malformed_json"
+	ReasonUnsupportedDataVersion = "unsupported_data_version"
+	ReasonMalformedData          = "malformed_data"
+	ReasonInvalidScan            = "invalid_scan"
+)
+
+// PermanentError marks a message that will fail no matter how many times it
+// is redelivered. Any other error returned by the handler is treated as
+// transient.
+type PermanentError struct {
+	Reason string
+	Err    error
+}
+
+func (e *PermanentError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Reason, e.Err)
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// IsPermanent reports whether err, or any error it wraps, is a PermanentError
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// PermanentReason returns the reason of a PermanentError in err's chain, or an
+// empty string if there is none
+func PermanentReason(err error) string {
+	var permanent *PermanentError
+	if errors.As(err, &permanent) {
+		return permanent.Reason
+	}
+	return ""
+}
+
+// conversionFailureReason maps a domain conversion error to its dead-letter reason
+func conversionFailureReason(err error) string {
+	switch {
+	case errors.Is(err, domain.ErrUnsupportedDataVersion):
+		return ReasonUnsupportedDataVersion
+	case errors.Is(err, domain.ErrMalformedData):
+		return ReasonMalformedData
+	default:
+		return ReasonInvalidScan
+	}
+}
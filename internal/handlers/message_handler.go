@@ -3,14 +3,22 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/logging"
+	"github.com/censys/scan-takehome/internal/metrics"
+	"github.com/censys/scan-takehome/internal/tracing"
 	"github.com/censys/scan-takehome/pkg/scanning"
 )
 
+//go:generate mockgen -source=message_handler.go -destination=../mocks/mock_scan_processor.go -package=mocks
+
 type ScanProcessor interface {
-	ProcessScanResult(ctx context.Context, scan *domain.ServiceScan) error
+	ProcessScanResult(ctx context.Context, scan *domain.ServiceScan) (domain.UpsertOutcome, error)
 }
 
 type MessageHandler struct {
@@ -23,18 +31,51 @@ func NewMessageHandler(processor ScanProcessor) *MessageHandler {
 	}
 }
 
-func (mh *MessageHandler) HandleMessage(ctx context.Context, msgData []byte) error {
+func (mh *MessageHandler) HandleMessage(ctx context.Context, msgData []byte) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "MessageHandler.HandleMessage")
+	defer func() { tracing.End(span, err) }()
+
 	var rawScan scanning.Scan
 	if err := json.Unmarshal(msgData, &rawScan); err != nil {
-		log.Printf("Failed to parse message: %v", err)
-		return err
+		logging.FromContext(ctx).Warn("Failed to parse message", "error", err)
+		metrics.DecodedMessages.WithLabelValues("unknown", metrics.DecodeMalformed).Inc()
+		return &PermanentError{Reason: ReasonMalformedJSON, Err: err}
 	}
 
+	ctx = logging.With(ctx,
+		"ip", rawScan.Ip, "port", rawScan.Port, "service", rawScan.Service, "data_version", rawScan.DataVersion)
+	span.SetAttributes(
+		attribute.String("scan.ip", rawScan.Ip),
+		attribute.Int64("scan.port", int64(rawScan.Port)),
+		attribute.String("scan.service", rawScan.Service),
+		attribute.Int("scan.data_version", rawScan.DataVersion),
+	)
+
 	scan, err := domain.ConvertScanToDomain(rawScan)
 	if err != nil {
-		log.Printf("Failed to convert message to domain model: %v", err)
-		return err
+		logging.FromContext(ctx).Warn("Failed to convert message to domain model", "error", err)
+		recordDecode(rawScan.DataVersion, err)
+		return &PermanentError{Reason: conversionFailureReason(err), Err: err}
 	}
+	recordDecode(rawScan.DataVersion, nil)
 
-	return mh.processor.ProcessScanResult(ctx, &scan)
+	_, err = mh.processor.ProcessScanResult(ctx, &scan)
+	return err
+}
+
+// recordDecode counts a decode attempt. Unsupported versions share one label
+// so arbitrary data_version values cannot grow the metric without bound.
+func recordDecode(dataVersion int, err error) {
+	version := strconv.Itoa(dataVersion)
+	result := metrics.DecodeOK
+	switch {
+	case errors.Is(err, domain.ErrUnsupportedDataVersion):
+		version = "unsupported"
+		result = metrics.DecodeUnsupported
+	case errors.Is(err, domain.ErrMalformedData):
+		result = metrics.DecodeMalformed
+	case err != nil:
+		result = metrics.DecodeInvalid
+	}
+	metrics.DecodedMessages.WithLabelValues(version, result).Inc()
 }
@@ -1,15 +1,20 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"log/slog"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/logging"
+	"github.com/censys/scan-takehome/internal/metrics"
 	"github.com/censys/scan-takehome/internal/mocks"
 	"github.com/censys/scan-takehome/pkg/scanning"
 )
@@ -61,7 +66,7 @@ func TestMessageHandler_HandleMessage_Success(t *testing.T) {
 				t.Errorf("Expected Response %s, got %s", expectedScanResult.Response, scan.Response)
 			}
 		}).
-		Return(nil)
+		Return(domain.OutcomeInserted, nil)
 
 	err = handler.HandleMessage(context.Background(), msgData)
 	if err != nil {
@@ -103,7 +108,7 @@ func TestMessageHandler_HandleMessage_V1Data_Success(t *testing.T) {
 				t.Errorf("Expected Response SSH-2.0-OpenSSH_8.2, got %s", scan.Response)
 			}
 		}).
-		Return(nil)
+		Return(domain.OutcomeInserted, nil)
 
 	err := handler.HandleMessage(context.Background(), msgData)
 	if err != nil {
@@ -124,6 +129,30 @@ func TestMessageHandler_HandleMessage_InvalidJSON(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error for invalid JSON, got nil")
 	}
+	assert.True(t, IsPermanent(err))
+	assert.Equal(t, ReasonMalformedJSON, PermanentReason(err))
+}
+
+func TestMessageHandler_HandleMessage_InvalidScan(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockProcessor := mocks.NewMockScanProcessor(ctrl)
+	handler := NewMessageHandler(mockProcessor)
+
+	msgData := []byte(`{
+		"ip": "not-an-ip",
+		"port": 0,
+		"service": "SSH",
+		"timestamp": 1640995200,
+		"data_version": 2,
+		"data": {"response_str": "SSH-2.0-OpenSSH_8.2"}
+	}`)
+
+	err := handler.HandleMessage(context.Background(), msgData)
+
+	assert.True(t, IsPermanent(err))
+	assert.Equal(t, ReasonInvalidScan, PermanentReason(err))
 }
 
 func TestMessageHandler_HandleMessage_ProcessorError(t *testing.T) {
@@ -151,12 +180,13 @@ func TestMessageHandler_HandleMessage_ProcessorError(t *testing.T) {
 
 	mockProcessor.EXPECT().
 		ProcessScanResult(gomock.Any(), gomock.Any()).
-		Return(assert.AnError)
+		Return(domain.UpsertOutcome(0), assert.AnError)
 
 	err = handler.HandleMessage(context.Background(), msgData)
 	if err == nil {
 		t.Error("Expected error from processor, got nil")
 	}
+	assert.False(t, IsPermanent(err))
 }
 
 func TestMessageHandler_HandleMessage_UnknownDataVersion(t *testing.T) {
@@ -180,17 +210,83 @@ func TestMessageHandler_HandleMessage_UnknownDataVersion(t *testing.T) {
 		t.Fatalf("Failed to marshal scan: %v", err)
 	}
 
+	err = handler.HandleMessage(context.Background(), msgData)
+
+	assert.ErrorIs(t, err, domain.ErrUnsupportedDataVersion)
+	assert.True(t, IsPermanent(err))
+	assert.Equal(t, ReasonUnsupportedDataVersion, PermanentReason(err))
+}
+
+func TestMessageHandler_HandleMessage_MalformedData(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockProcessor := mocks.NewMockScanProcessor(ctrl)
+	handler := NewMessageHandler(mockProcessor)
+
+	msgData := []byte(`{
+		"ip": "10.0.0.1",
+		"port": 22,
+		"service": "SSH",
+		"timestamp": 1640995200,
+		"data_version": 1,
+		"data": {"response_bytes_utf8": "invalid-base64!"}
+	}`)
+
+	err := handler.HandleMessage(context.Background(), msgData)
+
+	assert.ErrorIs(t, err, domain.ErrMalformedData)
+	assert.Equal(t, ReasonMalformedData, PermanentReason(err))
+}
+
+func TestMessageHandler_HandleMessage_CountsDecodesByVersion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockProcessor := mocks.NewMockScanProcessor(ctrl)
+	handler := NewMessageHandler(mockProcessor)
+
+	decoded := metrics.DecodedMessages.WithLabelValues("2", metrics.DecodeOK)
+	unsupported := metrics.DecodedMessages.WithLabelValues("unsupported", metrics.DecodeUnsupported)
+	decodedBefore := testutil.ToFloat64(decoded)
+	unsupportedBefore := testutil.ToFloat64(unsupported)
+
 	mockProcessor.EXPECT().
 		ProcessScanResult(gomock.Any(), gomock.Any()).
-		Do(func(ctx context.Context, scan *domain.ServiceScan) {
-			if scan.Response != "" {
-				t.Errorf("Expected empty response for unknown data version, got %s", scan.Response)
-			}
-		}).
-		Return(nil)
+		Return(domain.OutcomeInserted, nil)
 
-	err = handler.HandleMessage(context.Background(), msgData)
-	if err != nil {
-		t.Errorf("Expected no error, got %v", err)
-	}
+	err := handler.HandleMessage(context.Background(),
+		[]byte(`{"ip":"1.1.1.1","port":80,"service":"HTTP","timestamp":1,"data_version":2,"data":{"response_str":"ok"}}`))
+	assert.NoError(t, err)
+
+	err = handler.HandleMessage(context.Background(),
+		[]byte(`{"ip":"1.1.1.1","port":80,"service":"HTTP","timestamp":1,"data_version":99,"data":{}}`))
+	assert.Error(t, err)
+
+	assert.Equal(t, decodedBefore+1, testutil.ToFloat64(decoded))
+	assert.Equal(t, unsupportedBefore+1, testutil.ToFloat64(unsupported))
+}
+
+func TestMessageHandler_HandleMessage_TagsLoggerWithScan(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockProcessor := mocks.NewMockScanProcessor(ctrl)
+	handler := NewMessageHandler(mockProcessor)
+
+	var buf bytes.Buffer
+	ctx := logging.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	mockProcessor.EXPECT().
+		ProcessScanResult(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, scan *domain.ServiceScan) (domain.UpsertOutcome, error) {
+			logging.FromContext(ctx).Info("processed")
+			return domain.OutcomeInserted, nil
+		})
+
+	err := handler.HandleMessage(ctx,
+		[]byte(`{"ip":"1.1.1.1","port":80,"service":"HTTP","timestamp":1,"data_version":2,"data":{"response_str":"ok"}}`))
+
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), `"ip":"1.1.1.1","port":80,"service":"HTTP","data_version":2`)
 }
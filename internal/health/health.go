@@ -0,0 +1,105 @@
+// Package health serves liveness and readiness probes built from named checks
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// checkTimeout bounds each check so a hung dependency cannot stall a probe
+const checkTimeout = 2 * time.Second
+
+// Check returns nil when the component it inspects is healthy
+type Check func(ctx context.Context) error
+
+// Response is the body of a probe: overall status plus the result of each check
+type Response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Probes holds the checks behind /healthz and /readyz. Liveness checks should
+// only fail when restarting the process would help; readiness checks fail
+// whenever the process should not be given work.
+type Probes struct {
+	mu        sync.RWMutex
+	liveness  map[string]Check
+	readiness map[string]Check
+}
+
+func NewProbes() *Probes {
+	return &Probes{
+		liveness:  make(map[string]Check),
+		readiness: make(map[string]Check),
+	}
+}
+
+// AddLivenessCheck registers a check for /healthz
+func (p *Probes) AddLivenessCheck(name string, check Check) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.liveness[name] = check
+}
+
+// AddReadinessCheck registers a check for /readyz
+func (p *Probes) AddReadinessCheck(name string, check Check) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readiness[name] = check
+}
+
+// Register mounts /healthz and /readyz on mux
+func (p *Probes) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		p.serve(w, r, p.snapshot(p.liveness))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		p.serve(w, r, p.snapshot(p.readiness))
+	})
+}
+
+// snapshot copies one set of checks so they run without holding the lock
+func (p *Probes) snapshot(registered map[string]Check) map[string]Check {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	checks := make(map[string]Check, len(registered))
+	for name, check := range registered {
+		checks[name] = check
+	}
+	return checks
+}
+
+func (p *Probes) serve(w http.ResponseWriter, r *http.Request, checks map[string]Check) {
+	response := Response{Status: "ok", Checks: make(map[string]string, len(checks))}
+	status := http.StatusOK
+
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		err := checks[name](ctx)
+		cancel()
+
+		if err != nil {
+			response.Checks[name] = err.Error()
+			response.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		response.Checks[name] = "ok"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,71 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func probe(probes *Probes, path string) (*httptest.ResponseRecorder, Response) {
+	mux := http.NewServeMux()
+	probes.Register(mux)
+
+	resp := httptest.NewRecorder()
+	mux.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var body Response
+	_ = json.Unmarshal(resp.Body.Bytes(), &body)
+	return resp, body
+}
+
+func TestProbes_AllChecksPass(t *testing.T) {
+	probes := NewProbes()
+	probes.AddReadinessCheck("database", func(ctx context.Context) error { return nil })
+
+	resp, body := probe(probes, "/readyz")
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, Response{Status: "ok", Checks: map[string]string{"database": "ok"}}, body)
+}
+
+func TestProbes_FailingCheckReportsUnavailable(t *testing.T) {
+	probes := NewProbes()
+	probes.AddReadinessCheck("database", func(ctx context.Context) error { return nil })
+	probes.AddReadinessCheck("receiver", func(ctx context.Context) error { return errors.New("draining") })
+
+	resp, body := probe(probes, "/readyz")
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, "unavailable", body.Status)
+	assert.Equal(t, "draining", body.Checks["receiver"])
+	assert.Equal(t, "ok", body.Checks["database"])
+}
+
+func TestProbes_LivenessIgnoresReadinessChecks(t *testing.T) {
+	probes := NewProbes()
+	probes.AddReadinessCheck("database", func(ctx context.Context) error { return errors.New("down") })
+
+	resp, body := probe(probes, "/healthz")
+
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "ok", body.Status)
+}
+
+func TestProbes_CheckHasDeadline(t *testing.T) {
+	probes := NewProbes()
+	probes.AddLivenessCheck("slow", func(ctx context.Context) error {
+		_, ok := ctx.Deadline()
+		assert.True(t, ok)
+		return nil
+	})
+
+	resp, _ := probe(probes, "/healthz")
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
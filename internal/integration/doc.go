@@ -0,0 +1,5 @@
+// Package integration holds end-to-end tests that run the real ScanWorker
+// against the pstest Pub/Sub fake and a storage backend. The in-memory
+// repository is always used; Postgres is added when TEST_DATABASE_DSN points
+// at a scratch database, which the tests migrate and empty.
+package integration
@@ -0,0 +1,301 @@
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/censys/scan-takehome/internal/db"
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/handlers"
+	"github.com/censys/scan-takehome/internal/repositories"
+	"github.com/censys/scan-takehome/internal/services"
+	"github.com/censys/scan-takehome/internal/workers"
+	"github.com/censys/scan-takehome/pkg/scanning"
+)
+
+const (
+	project      = "test-project"
+	topicID      = "scans"
+	subscription = "scans-sub"
+)
+
+// repository is what the suite needs from a storage backend
+type repository interface {
+	services.ScanRepository
+	ListScans(ctx context.Context, filter domain.ScanFilter) ([]domain.ServiceScan, error)
+}
+
+// backend is one storage backend under test. Each call of newBackend starts
+// from an empty store.
+type backend struct {
+	repo        repository
+	deadLetters workers.DeadLetterSink
+	// reasons returns the reason of every dead letter, sorted
+	reasons func(t *testing.T) []string
+}
+
+type backendFactory func(t *testing.T) backend
+
+func backends(t *testing.T) map[string]backendFactory {
+	factories := map[string]backendFactory{
+		"memory": func(t *testing.T) backend {
+			repo := repositories.NewMemoryRepository()
+			return backend{repo: repo, deadLetters: repo, reasons: func(t *testing.T) []string {
+				var reasons []string
+				for _, deadLetter := range repo.DeadLetters() {
+					reasons = append(reasons, deadLetter.Reason)
+				}
+				sort.Strings(reasons)
+				return reasons
+			}}
+		},
+	}
+
+	if dsn := os.Getenv("TEST_DATABASE_DSN"); dsn != "" {
+		database := openPostgres(t, dsn)
+		factories["postgres"] = func(t *testing.T) backend {
+			_, err := database.ExecContext(context.Background(), `TRUNCATE service_scans, service_scan_history, dead_letters`)
+			require.NoError(t, err)
+			return backend{
+				repo:        repositories.NewPostgresRepository(database),
+				deadLetters: repositories.NewPostgresDeadLetterRepository(database),
+				reasons: func(t *testing.T) []string {
+					rows, err := database.QueryContext(context.Background(), `SELECT reason FROM dead_letters ORDER BY reason`)
+					require.NoError(t, err)
+					defer rows.Close()
+
+					var reasons []string
+					for rows.Next() {
+						var reason string
+						require.NoError(t, rows.Scan(&reason))
+						reasons = append(reasons, reason)
+					}
+					require.NoError(t, rows.Err())
+					return reasons
+				},
+			}
+		}
+	}
+	return factories
+}
+
+func openPostgres(t *testing.T, dsn string) *sql.DB {
+	ctx := context.Background()
+	database, err := db.Open(ctx, db.Config{DSN: dsn})
+	require.NoError(t, err)
+	t.Cleanup(func() { database.Close() })
+
+	migrator, err := db.NewMigrator(database)
+	require.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	return database
+}
+
+// fakePubSub is a pstest server with a topic and subscription, and a client
+// connected to it
+type fakePubSub struct {
+	server *pstest.Server
+	client *pubsub.Client
+	topic  *pubsub.Topic
+}
+
+func newFakePubSub(t *testing.T) *fakePubSub {
+	t.Helper()
+	ctx := context.Background()
+
+	server := pstest.NewServer()
+	t.Cleanup(func() { server.Close() })
+
+	conn, err := grpc.Dial(server.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	client, err := pubsub.NewClient(ctx, project, option.WithGRPCConn(conn))
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	topic, err := client.CreateTopic(ctx, topicID)
+	require.NoError(t, err)
+	t.Cleanup(topic.Stop)
+	_, err = client.CreateSubscription(ctx, subscription, pubsub.SubscriptionConfig{Topic: topic})
+	require.NoError(t, err)
+
+	return &fakePubSub{server: server, client: client, topic: topic}
+}
+
+// publish sends data as one message and returns its ID
+func (f *fakePubSub) publish(t *testing.T, data []byte) string {
+	t.Helper()
+	id, err := f.topic.Publish(context.Background(), &pubsub.Message{Data: data}).Get(context.Background())
+	require.NoError(t, err)
+	return id
+}
+
+// allAcked reports whether every published message has been acked
+func (f *fakePubSub) allAcked() bool {
+	for _, msg := range f.server.Messages() {
+		if msg.Acks == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func encode(t *testing.T, scan scanning.Scan) []byte {
+	t.Helper()
+	data, err := json.Marshal(scan)
+	require.NoError(t, err)
+	return data
+}
+
+func v1Scan(t *testing.T, ip string, port uint32, service string, timestamp int64, response string) []byte {
+	return encode(t, scanning.Scan{
+		Ip: ip, Port: port, Service: service, Timestamp: timestamp,
+		DataVersion: scanning.V1,
+		Data:        scanning.V1Data{ResponseBytesUtf8: []byte(response)},
+	})
+}
+
+func v2Scan(t *testing.T, ip string, port uint32, service string, timestamp int64, response string) []byte {
+	return encode(t, scanning.Scan{
+		Ip: ip, Port: port, Service: service, Timestamp: timestamp,
+		DataVersion: scanning.V2,
+		Data:        scanning.V2Data{ResponseStr: response},
+	})
+}
+
+// runWorker runs a worker built from config until every published message
+// is acked, then shuts it down
+func runWorker(t *testing.T, fake *fakePubSub, config workers.Config) {
+	t.Helper()
+	config.ShutdownGrace = 5 * time.Second
+	worker, err := workers.NewPubSubScanWorker(fake.client, subscription, config)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- worker.Start(ctx) }()
+
+	assert.Eventually(t, fake.allAcked, 10*time.Second, 10*time.Millisecond, "messages were not all acked")
+	cancel()
+	require.NoError(t, <-done)
+	require.NoError(t, worker.Stop())
+}
+
+var batchModes = map[string]services.BatchConfig{
+	"unbatched": {MaxSize: 1},
+	"batched":   {MaxSize: 10, MaxWait: 20 * time.Millisecond, Concurrency: 2},
+}
+
+func TestScanWorker_EndToEnd(t *testing.T) {
+	for name, newBackend := range backends(t) {
+		for mode, batch := range batchModes {
+			t.Run(name+"/"+mode, func(t *testing.T) {
+				store := newBackend(t)
+				fake := newFakePubSub(t)
+
+				fake.publish(t, v1Scan(t, "1.1.1.1", 80, "HTTP", 1700000000, "HTTP/1.1 200 OK"))
+				duplicate := v2Scan(t, "1.1.1.2", 22, "SSH", 1700000000, "SSH-2.0-OpenSSH_9.6")
+				fake.publish(t, duplicate)
+				fake.publish(t, duplicate)
+				// The newer scan is published first and must survive the older one
+				fake.publish(t, v2Scan(t, "1.1.1.3", 443, "HTTPS", 1700000200, "new"))
+				fake.publish(t, v2Scan(t, "1.1.1.3", 443, "HTTPS", 1700000100, "old"))
+				fake.publish(t, []byte(`{"ip": "1.1.1.4", "port":`))
+				fake.publish(t, encode(t, scanning.Scan{Ip: "1.1.1.5", Port: 80, Service: "HTTP", Timestamp: 1700000000, DataVersion: 9}))
+
+				runWorker(t, fake, workers.Config{
+					Repository:  store.repo,
+					DeadLetters: store.deadLetters,
+					Batch:       batch,
+				})
+
+				scans, err := store.repo.ListScans(context.Background(), domain.ScanFilter{})
+				require.NoError(t, err)
+				assert.Equal(t, []domain.ServiceScan{
+					{IP: "1.1.1.1", Port: 80, Service: "HTTP", Response: "HTTP/1.1 200 OK", LastScanned: time.Unix(1700000000, 0).UTC()},
+					{IP: "1.1.1.2", Port: 22, Service: "SSH", Response: "SSH-2.0-OpenSSH_9.6", LastScanned: time.Unix(1700000000, 0).UTC()},
+					{IP: "1.1.1.3", Port: 443, Service: "HTTPS", Response: "new", LastScanned: time.Unix(1700000200, 0).UTC()},
+				}, normalize(scans))
+
+				assert.Equal(t, []string{handlers.ReasonMalformedJSON, handlers.ReasonUnsupportedDataVersion}, store.reasons(t))
+				for _, msg := range fake.server.Messages() {
+					assert.Equal(t, 1, msg.Acks, "message %s was acked more than once", msg.ID)
+				}
+			})
+		}
+	}
+}
+
+// flakyRepository fails writes with ErrStoreUnavailable until failures runs out
+type flakyRepository struct {
+	repository
+	failures atomic.Int32
+}
+
+func (r *flakyRepository) UpsertScan(ctx context.Context, scan *domain.ServiceScan) (domain.UpsertOutcome, error) {
+	if r.failures.Add(-1) >= 0 {
+		return 0, domain.ErrStoreUnavailable
+	}
+	return r.repository.UpsertScan(ctx, scan)
+}
+
+func (r *flakyRepository) UpsertScans(ctx context.Context, scans []*domain.ServiceScan) ([]domain.UpsertOutcome, error) {
+	if r.failures.Add(-1) >= 0 {
+		return nil, domain.ErrStoreUnavailable
+	}
+	return r.repository.UpsertScans(ctx, scans)
+}
+
+func TestScanWorker_EndToEnd_RedeliversAfterTransientFailure(t *testing.T) {
+	for name, newBackend := range backends(t) {
+		for mode, batch := range batchModes {
+			t.Run(name+"/"+mode, func(t *testing.T) {
+				store := newBackend(t)
+				fake := newFakePubSub(t)
+				repo := &flakyRepository{repository: store.repo}
+				repo.failures.Store(2)
+
+				id := fake.publish(t, v2Scan(t, "1.1.1.1", 22, "SSH", 1700000000, "SSH-2.0-OpenSSH_9.6"))
+
+				runWorker(t, fake, workers.Config{
+					Repository:  repo,
+					DeadLetters: store.deadLetters,
+					Batch:       batch,
+				})
+
+				msg := fake.server.Message(id)
+				assert.Equal(t, 3, msg.Deliveries, "the message is nacked on each failure and redelivered")
+				assert.Equal(t, 1, msg.Acks)
+				assert.Empty(t, store.reasons(t), "transient failures are not dead-lettered")
+
+				scan, err := store.repo.ListScans(context.Background(), domain.ScanFilter{IP: "1.1.1.1"})
+				require.NoError(t, err)
+				require.Len(t, scan, 1)
+				assert.Equal(t, "SSH-2.0-OpenSSH_9.6", scan[0].Response)
+			})
+		}
+	}
+}
+
+// normalize puts times in UTC so records compare equal across backends
+func normalize(scans []domain.ServiceScan) []domain.ServiceScan {
+	for i := range scans {
+		scans[i].LastScanned = scans[i].LastScanned.UTC()
+	}
+	return scans
+}
@@ -0,0 +1,70 @@
+// Package logging builds the structured slog logger used by the binaries and
+// carries a request-scoped logger through contexts
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Config selects the level, format and sampling of log output
+type Config struct {
+	// Level is debug, info, warn or error
+	Level string
+	// Format is json or text
+	Format string
+	// SampleInitial is how many records with the same message are logged
+	// each second before sampling starts; 0 disables sampling
+	SampleInitial int
+	// SampleThereafter logs every nth record with that message once sampling started
+	SampleThereafter int
+}
+
+// New returns a logger writing to w as configured
+func New(w io.Writer, config Config) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(config.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", config.Level, err)
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(config.Format) {
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	case "text":
+		handler = slog.NewTextHandler(w, options)
+	default:
+		return nil, fmt.Errorf("invalid log format %q (json or text)", config.Format)
+	}
+
+	if config.SampleInitial > 0 {
+		handler = newSamplingHandler(handler, config.SampleInitial, config.SampleThereafter, time.Second)
+	}
+
+	return slog.New(handler), nil
+}
+
+type contextKey struct{}
+
+// WithLogger returns a context carrying logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// With adds attributes to the logger carried by ctx
+func With(ctx context.Context, args ...any) context.Context {
+	return WithLogger(ctx, FromContext(ctx).With(args...))
+}
@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_WritesJSONAtConfiguredLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Config{Level: "warn", Format: "json"})
+	require.NoError(t, err)
+
+	logger.Info("dropped")
+	logger.Warn("kept", "ip", "1.1.1.1")
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "kept", record["msg"])
+	assert.Equal(t, "1.1.1.1", record["ip"])
+}
+
+func TestNew_RejectsInvalidConfig(t *testing.T) {
+	_, err := New(&bytes.Buffer{}, Config{Level: "loud", Format: "json"})
+	assert.Error(t, err)
+
+	_, err = New(&bytes.Buffer{}, Config{Level: "info", Format: "xml"})
+	assert.Error(t, err)
+}
+
+func TestNew_SamplesRepeatedMessages(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(newSamplingHandler(slog.NewTextHandler(&buf, nil), 2, 3, time.Hour))
+
+	for i := 0; i < 8; i++ {
+		logger.Info("Ignoring older scan")
+	}
+	logger.Info("other")
+	logger.Error("Ignoring older scan")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	// 2 initial records, then the 5th and 8th, plus two that are never sampled away
+	assert.Len(t, lines, 6)
+}
+
+func TestFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Config{Level: "info", Format: "json"})
+	require.NoError(t, err)
+
+	ctx := With(WithLogger(context.Background(), logger), "message_id", "m-1")
+	FromContext(ctx).Info("handled")
+
+	assert.Contains(t, buf.String(), `"message_id":"m-1"`)
+	assert.NotNil(t, FromContext(context.Background()))
+}
@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// samplingHandler limits how often records below warn level with the same
+// message are written: the first `initial` in each tick pass, then one in every
+// `thereafter`. Warnings and errors are never dropped.
+type samplingHandler struct {
+	next       slog.Handler
+	initial    int
+	thereafter int
+	tick       time.Duration
+	counts     *sampleCounts
+}
+
+type sampleCounts struct {
+	mu     sync.Mutex
+	window time.Time
+	seen   map[string]int
+}
+
+func newSamplingHandler(next slog.Handler, initial, thereafter int, tick time.Duration) *samplingHandler {
+	return &samplingHandler{
+		next:       next,
+		initial:    initial,
+		thereafter: thereafter,
+		tick:       tick,
+		counts:     &sampleCounts{seen: make(map[string]int)},
+	}
+}
+
+func (h *samplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level < slog.LevelWarn && !h.counts.allow(record.Message, record.Time, h.initial, h.thereafter, h.tick) {
+		return nil
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.next = h.next.WithAttrs(attrs)
+	return &clone
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.next = h.next.WithGroup(name)
+	return &clone
+}
+
+// allow counts one record with message and reports whether it should be written.
+// Counts are shared by every logger derived from the same handler.
+func (c *sampleCounts) allow(message string, at time.Time, initial, thereafter int, tick time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	window := at.Truncate(tick)
+	if !window.Equal(c.window) {
+		c.window = window
+		clear(c.seen)
+	}
+
+	c.seen[message]++
+	n := c.seen[message]
+	if n <= initial {
+		return true
+	}
+	return thereafter > 0 && (n-initial)%thereafter == 0
+}
@@ -0,0 +1,95 @@
+package manifest
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+// Kinds of Discrepancy
+const (
+	// Missing means a published service has no stored record
+	Missing = "missing"
+	// Outdated means the stored record is older than the latest published scan
+	Outdated = "outdated"
+	// WrongResponse means the stored record has the latest timestamp but a
+	// response that was not published at that time
+	WrongResponse = "wrong_response"
+	// Newer means the stored record is newer than every published scan, so
+	// the published log is incomplete
+	Newer = "newer"
+	// Extra means a record is stored for a service that was never published
+	Extra = "extra"
+)
+
+// Discrepancy is a stored record that does not match the manifest
+type Discrepancy struct {
+	Kind     string              `json:"kind"`
+	IP       string              `json:"ip"`
+	Port     uint32              `json:"port"`
+	Service  string              `json:"service"`
+	Expected *Entry              `json:"expected,omitempty"`
+	Stored   *domain.ServiceScan `json:"stored,omitempty"`
+}
+
+// Audit compares stored records against a manifest. Records are checked one
+// at a time so a large store can be paged through. It is not safe for
+// concurrent use.
+type Audit struct {
+	expected map[domain.ServiceKey]Entry
+	checked  map[domain.ServiceKey]bool
+}
+
+func NewAudit(entries []Entry) *Audit {
+	expected := make(map[domain.ServiceKey]Entry, len(entries))
+	for _, entry := range entries {
+		expected[entry.Key()] = entry
+	}
+	return &Audit{
+		expected: expected,
+		checked:  make(map[domain.ServiceKey]bool, len(entries)),
+	}
+}
+
+// Check compares one stored record with the manifest and returns nil if it
+// matches
+func (a *Audit) Check(stored domain.ServiceScan) *Discrepancy {
+	key := stored.Key()
+	discrepancy := &Discrepancy{IP: key.IP, Port: key.Port, Service: key.Service, Stored: &stored}
+
+	entry, ok := a.expected[key]
+	if !ok {
+		discrepancy.Kind = Extra
+		return discrepancy
+	}
+	a.checked[key] = true
+	discrepancy.Expected = &entry
+
+	switch {
+	case stored.LastScanned.Before(entry.LastScanned):
+		discrepancy.Kind = Outdated
+	case stored.LastScanned.After(entry.LastScanned):
+		discrepancy.Kind = Newer
+	case !slices.Contains(entry.Responses, stored.Response):
+		discrepancy.Kind = WrongResponse
+	default:
+		return nil
+	}
+	return discrepancy
+}
+
+// Missing returns a discrepancy for every manifest entry no checked record
+// matched by key, ordered by (ip, port, service)
+func (a *Audit) Missing() []Discrepancy {
+	var missing []Discrepancy
+	for key, entry := range a.expected {
+		if a.checked[key] {
+			continue
+		}
+		entry := entry
+		missing = append(missing, Discrepancy{Kind: Missing, IP: key.IP, Port: key.Port, Service: key.Service, Expected: &entry})
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].Expected.Key().Less(missing[j].Expected.Key()) })
+	return missing
+}
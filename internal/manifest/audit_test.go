@@ -0,0 +1,61 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+func stored(ip string, timestamp int64, response string) domain.ServiceScan {
+	return domain.ServiceScan{IP: ip, Port: 22, Service: "SSH", LastScanned: time.Unix(timestamp, 0).UTC(), Response: response}
+}
+
+func TestAudit(t *testing.T) {
+	b := NewBuilder()
+	require.NoError(t, b.ObserveLines(strings.NewReader(string(v2("1.1.1.1", 100, "ok"))+"\n\n"+
+		string(v2("1.1.1.2", 200, "latest"))+"\n"+
+		string(v2("1.1.1.3", 100, "first"))+"\n"+
+		string(v2("1.1.1.3", 100, "tied"))+"\n"+
+		string(v2("1.1.1.4", 100, "expected"))+"\n"+
+		string(v2("1.1.1.5", 100, "published"))+"\n"+
+		string(v2("1.1.1.6", 100, "lost"))+"\n")))
+	audit := NewAudit(b.Entries())
+
+	assert.Nil(t, audit.Check(stored("1.1.1.1", 100, "ok")))
+	assert.Nil(t, audit.Check(stored("1.1.1.3", 100, "tied")))
+
+	outdated := audit.Check(stored("1.1.1.2", 100, "old"))
+	require.NotNil(t, outdated)
+	assert.Equal(t, Outdated, outdated.Kind)
+	assert.Equal(t, []string{"latest"}, outdated.Expected.Responses)
+	assert.Equal(t, "old", outdated.Stored.Response)
+
+	assert.Equal(t, WrongResponse, audit.Check(stored("1.1.1.4", 100, "other")).Kind)
+	assert.Equal(t, Newer, audit.Check(stored("1.1.1.5", 300, "unpublished")).Kind)
+
+	extra := audit.Check(stored("9.9.9.9", 100, "x"))
+	require.NotNil(t, extra)
+	assert.Equal(t, Extra, extra.Kind)
+	assert.Nil(t, extra.Expected)
+
+	missing := audit.Missing()
+	require.Len(t, missing, 1)
+	assert.Equal(t, Discrepancy{
+		Kind: Missing, IP: "1.1.1.6", Port: 22, Service: "SSH",
+		Expected: &Entry{IP: "1.1.1.6", Port: 22, Service: "SSH", LastScanned: time.Unix(100, 0).UTC(), Responses: []string{"lost"}},
+	}, missing[0])
+}
+
+func TestBuilder_ObserveLinesCountsInvalid(t *testing.T) {
+	b := NewBuilder()
+	require.NoError(t, b.ObserveLines(strings.NewReader(string(v2("1.1.1.1", 100, "ok"))+"\n{\"ip\":\n")))
+
+	assert.Len(t, b.Entries(), 1)
+	assert.Equal(t, 2, b.Published)
+	assert.Equal(t, 1, b.Invalid)
+}
@@ -0,0 +1,141 @@
+// Package manifest records the state the scan store should reach once every
+// published message has been processed, so a run can be checked against it
+package manifest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/pkg/scanning"
+)
+
+// Entry is the expected record of one (ip, port, service)
+type Entry struct {
+	IP          string    `json:"ip"`
+	Port        uint32    `json:"port"`
+	Service     string    `json:"service"`
+	LastScanned time.Time `json:"last_scanned"`
+	// Responses holds every response published at LastScanned. A scan with the
+	// same timestamp does not replace the stored one, so whichever arrived
+	// first is kept and any of them is correct.
+	Responses []string `json:"responses"`
+}
+
+// Key returns the (ip, port, service) the entry is for
+func (e *Entry) Key() domain.ServiceKey {
+	return domain.ServiceKey{IP: e.IP, Port: e.Port, Service: e.Service}
+}
+
+// Builder applies published messages with the consumer's newest-timestamp-wins
+// rule. It is not safe for concurrent use.
+type Builder struct {
+	entries map[domain.ServiceKey]*Entry
+	// Published counts every observed message and Invalid those the consumer
+	// rejects permanently
+	Published int
+	Invalid   int
+}
+
+func NewBuilder() *Builder {
+	return &Builder{entries: map[domain.ServiceKey]*Entry{}}
+}
+
+// Observe applies one published message, decoded the way the consumer decodes
+// it. It returns the error that makes the consumer reject the message.
+func (b *Builder) Observe(data []byte) error {
+	b.Published++
+
+	var raw scanning.Scan
+	if err := json.Unmarshal(data, &raw); err != nil {
+		b.Invalid++
+		return err
+	}
+	scan, err := domain.ConvertScanToDomain(raw)
+	if err != nil {
+		b.Invalid++
+		return err
+	}
+
+	entry, ok := b.entries[scan.Key()]
+	switch {
+	case !ok || scan.LastScanned.After(entry.LastScanned):
+		b.entries[scan.Key()] = &Entry{
+			IP:          scan.IP,
+			Port:        scan.Port,
+			Service:     scan.Service,
+			LastScanned: scan.LastScanned.UTC(),
+			Responses:   []string{scan.Response},
+		}
+	case scan.LastScanned.Equal(entry.LastScanned) && !slices.Contains(entry.Responses, scan.Response):
+		entry.Responses = append(entry.Responses, scan.Response)
+	}
+	return nil
+}
+
+// maxLineBytes matches the longest line the consumer's file source accepts
+const maxLineBytes = 10 * 1024 * 1024
+
+// ObserveLines applies each non-empty line of r as one message. That is the
+// format the consumer's file source reads and the scanner's -output writes.
+func (b *Builder) ObserveLines(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			// Rejected messages are counted in Invalid
+			_ = b.Observe(scanner.Bytes())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read scans: %w", err)
+	}
+	return nil
+}
+
+// Entries returns the expected records ordered by (ip, port, service)
+func (b *Builder) Entries() []Entry {
+	entries := make([]Entry, 0, len(b.entries))
+	for _, entry := range b.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key().Less(entries[j].Key()) })
+	return entries
+}
+
+// Write stores entries as JSON lines
+func Write(w io.Writer, entries []Entry) error {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	for i := range entries {
+		if err := encoder.Encode(&entries[i]); err != nil {
+			return fmt.Errorf("failed to write manifest: %w", err)
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// Read loads entries written by Write
+func Read(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	decoder := json.NewDecoder(r)
+	for {
+		var entry Entry
+		err := decoder.Decode(&entry)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest entry %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, entry)
+	}
+}
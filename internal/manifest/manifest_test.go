@@ -0,0 +1,69 @@
+package manifest
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+func v2(ip string, timestamp int, response string) []byte {
+	return []byte(`{"ip":"` + ip + `","port":22,"service":"SSH","timestamp":` + strconv.Itoa(timestamp) +
+		`,"data_version":2,"data":{"response_str":"` + response + `"}}`)
+}
+
+func TestBuilder_NewestTimestampWins(t *testing.T) {
+	b := NewBuilder()
+	require.NoError(t, b.Observe(v2("1.1.1.1", 200, "new")))
+	require.NoError(t, b.Observe(v2("1.1.1.1", 100, "old")))
+	require.NoError(t, b.Observe(v2("1.1.1.1", 200, "new")))
+	require.NoError(t, b.Observe(v2("1.1.1.2", 100, "first")))
+	require.NoError(t, b.Observe(v2("1.1.1.2", 100, "tied")))
+	// V1 responses are base64; "aGk=" is "hi"
+	require.NoError(t, b.Observe([]byte(`{"ip":"1.1.1.0","port":22,"service":"SSH","timestamp":50,"data_version":1,"data":{"response_bytes_utf8":"aGk="}}`)))
+
+	assert.Equal(t, []Entry{
+		{IP: "1.1.1.0", Port: 22, Service: "SSH", LastScanned: time.Unix(50, 0).UTC(), Responses: []string{"hi"}},
+		{IP: "1.1.1.1", Port: 22, Service: "SSH", LastScanned: time.Unix(200, 0).UTC(), Responses: []string{"new"}},
+		{IP: "1.1.1.2", Port: 22, Service: "SSH", LastScanned: time.Unix(100, 0).UTC(), Responses: []string{"first", "tied"}},
+	}, b.Entries())
+	assert.Equal(t, 6, b.Published)
+	assert.Zero(t, b.Invalid)
+}
+
+func TestBuilder_RejectsWhatTheConsumerRejects(t *testing.T) {
+	b := NewBuilder()
+
+	assert.Error(t, b.Observe([]byte(`{"ip":"1.1.1.1","port":`)))
+	assert.ErrorIs(t, b.Observe([]byte(`{"ip":"1.1.1.1","port":22,"service":"SSH","timestamp":1,"data_version":7,"data":{}}`)),
+		domain.ErrUnsupportedDataVersion)
+	assert.ErrorIs(t, b.Observe([]byte(`{"ip":"1.1.1.1","port":22,"service":"SSH","timestamp":1,"data_version":1,"data":{"response_bytes_utf8":"!!"}}`)),
+		domain.ErrMalformedData)
+	assert.ErrorIs(t, b.Observe(v2("not-an-ip", 1, "x")), domain.ErrInvalidScan)
+
+	assert.Empty(t, b.Entries())
+	assert.Equal(t, 4, b.Published)
+	assert.Equal(t, 4, b.Invalid)
+}
+
+func TestWriteRead(t *testing.T) {
+	b := NewBuilder()
+	require.NoError(t, b.Observe(v2("1.1.1.1", 100, "a")))
+	require.NoError(t, b.Observe(v2("2001:db8::1", 100, "b")))
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, b.Entries()))
+	assert.Equal(t, 2, bytes.Count(buf.Bytes(), []byte("\n")))
+
+	entries, err := Read(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, b.Entries(), entries)
+
+	_, err = Read(bytes.NewBufferString(`{"ip":`))
+	assert.ErrorContains(t, err, "failed to read manifest entry 1")
+}
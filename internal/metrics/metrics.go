@@ -0,0 +1,121 @@
+// Package metrics defines the Prometheus collectors exported by the consumer
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "scan_consumer"
+
+// Decode results recorded by DecodedMessages
+const (
+	DecodeOK          = "ok"
+	DecodeMalformed   = "malformed"
+	DecodeUnsupported = "unsupported"
+	DecodeInvalid     = "invalid"
+)
+
+// Cache lookup results recorded by CacheLookups
+const (
+	CacheHit   = "hit"
+	CacheMiss  = "miss"
+	CacheError = "error"
+)
+
+var (
+	MessagesReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_received_total",
+		Help:      "Messages delivered to the worker by its source.",
+	})
+	MessagesAcked = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_acked_total",
+		Help:      "Messages acknowledged after processing or dead-lettering.",
+	})
+	MessagesNacked = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_nacked_total",
+		Help:      "Messages returned to the source for redelivery.",
+	})
+	MessagesDeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_dead_lettered_total",
+		Help:      "Messages stored in the dead-letter sink, by failure reason.",
+	}, []string{"reason"})
+	MessagesInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "messages_in_flight",
+		Help:      "Messages currently being handled by the worker.",
+	})
+	MaxOutstandingMessages = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "max_outstanding_messages",
+		Help:      "Limit on messages handled at once currently set by adaptive flow control.",
+	})
+	HandlerDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handler_duration_seconds",
+		Help:      "Time from receiving a message until it is acked or nacked.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	DecodedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "decoded_messages_total",
+		Help:      "Scan payloads decoded by the message handler, by data_version and result.",
+	}, []string{"data_version", "result"})
+
+	UpsertOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upsert_outcomes_total",
+		Help:      "Scans processed, by the outcome of their conditional upsert.",
+	}, []string{"outcome"})
+
+	DBDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_duration_seconds",
+		Help:      "Latency of repository operations, by operation and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "status"})
+	DBRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_retries_total",
+		Help:      "Repository operations retried after a transient database error, by operation.",
+	}, []string{"operation"})
+	CircuitBreakerOpen = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_open",
+		Help:      "1 while message pulling is paused because the database is unavailable.",
+	})
+
+	CacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Latest-scan cache lookups, by result (hit, miss or error).",
+	}, []string{"result"})
+	CacheSkippedWrites = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_skipped_writes_total",
+		Help:      "Scans found stale in the cache and never sent to the database.",
+	})
+)
+
+// ObserveDB records the latency of a repository operation started at start
+func ObserveDB(operation string, start time.Time, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	DBDuration.WithLabelValues(operation, status).Observe(time.Since(start).Seconds())
+}
+
+// Handler serves every registered metric in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
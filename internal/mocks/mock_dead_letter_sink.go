@@ -0,0 +1,50 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/censys/scan-takehome/internal/workers (interfaces: DeadLetterSink)
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	domain "github.com/censys/scan-takehome/internal/domain"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockDeadLetterSink is a mock of DeadLetterSink interface.
+type MockDeadLetterSink struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeadLetterSinkMockRecorder
+}
+
+// MockDeadLetterSinkMockRecorder is the mock recorder for MockDeadLetterSink.
+type MockDeadLetterSinkMockRecorder struct {
+	mock *MockDeadLetterSink
+}
+
+// NewMockDeadLetterSink creates a new mock instance.
+func NewMockDeadLetterSink(ctrl *gomock.Controller) *MockDeadLetterSink {
+	mock := &MockDeadLetterSink{ctrl: ctrl}
+	mock.recorder = &MockDeadLetterSinkMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDeadLetterSink) EXPECT() *MockDeadLetterSinkMockRecorder {
+	return m.recorder
+}
+
+// SendDeadLetter mocks base method.
+func (m *MockDeadLetterSink) SendDeadLetter(arg0 context.Context, arg1 *domain.DeadLetter) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendDeadLetter", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendDeadLetter indicates an expected call of SendDeadLetter.
+func (mr *MockDeadLetterSinkMockRecorder) SendDeadLetter(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendDeadLetter", reflect.TypeOf((*MockDeadLetterSink)(nil).SendDeadLetter), arg0, arg1)
+}
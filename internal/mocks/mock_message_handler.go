@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: internal/workers/scan_worker.go
+// Source: github.com/censys/scan-takehome/internal/workers (interfaces: MessageHandler)
 
 // Package mocks is a generated GoMock package.
 package mocks
@@ -35,15 +35,15 @@ func (m *MockMessageHandler) EXPECT() *MockMessageHandlerMockRecorder {
 }
 
 // HandleMessage mocks base method.
-func (m *MockMessageHandler) HandleMessage(ctx context.Context, msgData []byte) error {
+func (m *MockMessageHandler) HandleMessage(arg0 context.Context, arg1 []byte) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "HandleMessage", ctx, msgData)
+	ret := m.ctrl.Call(m, "HandleMessage", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // HandleMessage indicates an expected call of HandleMessage.
-func (mr *MockMessageHandlerMockRecorder) HandleMessage(ctx, msgData interface{}) *gomock.Call {
+func (mr *MockMessageHandlerMockRecorder) HandleMessage(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandleMessage", reflect.TypeOf((*MockMessageHandler)(nil).HandleMessage), ctx, msgData)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandleMessage", reflect.TypeOf((*MockMessageHandler)(nil).HandleMessage), arg0, arg1)
 }
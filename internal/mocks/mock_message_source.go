@@ -0,0 +1,64 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/censys/scan-takehome/internal/workers (interfaces: MessageSource)
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	sources "github.com/censys/scan-takehome/internal/sources"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockMessageSource is a mock of MessageSource interface.
+type MockMessageSource struct {
+	ctrl     *gomock.Controller
+	recorder *MockMessageSourceMockRecorder
+}
+
+// MockMessageSourceMockRecorder is the mock recorder for MockMessageSource.
+type MockMessageSourceMockRecorder struct {
+	mock *MockMessageSource
+}
+
+// NewMockMessageSource creates a new mock instance.
+func NewMockMessageSource(ctrl *gomock.Controller) *MockMessageSource {
+	mock := &MockMessageSource{ctrl: ctrl}
+	mock.recorder = &MockMessageSourceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMessageSource) EXPECT() *MockMessageSourceMockRecorder {
+	return m.recorder
+}
+
+// Close mocks base method.
+func (m *MockMessageSource) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockMessageSourceMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockMessageSource)(nil).Close))
+}
+
+// Receive mocks base method.
+func (m *MockMessageSource) Receive(arg0 context.Context, arg1 sources.HandlerFunc) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Receive", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Receive indicates an expected call of Receive.
+func (mr *MockMessageSourceMockRecorder) Receive(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Receive", reflect.TypeOf((*MockMessageSource)(nil).Receive), arg0, arg1)
+}
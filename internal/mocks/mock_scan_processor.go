@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: internal/handlers/message_handler.go
+// Source: message_handler.go
 
 // Package mocks is a generated GoMock package.
 package mocks
@@ -36,11 +36,12 @@ func (m *MockScanProcessor) EXPECT() *MockScanProcessorMockRecorder {
 }
 
 // ProcessScanResult mocks base method.
-func (m *MockScanProcessor) ProcessScanResult(ctx context.Context, scan *domain.ServiceScan) error {
+func (m *MockScanProcessor) ProcessScanResult(ctx context.Context, scan *domain.ServiceScan) (domain.UpsertOutcome, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "ProcessScanResult", ctx, scan)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(domain.UpsertOutcome)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // ProcessScanResult indicates an expected call of ProcessScanResult.
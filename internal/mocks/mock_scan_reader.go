@@ -0,0 +1,81 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: server.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	domain "github.com/censys/scan-takehome/internal/domain"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockScanReader is a mock of ScanReader interface.
+type MockScanReader struct {
+	ctrl     *gomock.Controller
+	recorder *MockScanReaderMockRecorder
+}
+
+// MockScanReaderMockRecorder is the mock recorder for MockScanReader.
+type MockScanReaderMockRecorder struct {
+	mock *MockScanReader
+}
+
+// NewMockScanReader creates a new mock instance.
+func NewMockScanReader(ctrl *gomock.Controller) *MockScanReader {
+	mock := &MockScanReader{ctrl: ctrl}
+	mock.recorder = &MockScanReaderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockScanReader) EXPECT() *MockScanReaderMockRecorder {
+	return m.recorder
+}
+
+// GetLatestScan mocks base method.
+func (m *MockScanReader) GetLatestScan(ctx context.Context, ip string, port uint32, service string) (*domain.ServiceScan, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLatestScan", ctx, ip, port, service)
+	ret0, _ := ret[0].(*domain.ServiceScan)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLatestScan indicates an expected call of GetLatestScan.
+func (mr *MockScanReaderMockRecorder) GetLatestScan(ctx, ip, port, service interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLatestScan", reflect.TypeOf((*MockScanReader)(nil).GetLatestScan), ctx, ip, port, service)
+}
+
+// GetScanHistory mocks base method.
+func (m *MockScanReader) GetScanHistory(ctx context.Context, ip string, port uint32, service string) ([]domain.ScanHistoryEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetScanHistory", ctx, ip, port, service)
+	ret0, _ := ret[0].([]domain.ScanHistoryEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetScanHistory indicates an expected call of GetScanHistory.
+func (mr *MockScanReaderMockRecorder) GetScanHistory(ctx, ip, port, service interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetScanHistory", reflect.TypeOf((*MockScanReader)(nil).GetScanHistory), ctx, ip, port, service)
+}
+
+// ListScans mocks base method.
+func (m *MockScanReader) ListScans(ctx context.Context, filter domain.ScanFilter) ([]domain.ServiceScan, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListScans", ctx, filter)
+	ret0, _ := ret[0].([]domain.ServiceScan)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListScans indicates an expected call of ListScans.
+func (mr *MockScanReaderMockRecorder) ListScans(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListScans", reflect.TypeOf((*MockScanReader)(nil).ListScans), ctx, filter)
+}
@@ -1,5 +1,5 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: internal/services/scan_processor.go
+// Source: scan_processor.go
 
 // Package mocks is a generated GoMock package.
 package mocks
@@ -35,31 +35,32 @@ func (m *MockScanRepository) EXPECT() *MockScanRepositoryMockRecorder {
 	return m.recorder
 }
 
-// GetLatestScan mocks base method.
-func (m *MockScanRepository) GetLatestScan(ctx context.Context, ip string, port uint32, service string) (*domain.ServiceScan, error) {
+// UpsertScan mocks base method.
+func (m *MockScanRepository) UpsertScan(ctx context.Context, scan *domain.ServiceScan) (domain.UpsertOutcome, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetLatestScan", ctx, ip, port, service)
-	ret0, _ := ret[0].(*domain.ServiceScan)
+	ret := m.ctrl.Call(m, "UpsertScan", ctx, scan)
+	ret0, _ := ret[0].(domain.UpsertOutcome)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetLatestScan indicates an expected call of GetLatestScan.
-func (mr *MockScanRepositoryMockRecorder) GetLatestScan(ctx, ip, port, service interface{}) *gomock.Call {
+// UpsertScan indicates an expected call of UpsertScan.
+func (mr *MockScanRepositoryMockRecorder) UpsertScan(ctx, scan interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLatestScan", reflect.TypeOf((*MockScanRepository)(nil).GetLatestScan), ctx, ip, port, service)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpsertScan", reflect.TypeOf((*MockScanRepository)(nil).UpsertScan), ctx, scan)
 }
 
-// UpsertScan mocks base method.
-func (m *MockScanRepository) UpsertScan(ctx context.Context, scan *domain.ServiceScan) error {
+// UpsertScans mocks base method.
+func (m *MockScanRepository) UpsertScans(ctx context.Context, scans []*domain.ServiceScan) ([]domain.UpsertOutcome, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpsertScan", ctx, scan)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "UpsertScans", ctx, scans)
+	ret0, _ := ret[0].([]domain.UpsertOutcome)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// UpsertScan indicates an expected call of UpsertScan.
-func (mr *MockScanRepositoryMockRecorder) UpsertScan(ctx, scan interface{}) *gomock.Call {
+// UpsertScans indicates an expected call of UpsertScans.
+func (mr *MockScanRepositoryMockRecorder) UpsertScans(ctx, scans interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpsertScan", reflect.TypeOf((*MockScanRepository)(nil).UpsertScan), ctx, scan)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpsertScans", reflect.TypeOf((*MockScanRepository)(nil).UpsertScans), ctx, scans)
 }
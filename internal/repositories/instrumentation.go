@@ -0,0 +1,36 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/censys/scan-takehome/internal/metrics"
+	"github.com/censys/scan-takehome/internal/tracing"
+)
+
+// startQuery opens a span for one Postgres operation. The returned function
+// ends the span and records the operation's latency.
+func startQuery(ctx context.Context, operation string) (context.Context, func(err error)) {
+	return startOperation(ctx, "postgres", semconv.DBSystemPostgreSQL, operation)
+}
+
+// startSQLiteQuery is startQuery for SQLite
+func startSQLiteQuery(ctx context.Context, operation string) (context.Context, func(err error)) {
+	return startOperation(ctx, "sqlite", semconv.DBSystemSqlite, operation)
+}
+
+func startOperation(ctx context.Context, name string, system attribute.KeyValue, operation string) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, name+" "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(system, semconv.DBOperation(operation)))
+
+	return ctx, func(err error) {
+		tracing.End(span, err)
+		metrics.ObserveDB(operation, start, err)
+	}
+}
@@ -0,0 +1,234 @@
+package repositories
+
+import (
+	"context"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+// MemoryRepository keeps scans, their history and dead letters in process
+// memory. It applies the same newest-timestamp-wins rule as the Postgres
+// upsert and is safe for concurrent use. Everything is lost on exit, so it
+// suits local runs and tests rather than production.
+type MemoryRepository struct {
+	mu          sync.RWMutex
+	scans       map[domain.ServiceKey]domain.ServiceScan
+	history     map[domain.ServiceKey][]domain.ScanHistoryEntry
+	deadLetters []domain.DeadLetter
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		scans:   map[domain.ServiceKey]domain.ServiceScan{},
+		history: map[domain.ServiceKey][]domain.ScanHistoryEntry{},
+	}
+}
+
+// Ping always succeeds; the store lives in this process
+func (r *MemoryRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (r *MemoryRepository) GetLatestScan(ctx context.Context, ip string, port uint32, service string) (*domain.ServiceScan, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	scan, ok := r.scans[domain.ServiceKey{IP: domain.CanonicalIP(ip), Port: port, Service: service}]
+	if !ok {
+		return nil, nil
+	}
+	return &scan, nil
+}
+
+// UpsertScan writes the scan if it is newer than the stored record and reports
+// what happened
+func (r *MemoryRepository) UpsertScan(ctx context.Context, scan *domain.ServiceScan) (domain.UpsertOutcome, error) {
+	outcomes, err := r.UpsertScans(ctx, []*domain.ServiceScan{scan})
+	if err != nil {
+		return 0, err
+	}
+
+	return outcomes[0], nil
+}
+
+// UpsertScans applies the scans atomically in input order and returns the
+// outcome of each. Unlike Postgres it accepts repeated keys in one batch.
+func (r *MemoryRepository) UpsertScans(ctx context.Context, scans []*domain.ServiceScan) ([]domain.UpsertOutcome, error) {
+	if len(scans) == 0 {
+		return nil, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	outcomes := make([]domain.UpsertOutcome, len(scans))
+	for i, scan := range scans {
+		outcomes[i] = r.upsert(*scan)
+	}
+	return outcomes, nil
+}
+
+// upsert mirrors the conditional ON CONFLICT ... WHERE of the Postgres
+// upsert and the history it records. The caller holds the write lock.
+func (r *MemoryRepository) upsert(scan domain.ServiceScan) domain.UpsertOutcome {
+	// Postgres rounds to microseconds, so finer differences cannot win a conflict
+	scan.LastScanned = scan.LastScanned.Round(time.Microsecond)
+	key := scan.Key()
+
+	stored, exists := r.scans[key]
+	if exists && !stored.LastScanned.Before(scan.LastScanned) {
+		return domain.OutcomeStale
+	}
+	r.scans[key] = scan
+
+	outcome := domain.ClassifyUpsert(true, !exists, stored.Response, scan.Response)
+	switch outcome {
+	case domain.OutcomeInserted, domain.OutcomeUpdated:
+		entry := domain.ScanHistoryEntry{
+			IP:           scan.IP,
+			Port:         scan.Port,
+			Service:      scan.Service,
+			Response:     scan.Response,
+			ResponseHash: domain.HashResponse(scan.Response),
+			FirstSeen:    scan.LastScanned,
+			LastSeen:     scan.LastScanned,
+		}
+		if outcome == domain.OutcomeUpdated {
+			entry.PreviousResponseHash = domain.HashResponse(stored.Response)
+		}
+		r.history[key] = append(r.history[key], entry)
+	case domain.OutcomeIdentical:
+		if entries := r.history[key]; len(entries) > 0 {
+			latest := &entries[len(entries)-1]
+			if latest.LastSeen.Before(scan.LastScanned) {
+				latest.LastSeen = scan.LastScanned
+			}
+		}
+	}
+	return outcome
+}
+
+// ListScans returns records matching filter ordered by (ip, port, service),
+// using the key in filter.After for keyset pagination. Keys are compared
+// byte by byte, as in the other backends.
+func (r *MemoryRepository) ListScans(ctx context.Context, filter domain.ScanFilter) ([]domain.ServiceScan, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	var scans []domain.ServiceScan
+	for _, scan := range r.scans {
+		if matches(filter, scan) {
+			scans = append(scans, scan)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(scans, func(i, j int) bool { return scans[i].Key().Less(scans[j].Key()) })
+	if filter.Limit > 0 && len(scans) > filter.Limit {
+		scans = scans[:filter.Limit]
+	}
+	return scans, nil
+}
+
+// matches applies the WHERE clause ListScans builds for Postgres
+func matches(filter domain.ScanFilter, scan domain.ServiceScan) bool {
+	if filter.IP != "" && scan.IP != filter.IP {
+		return false
+	}
+	if filter.Port != 0 && scan.Port != filter.Port {
+		return false
+	}
+	if filter.Service != "" && scan.Service != filter.Service {
+		return false
+	}
+	if !filter.ScannedAfter.IsZero() && scan.LastScanned.Before(filter.ScannedAfter) {
+		return false
+	}
+	if !filter.ScannedBefore.IsZero() && !scan.LastScanned.Before(filter.ScannedBefore) {
+		return false
+	}
+	if filter.After != nil && !filter.After.Less(scan.Key()) {
+		return false
+	}
+	return !hasAddressCriteria(filter) || matchesAddress(filter, scan.IP)
+}
+
+// hasAddressCriteria reports whether filter restricts addresses by network,
+// range or family
+func hasAddressCriteria(filter domain.ScanFilter) bool {
+	return filter.Network.IsValid() || filter.RangeStart.IsValid() || filter.Family != domain.AnyFamily
+}
+
+// matchesAddress applies the address criteria of filter the way Postgres
+// compares inet values. Like the ip_addr column, an IP that does not parse
+// never matches.
+func matchesAddress(filter domain.ScanFilter, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	if filter.Network.IsValid() && !filter.Network.Masked().Contains(addr) {
+		return false
+	}
+	if filter.RangeStart.IsValid() && (addr.Less(filter.RangeStart) || filter.RangeEnd.Less(addr)) {
+		return false
+	}
+	switch filter.Family {
+	case domain.IPv4:
+		return addr.Is4()
+	case domain.IPv6:
+		return addr.Is6()
+	}
+	return true
+}
+
+// GetScanHistory returns every response period recorded for a service, oldest first
+func (r *MemoryRepository) GetScanHistory(
+	ctx context.Context, ip string, port uint32, service string,
+) ([]domain.ScanHistoryEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := r.history[domain.ServiceKey{IP: domain.CanonicalIP(ip), Port: port, Service: service}]
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return append([]domain.ScanHistoryEntry(nil), entries...), nil
+}
+
+// SendDeadLetter keeps the dead letter so it can be read back with DeadLetters
+func (r *MemoryRepository) SendDeadLetter(ctx context.Context, deadLetter *domain.DeadLetter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deadLetters = append(r.deadLetters, *deadLetter)
+	return nil
+}
+
+// DeadLetters returns the dead letters received so far, oldest first
+func (r *MemoryRepository) DeadLetters() []domain.DeadLetter {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]domain.DeadLetter(nil), r.deadLetters...)
+}
@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/repositories/repotest"
+)
+
+func TestMemoryRepository_Conformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repository {
+		return NewMemoryRepository()
+	})
+}
+
+func TestMemoryRepository_SubMicrosecondScanIsStale(t *testing.T) {
+	repo := NewMemoryRepository()
+	scanned := time.Date(2024, 3, 1, 12, 0, 0, 1000, time.UTC)
+
+	scan := &domain.ServiceScan{IP: "10.0.0.1", Port: 80, Service: "HTTP", Response: "a", LastScanned: scanned}
+	_, err := repo.UpsertScan(context.Background(), scan)
+	require.NoError(t, err)
+
+	// Postgres could not tell these timestamps apart either
+	later := *scan
+	later.Response = "b"
+	later.LastScanned = scanned.Add(400 * time.Nanosecond)
+	outcome, err := repo.UpsertScan(context.Background(), &later)
+	require.NoError(t, err)
+	assert.Equal(t, domain.OutcomeStale, outcome)
+}
+
+func TestMemoryRepository_RepeatedKeyInBatch(t *testing.T) {
+	repo := NewMemoryRepository()
+	scanned := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	outcomes, err := repo.UpsertScans(context.Background(), []*domain.ServiceScan{
+		{IP: "10.0.0.1", Port: 80, Service: "HTTP", Response: "a", LastScanned: scanned},
+		{IP: "10.0.0.1", Port: 80, Service: "HTTP", Response: "b", LastScanned: scanned.Add(time.Second)},
+		{IP: "10.0.0.1", Port: 80, Service: "HTTP", Response: "c", LastScanned: scanned.Add(-time.Second)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []domain.UpsertOutcome{domain.OutcomeInserted, domain.OutcomeUpdated, domain.OutcomeStale}, outcomes)
+}
+
+func TestMemoryRepository_CanceledContext(t *testing.T) {
+	repo := NewMemoryRepository()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := repo.UpsertScan(ctx, &domain.ServiceScan{IP: "10.0.0.1", Port: 80, Service: "HTTP"})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	scans, err := repo.ListScans(context.Background(), domain.ScanFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, scans)
+}
+
+func TestMemoryRepository_DeadLetters(t *testing.T) {
+	repo := NewMemoryRepository()
+	deadLetter := &domain.DeadLetter{MessageID: "m1", Reason: "decode", Payload: []byte("{}")}
+
+	require.NoError(t, repo.SendDeadLetter(context.Background(), deadLetter))
+	deadLetter.MessageID = "changed"
+
+	assert.Equal(t, []domain.DeadLetter{{MessageID: "m1", Reason: "decode", Payload: []byte("{}")}}, repo.DeadLetters())
+}
@@ -0,0 +1,37 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+type PostgresDeadLetterRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresDeadLetterRepository(db *sql.DB) *PostgresDeadLetterRepository {
+	return &PostgresDeadLetterRepository{
+		db: db,
+	}
+}
+
+func (r *PostgresDeadLetterRepository) SendDeadLetter(ctx context.Context, deadLetter *domain.DeadLetter) error {
+	query := `
+		INSERT INTO dead_letters (message_id, reason, error, delivery_attempt, payload, failed_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	ctx, done := startQuery(ctx, "insert_dead_letter")
+	_, err := r.db.ExecContext(ctx, query,
+		deadLetter.MessageID, deadLetter.Reason, deadLetter.Error,
+		deadLetter.DeliveryAttempt, deadLetter.Payload, deadLetter.FailedAt)
+	done(err)
+
+	if err != nil {
+		return fmt.Errorf("failed to insert dead letter: %w", err)
+	}
+
+	return nil
+}
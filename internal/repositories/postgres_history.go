@@ -0,0 +1,165 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+// recordHistory appends a history entry for every scan that changed the
+// stored response and extends last_seen of the current entry for scans that
+// only refreshed it. Stale scans never reach the history. results must carry
+// the values of the rows upsertScans locked, not of the statement snapshot,
+// or a concurrent writer's record would be taken for a missing one.
+func recordHistory(ctx context.Context, tx *sql.Tx, scans []*domain.ServiceScan, results []upsertResult) (err error) {
+	ctx, done := startQuery(ctx, "record_history")
+	defer func() { done(err) }()
+
+	var changed []historyChange
+	var refreshed []*domain.ServiceScan
+
+	for i, scan := range scans {
+		switch results[i].outcome {
+		case domain.OutcomeInserted:
+			changed = append(changed, historyChange{scan: scan})
+		case domain.OutcomeUpdated:
+			changed = append(changed, historyChange{
+				scan:                 scan,
+				previousResponseHash: domain.HashResponse(results[i].previousResponse),
+			})
+		case domain.OutcomeIdentical:
+			refreshed = append(refreshed, scan)
+		}
+	}
+
+	if len(changed) > 0 {
+		query, args := buildHistoryInsert(changed)
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+
+	if len(refreshed) > 0 {
+		query, args := buildHistoryRefresh(refreshed)
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type historyChange struct {
+	scan                 *domain.ServiceScan
+	previousResponseHash string
+}
+
+func buildHistoryInsert(changes []historyChange) (string, []interface{}) {
+	const columns = 7
+
+	var query strings.Builder
+	query.WriteString(`
+		INSERT INTO service_scan_history
+			(ip, port, service, response, response_hash, previous_response_hash, first_seen, last_seen)
+		VALUES `)
+
+	args := make([]interface{}, 0, len(changes)*columns)
+	for i, change := range changes {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		n := i * columns
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+7)
+
+		var previousHash sql.NullString
+		if change.previousResponseHash != "" {
+			previousHash = sql.NullString{String: change.previousResponseHash, Valid: true}
+		}
+		scan := change.scan
+		args = append(args, scan.IP, scan.Port, scan.Service, scan.Response,
+			domain.HashResponse(scan.Response), previousHash, scan.LastScanned)
+	}
+
+	return query.String(), args
+}
+
+func buildHistoryRefresh(scans []*domain.ServiceScan) (string, []interface{}) {
+	const columns = 4
+
+	var query strings.Builder
+	query.WriteString(`
+		UPDATE service_scan_history AS history
+		SET last_seen = refreshed.last_seen
+		FROM (VALUES `)
+
+	args := make([]interface{}, 0, len(scans)*columns)
+	for i, scan := range scans {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		n := i * columns
+		fmt.Fprintf(&query, "($%d, $%d::integer, $%d, $%d::timestamp)", n+1, n+2, n+3, n+4)
+		args = append(args, scan.IP, scan.Port, scan.Service, scan.LastScanned)
+	}
+
+	query.WriteString(`) AS refreshed (ip, port, service, last_seen)
+		WHERE history.id = (
+			SELECT latest.id FROM service_scan_history AS latest
+			WHERE latest.ip = refreshed.ip
+			  AND latest.port = refreshed.port
+			  AND latest.service = refreshed.service
+			ORDER BY latest.first_seen DESC, latest.id DESC
+			LIMIT 1)
+		AND history.last_seen < refreshed.last_seen`)
+
+	return query.String(), args
+}
+
+// GetScanHistory returns every response period recorded for a service, oldest
+// first. The history has no ip_addr column, but its ip is written in canonical
+// form, so ip is canonicalized to match any spelling of the address.
+func (r *PostgresRepository) GetScanHistory(
+	ctx context.Context, ip string, port uint32, service string,
+) ([]domain.ScanHistoryEntry, error) {
+	return withRetry(ctx, r.retry, "get_scan_history", func(ctx context.Context) ([]domain.ScanHistoryEntry, error) {
+		return r.getScanHistory(ctx, ip, port, service)
+	})
+}
+
+func (r *PostgresRepository) getScanHistory(
+	ctx context.Context, ip string, port uint32, service string,
+) (_ []domain.ScanHistoryEntry, err error) {
+	ctx, done := startQuery(ctx, "get_scan_history")
+	defer func() { done(err) }()
+
+	query := `
+		SELECT ip, port, service, response, response_hash,
+			COALESCE(previous_response_hash, ''), first_seen, last_seen
+		FROM service_scan_history
+		WHERE ip = $1 AND port = $2 AND service = $3
+		ORDER BY first_seen, id`
+
+	rows, err := r.db.QueryContext(ctx, query, domain.CanonicalIP(ip), port, service)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scan history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []domain.ScanHistoryEntry
+	for rows.Next() {
+		var entry domain.ScanHistoryEntry
+		if err := rows.Scan(&entry.IP, &entry.Port, &entry.Service, &entry.Response, &entry.ResponseHash,
+			&entry.PreviousResponseHash, &entry.FirstSeen, &entry.LastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan history entry: %w", err)
+		}
+		history = append(history, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get scan history: %w", err)
+	}
+
+	return history, nil
+}
@@ -0,0 +1,202 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+// insertChangeEvents writes one outbox row per scan that won its upsert and
+// reports whether any row was written
+func insertChangeEvents(ctx context.Context, tx *sql.Tx, scans []*domain.ServiceScan, results []upsertResult) (_ bool, err error) {
+	ctx, done := startQuery(ctx, "insert_change_events")
+	defer func() { done(err) }()
+
+	var query strings.Builder
+	query.WriteString(`INSERT INTO change_events (payload) VALUES `)
+
+	var args []interface{}
+	for i, scan := range scans {
+		event := domain.NewServiceChanged(scan, results[i].outcome, results[i].previousResponse, results[i].previousScanned)
+		if event == nil {
+			continue
+		}
+
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return false, err
+		}
+
+		if len(args) > 0 {
+			query.WriteString(", ")
+		}
+		args = append(args, payload)
+		fmt.Fprintf(&query, "($%d)", len(args))
+	}
+
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, query.String(), args...); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// PostgresOutboxRepository reads the change_events outbox for the relay
+type PostgresOutboxRepository struct {
+	db          *sql.DB
+	maxAttempts int
+}
+
+// NewPostgresOutboxRepository parks an event once maxAttempts publishes of it
+// have failed; a maxAttempts below 1 retries forever
+func NewPostgresOutboxRepository(db *sql.DB, maxAttempts int) *PostgresOutboxRepository {
+	return &PostgresOutboxRepository{
+		db:          db,
+		maxAttempts: maxAttempts,
+	}
+}
+
+// PublishPending locks up to limit pending events, oldest first, and hands
+// each to publish. Published events are marked as such; the first failure is
+// recorded on its event and stops the run so a broken sink is not hammered.
+// An event whose payload cannot be decoded, or that has failed maxAttempts
+// times, is parked by setting failed_at and is never locked again, so one
+// poison event cannot hold up the outbox. Rows are locked with SKIP LOCKED,
+// so several consumers can relay the same outbox without publishing an event
+// twice concurrently. It returns the number of events published.
+//
+// The locks, and so the transaction, are held while publish runs, which for
+// a webhook can take up to its timeout per event. That keeps a second relay
+// from sending the same event, at the cost of a transaction that stays open
+// for the whole batch.
+func (r *PostgresOutboxRepository) PublishPending(
+	ctx context.Context, limit int, publish func(ctx context.Context, event *domain.ServiceChanged) error,
+) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin outbox transaction: %w", err)
+	}
+	defer func() {
+		// Rollback is a no-op once the transaction has been committed
+		_ = tx.Rollback()
+	}()
+
+	events, undecodable, err := lockPendingEvents(ctx, tx, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	for id, decodeErr := range undecodable {
+		slog.Error("Parking change event that cannot be decoded", "event_id", id, "error", decodeErr)
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE change_events SET failed_at = NOW(), last_error = $2 WHERE id = $1`,
+			id, decodeErr.Error()); err != nil {
+			return 0, fmt.Errorf("failed to park change event: %w", err)
+		}
+	}
+
+	var published []int64
+	for _, event := range events {
+		if err := publish(ctx, event); err != nil {
+			if err := r.recordFailure(ctx, tx, event.EventID, err); err != nil {
+				return 0, err
+			}
+			break
+		}
+		published = append(published, event.EventID)
+	}
+
+	if len(published) > 0 {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE change_events SET published_at = NOW(), attempts = attempts + 1, last_error = NULL
+			 WHERE id = ANY($1)`,
+			pq.Array(published)); err != nil {
+			return 0, fmt.Errorf("failed to mark change events published: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit outbox transaction: %w", err)
+	}
+
+	return len(published), nil
+}
+
+// recordFailure counts a failed publish of the event and parks it once it
+// has used up its attempts
+func (r *PostgresOutboxRepository) recordFailure(ctx context.Context, tx *sql.Tx, id int64, publishErr error) error {
+	var parked bool
+	err := tx.QueryRowContext(ctx,
+		`UPDATE change_events
+		 SET attempts = attempts + 1, last_error = $2,
+		     failed_at = CASE WHEN $3 > 0 AND attempts + 1 >= $3 THEN NOW() END
+		 WHERE id = $1
+		 RETURNING failed_at IS NOT NULL`,
+		id, publishErr.Error(), r.maxAttempts).Scan(&parked)
+	if err != nil {
+		return fmt.Errorf("failed to record change event failure: %w", err)
+	}
+
+	if parked {
+		slog.Error("Parking change event after repeated publish failures",
+			"event_id", id, "attempts", r.maxAttempts, "error", publishErr)
+	}
+	return nil
+}
+
+// lockPendingEvents locks up to limit pending events and decodes them.
+// Rows whose payload does not decode are returned by ID with the error
+// instead of failing the batch.
+func lockPendingEvents(
+	ctx context.Context, tx *sql.Tx, limit int,
+) (_ []*domain.ServiceChanged, undecodable map[int64]error, err error) {
+	ctx, done := startQuery(ctx, "lock_change_events")
+	defer func() { done(err) }()
+
+	query := `
+		SELECT id, payload
+		FROM change_events
+		WHERE published_at IS NULL AND failed_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`
+
+	rows, err := tx.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read change events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*domain.ServiceChanged
+	undecodable = map[int64]error{}
+	for rows.Next() {
+		var id int64
+		var payload []byte
+		if err := rows.Scan(&id, &payload); err != nil {
+			return nil, nil, fmt.Errorf("failed to read change event: %w", err)
+		}
+
+		var event domain.ServiceChanged
+		if err := json.Unmarshal(payload, &event); err != nil {
+			undecodable[id] = fmt.Errorf("failed to decode change event: %w", err)
+			continue
+		}
+		event.EventID = id
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read change events: %w", err)
+	}
+
+	return events, undecodable, nil
+}
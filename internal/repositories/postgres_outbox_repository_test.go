@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+func insertEvent(t *testing.T, database *sql.DB, payload string) int64 {
+	t.Helper()
+	var id int64
+	require.NoError(t, database.QueryRow(`INSERT INTO change_events (payload) VALUES ($1) RETURNING id`, payload).Scan(&id))
+	return id
+}
+
+func TestPostgresOutboxRepository_ParksPoisonEvents(t *testing.T) {
+	ctx := context.Background()
+	database := openTestDatabase(t)
+	_, err := database.ExecContext(ctx, `TRUNCATE change_events`)
+	require.NoError(t, err)
+
+	poison := insertEvent(t, database, `{"ip":"1.1.1.1","port":80,"service":"HTTP"}`)
+	undecodable := insertEvent(t, database, `"not an event"`)
+	healthy := insertEvent(t, database, `{"ip":"1.1.1.2","port":80,"service":"HTTP"}`)
+
+	repo := NewPostgresOutboxRepository(database, 2)
+	var delivered []int64
+	publish := func(ctx context.Context, event *domain.ServiceChanged) error {
+		if event.EventID == poison {
+			return errors.New("webhook returned 400")
+		}
+		delivered = append(delivered, event.EventID)
+		return nil
+	}
+
+	// The undecodable event is parked at once; the poison event blocks the
+	// run until its second failure parks it
+	for _, want := range []int{0, 0, 1} {
+		published, err := repo.PublishPending(ctx, 10, publish)
+		require.NoError(t, err)
+		assert.Equal(t, want, published)
+	}
+	assert.Equal(t, []int64{healthy}, delivered)
+
+	for id, attempts := range map[int64]int{poison: 2, undecodable: 0} {
+		var got int
+		var parked bool
+		var lastError sql.NullString
+		require.NoError(t, database.QueryRowContext(ctx,
+			`SELECT attempts, failed_at IS NOT NULL, last_error FROM change_events WHERE id = $1`, id).
+			Scan(&got, &parked, &lastError))
+		assert.Equal(t, attempts, got)
+		assert.True(t, parked)
+		assert.NotEmpty(t, lastError.String)
+	}
+
+	published, err := repo.PublishPending(ctx, 10, publish)
+	require.NoError(t, err)
+	assert.Zero(t, published, "parked events are not locked again")
+}
+
+func TestPostgresRepository_ConcurrentBatchesWriteEventsAgainstStoredRecord(t *testing.T) {
+	ctx := context.Background()
+	database := openTestDatabase(t)
+	_, err := database.ExecContext(ctx, `TRUNCATE service_scans, service_scan_history, change_events`)
+	require.NoError(t, err)
+
+	repo := NewPostgresRepository(database, WithChangeEvents(nil))
+	stored := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	_, err = repo.UpsertScan(ctx, &domain.ServiceScan{IP: "10.0.0.1", Port: 22, Service: "SSH", Response: "old", LastScanned: stored})
+	require.NoError(t, err)
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 1; w <= 2; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			<-start
+			scan := &domain.ServiceScan{
+				IP: "10.0.0.1", Port: 22, Service: "SSH", Response: "new",
+				LastScanned: stored.Add(time.Duration(w) * time.Second),
+			}
+			_, err := repo.UpsertScan(ctx, scan)
+			assert.NoError(t, err)
+		}(w)
+	}
+	close(start)
+	wg.Wait()
+
+	rows, err := database.QueryContext(ctx, `SELECT payload FROM change_events ORDER BY id`)
+	require.NoError(t, err)
+	defer rows.Close()
+	var events []domain.ServiceChanged
+	for rows.Next() {
+		var payload []byte
+		require.NoError(t, rows.Scan(&payload))
+		var event domain.ServiceChanged
+		require.NoError(t, json.Unmarshal(payload, &event))
+		events = append(events, event)
+	}
+	require.NoError(t, rows.Err())
+
+	// The insert, the change from the stored record and, if the newer scan
+	// committed second, a refresh of the record the older one wrote
+	require.GreaterOrEqual(t, len(events), 2)
+	require.LessOrEqual(t, len(events), 3)
+	changed := events[1]
+	assert.Equal(t, domain.ChangeChanged, changed.Kind)
+	assert.Equal(t, domain.HashResponse("old"), changed.OldResponseHash)
+	require.NotNil(t, changed.PreviousScanned)
+	assert.True(t, stored.Equal(*changed.PreviousScanned), "previous scanned %s", changed.PreviousScanned)
+	for _, event := range events[2:] {
+		assert.Equal(t, domain.ChangeUnchangedRefresh, event.Kind)
+		assert.Equal(t, domain.HashResponse("new"), event.OldResponseHash)
+		require.NotNil(t, event.PreviousScanned)
+		assert.True(t, changed.LastScanned.Equal(*event.PreviousScanned), "previous scanned %s", event.PreviousScanned)
+	}
+}
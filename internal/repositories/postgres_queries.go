@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+// ListScans returns records matching filter ordered by (ip, port, service),
+// using the key in filter.After for keyset pagination. Keys are compared
+// byte by byte under the "C" collation, whatever the database's default, so
+// every backend lists records in the same order. Address criteria use the
+// inet ip_addr column and its GiST index.
+func (r *PostgresRepository) ListScans(ctx context.Context, filter domain.ScanFilter) ([]domain.ServiceScan, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	return withRetry(ctx, r.retry, "list_scans", func(ctx context.Context) ([]domain.ServiceScan, error) {
+		return r.listScans(ctx, filter)
+	})
+}
+
+func (r *PostgresRepository) listScans(ctx context.Context, filter domain.ScanFilter) (_ []domain.ServiceScan, err error) {
+	ctx, done := startQuery(ctx, "list_scans")
+	defer func() { done(err) }()
+
+	var conditions []string
+	var args []interface{}
+	addCondition := func(format string, values ...interface{}) {
+		placeholders := make([]interface{}, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		conditions = append(conditions, fmt.Sprintf(format, placeholders...))
+	}
+
+	if filter.IP != "" {
+		addCondition("ip = %s", filter.IP)
+	}
+	if filter.Network.IsValid() {
+		addCondition("ip_addr <<= %s::inet", filter.Network.Masked().String())
+	}
+	if filter.RangeStart.IsValid() {
+		addCondition("ip_addr BETWEEN %s::inet AND %s::inet", filter.RangeStart.String(), filter.RangeEnd.String())
+	}
+	if filter.Family != domain.AnyFamily {
+		addCondition("family(ip_addr) = %s", int(filter.Family))
+	}
+	if filter.Port != 0 {
+		addCondition("port = %s", filter.Port)
+	}
+	if filter.Service != "" {
+		addCondition("service = %s", filter.Service)
+	}
+	if !filter.ScannedAfter.IsZero() {
+		addCondition("last_scanned >= %s", filter.ScannedAfter)
+	}
+	if !filter.ScannedBefore.IsZero() {
+		addCondition("last_scanned < %s", filter.ScannedBefore)
+	}
+	if filter.After != nil {
+		addCondition(`(ip COLLATE "C", port, service COLLATE "C") > (%s, %s, %s)`, filter.After.IP, filter.After.Port, filter.After.Service)
+	}
+
+	var query strings.Builder
+	query.WriteString(`
+		SELECT ip, port, service, response, last_scanned
+		FROM service_scans`)
+	if len(conditions) > 0 {
+		query.WriteString("\n\t\tWHERE ")
+		query.WriteString(strings.Join(conditions, " AND "))
+	}
+	query.WriteString("\n\t\tORDER BY ip COLLATE \"C\", port, service COLLATE \"C\"")
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		fmt.Fprintf(&query, "\n\t\tLIMIT $%d", len(args))
+	}
+
+	rows, err := r.db.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scans: %w", err)
+	}
+	defer rows.Close()
+
+	var scans []domain.ServiceScan
+	for rows.Next() {
+		var scan domain.ServiceScan
+		if err := rows.Scan(&scan.IP, &scan.Port, &scan.Service, &scan.Response, &scan.LastScanned); err != nil {
+			return nil, fmt.Errorf("failed to scan record: %w", err)
+		}
+		scans = append(scans, scan)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list scans: %w", err)
+	}
+
+	return scans, nil
+}
@@ -3,31 +3,83 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"net/netip"
+	"strings"
+	"time"
 
 	"github.com/censys/scan-takehome/internal/domain"
 )
 
+// maxUpsertRows keeps a multi-row upsert well below Postgres' limit of 65535
+// bind parameters per statement
+const maxUpsertRows = 1000
+
 type PostgresRepository struct {
-	db *sql.DB
+	db    *sql.DB
+	retry RetryPolicy
+
+	changeEvents   bool
+	onChangeEvents func()
+}
+
+// PostgresOption configures optional behavior of a PostgresRepository
+type PostgresOption func(*PostgresRepository)
+
+// WithChangeEvents writes a ServiceChanged event to the change_events outbox
+// in the same transaction as every winning upsert. notify, if set, is called
+// after a commit that produced events so a relay can publish them promptly.
+func WithChangeEvents(notify func()) PostgresOption {
+	return func(r *PostgresRepository) {
+		r.changeEvents = true
+		r.onChangeEvents = notify
+	}
 }
 
-func NewPostgresRepository(db *sql.DB) *PostgresRepository {
-	return &PostgresRepository{
+func NewPostgresRepository(db *sql.DB, opts ...PostgresOption) *PostgresRepository {
+	r := &PostgresRepository{
 		db: db,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Ping reports whether the database is reachable
+func (r *PostgresRepository) Ping(ctx context.Context) error {
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to reach database: %w", err)
+	}
+	return nil
 }
 
 func (r *PostgresRepository) GetLatestScan(ctx context.Context, ip string, port uint32, service string) (*domain.ServiceScan, error) {
+	return withRetry(ctx, r.retry, "get_latest_scan", func(ctx context.Context) (*domain.ServiceScan, error) {
+		return r.getLatestScan(ctx, ip, port, service)
+	})
+}
+
+func (r *PostgresRepository) getLatestScan(ctx context.Context, ip string, port uint32, service string) (_ *domain.ServiceScan, err error) {
+	ctx, done := startQuery(ctx, "get_latest_scan")
+	defer func() { done(err) }()
+
+	// Every stored scan has a valid address, so one the inet cast would
+	// reject matches nothing
+	addr, parseErr := netip.ParseAddr(ip)
+	if parseErr != nil || addr.Zone() != "" {
+		return nil, nil
+	}
+
+	// ip_addr is the upsert's key, so any spelling of the address matches
 	query := `
 		SELECT ip, port, service, response, last_scanned 
 		FROM service_scans 
-		WHERE ip = $1 AND port = $2 AND service = $3
-		ORDER BY last_scanned DESC 
-		LIMIT 1`
+		WHERE ip_addr = $1::inet AND port = $2 AND service = $3`
 
 	var scan domain.ServiceScan
-	err := r.db.QueryRowContext(ctx, query, ip, port, service).Scan(
+	err = r.db.QueryRowContext(ctx, query, addr.Unmap().String(), port, service).Scan(
 		&scan.IP, &scan.Port, &scan.Service, &scan.Response, &scan.LastScanned,
 	)
 
@@ -41,22 +93,253 @@ func (r *PostgresRepository) GetLatestScan(ctx context.Context, ip string, port
 	return &scan, nil
 }
 
-func (r *PostgresRepository) UpsertScan(ctx context.Context, scan *domain.ServiceScan) error {
-	query := `
-		INSERT INTO service_scans (ip, port, service, response, last_scanned)
-		VALUES ($1, $2, $3, $4, $5)
-		ON CONFLICT (ip, port, service) 
-		DO UPDATE SET 
-			response = EXCLUDED.response,
-			last_scanned = EXCLUDED.last_scanned
-		WHERE service_scans.last_scanned < EXCLUDED.last_scanned`
+// errInsertRace means another writer inserted a key between the lock of the
+// existing rows and the upsert, so the values the upsert replaced are unknown
+var errInsertRace = errors.New("record was inserted concurrently")
 
-	_, err := r.db.ExecContext(ctx, query,
-		scan.IP, scan.Port, scan.Service, scan.Response, scan.LastScanned)
+// UpsertScan writes the scan if it is newer than the stored record and reports
+// what happened. A stale scan matches the conflict but is filtered out by the
+// WHERE clause, so no row is returned for it.
+func (r *PostgresRepository) UpsertScan(ctx context.Context, scan *domain.ServiceScan) (domain.UpsertOutcome, error) {
+	outcomes, err := r.UpsertScans(ctx, []*domain.ServiceScan{scan})
+	if err != nil {
+		return 0, err
+	}
+
+	return outcomes[0], nil
+}
 
+// UpsertScans writes all scans with one multi-row INSERT ... ON CONFLICT per
+// maxUpsertRows, records response changes in service_scan_history, writes
+// change events to the outbox when enabled, and returns the outcome of each
+// scan in input order. Everything happens in one transaction. Keys must be
+// unique within the batch, otherwise Postgres rejects the statement for
+// touching a row twice.
+//
+// Outcomes, history and events are derived from the stored rows, which are
+// locked before the upsert so a concurrent writer cannot change them in
+// between. A key another writer inserted after that lock has committed by
+// the time the upsert overwrites it, so the transaction is rolled back and
+// run again, which locks it this time. Each rerun needs a new key to be
+// inserted concurrently, so the loop ends within one run per key.
+func (r *PostgresRepository) UpsertScans(ctx context.Context, scans []*domain.ServiceScan) ([]domain.UpsertOutcome, error) {
+	if len(scans) == 0 {
+		return nil, nil
+	}
+
+	return withRetry(ctx, r.retry, "upsert_scans", func(ctx context.Context) ([]domain.UpsertOutcome, error) {
+		ctx, done := startQuery(ctx, "upsert_scans")
+		outcomes, err := r.writeScans(ctx, scans)
+		for errors.Is(err, errInsertRace) {
+			outcomes, err = r.writeScans(ctx, scans)
+		}
+		done(err)
+		return outcomes, err
+	})
+}
+
+func (r *PostgresRepository) writeScans(ctx context.Context, scans []*domain.ServiceScan) ([]domain.UpsertOutcome, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to upsert scan: %w", err)
+		return nil, fmt.Errorf("failed to begin upsert: %w", err)
 	}
+	defer func() {
+		// Rollback is a no-op once the transaction has been committed
+		_ = tx.Rollback()
+	}()
 
-	return nil
+	outcomes := make([]domain.UpsertOutcome, 0, len(scans))
+	eventsWritten := false
+	for start := 0; start < len(scans); start += maxUpsertRows {
+		end := start + maxUpsertRows
+		if end > len(scans) {
+			end = len(scans)
+		}
+		chunk := scans[start:end]
+
+		results, err := upsertScans(ctx, tx, chunk)
+		if errors.Is(err, errInsertRace) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to upsert scans: %w", err)
+		}
+		if err := recordHistory(ctx, tx, chunk, results); err != nil {
+			return nil, fmt.Errorf("failed to record scan history: %w", err)
+		}
+		if r.changeEvents {
+			written, err := insertChangeEvents(ctx, tx, chunk, results)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write change events: %w", err)
+			}
+			eventsWritten = eventsWritten || written
+		}
+
+		for _, result := range results {
+			outcomes = append(outcomes, result.outcome)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit upsert: %w", &commitError{err: err})
+	}
+
+	if eventsWritten && r.onChangeEvents != nil {
+		r.onChangeEvents()
+	}
+
+	return outcomes, nil
+}
+
+type upsertResult struct {
+	outcome          domain.UpsertOutcome
+	previousResponse string
+	previousScanned  *time.Time
+}
+
+// upsertScans locks the stored rows of scans, upserts scans and classifies
+// each against the row it replaced
+func upsertScans(ctx context.Context, tx *sql.Tx, scans []*domain.ServiceScan) ([]upsertResult, error) {
+	stored, err := lockStoredScans(ctx, tx, scans)
+	if err != nil {
+		return nil, err
+	}
+
+	written, err := writeUpsert(ctx, tx, scans)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]upsertResult, len(scans))
+	for i, scan := range scans {
+		inserted, ok := written[scan.Key()]
+		previous, locked := stored[i]
+		if ok && !inserted && !locked {
+			return nil, errInsertRace
+		}
+
+		results[i] = upsertResult{
+			outcome:          domain.ClassifyUpsert(ok, inserted, previous.response, scan.Response),
+			previousResponse: previous.response,
+		}
+		if locked {
+			previousScanned := previous.lastScanned
+			results[i].previousScanned = &previousScanned
+		}
+	}
+
+	return results, nil
+}
+
+type storedScan struct {
+	response    string
+	lastScanned time.Time
+}
+
+// lockStoredScans locks the existing rows for scans in key order, so batches
+// sharing keys cannot deadlock, and returns them by position in scans.
+// FOR UPDATE reads the latest committed version of each row, not the
+// statement's snapshot, and nothing else can change a locked row until the
+// transaction ends.
+func lockStoredScans(ctx context.Context, tx *sql.Tx, scans []*domain.ServiceScan) (_ map[int]storedScan, err error) {
+	ctx, done := startQuery(ctx, "lock_service_scans")
+	defer func() { done(err) }()
+
+	const columns = 4
+
+	var query strings.Builder
+	query.WriteString(`
+		SELECT requested.position, service_scans.response, service_scans.last_scanned
+		FROM service_scans
+		JOIN (VALUES `)
+
+	args := make([]interface{}, 0, len(scans)*columns)
+	for i, scan := range scans {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		n := i * columns
+		fmt.Fprintf(&query, "($%d::integer, $%d::inet, $%d::integer, $%d::text)", n+1, n+2, n+3, n+4)
+		args = append(args, i, scan.IP, scan.Port, scan.Service)
+	}
+
+	query.WriteString(`) AS requested (position, ip_addr, port, service)
+			ON service_scans.ip_addr = unmap_inet(requested.ip_addr)
+			AND service_scans.port = requested.port
+			AND service_scans.service = requested.service
+		ORDER BY service_scans.ip_addr, service_scans.port, service_scans.service
+		FOR UPDATE OF service_scans`)
+
+	rows, err := tx.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := make(map[int]storedScan, len(scans))
+	for rows.Next() {
+		var position int
+		var scan storedScan
+		if err := rows.Scan(&position, &scan.response, &scan.lastScanned); err != nil {
+			return nil, err
+		}
+		stored[position] = scan
+	}
+	return stored, rows.Err()
+}
+
+// writeUpsert runs the upsert and reports, for every key it wrote, whether
+// the row was inserted. Stale scans are not written and have no entry.
+func writeUpsert(ctx context.Context, tx *sql.Tx, scans []*domain.ServiceScan) (_ map[domain.ServiceKey]bool, err error) {
+	ctx, done := startQuery(ctx, "insert_service_scans")
+	defer func() { done(err) }()
+
+	query, args := buildUpsert(scans)
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	written := make(map[domain.ServiceKey]bool, len(scans))
+	for rows.Next() {
+		var key domain.ServiceKey
+		var inserted bool
+		if err := rows.Scan(&key.IP, &key.Port, &key.Service, &inserted); err != nil {
+			return nil, err
+		}
+		written[key] = inserted
+	}
+	return written, rows.Err()
+}
+
+func buildUpsert(scans []*domain.ServiceScan) (string, []interface{}) {
+	const columns = 5
+
+	var query strings.Builder
+	query.WriteString(`
+		INSERT INTO service_scans (ip, port, service, response, last_scanned)
+		VALUES `)
+
+	args := make([]interface{}, 0, len(scans)*columns)
+	for i, scan := range scans {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		n := i * columns
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5)
+		args = append(args, scan.IP, scan.Port, scan.Service, scan.Response, scan.LastScanned)
+	}
+
+	query.WriteString(`
+		ON CONFLICT (ip_addr, port, service)
+		DO UPDATE SET
+			ip = EXCLUDED.ip,
+			response = EXCLUDED.response,
+			last_scanned = EXCLUDED.last_scanned
+		WHERE service_scans.last_scanned < EXCLUDED.last_scanned
+		RETURNING ip, port, service, (xmax = 0) AS inserted`)
+
+	return query.String(), args
 }
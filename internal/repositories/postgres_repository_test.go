@@ -0,0 +1,48 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/censys/scan-takehome/internal/db"
+	"github.com/censys/scan-takehome/internal/repositories/repotest"
+)
+
+// TestPostgresRepository_Conformance runs against the database in
+// TEST_DATABASE_DSN, which it migrates and empties between subtests. Never
+// point it at a database whose data matters.
+func TestPostgresRepository_Conformance(t *testing.T) {
+	ctx := context.Background()
+	database := openTestDatabase(t)
+
+	repotest.Run(t, func(t *testing.T) repotest.Repository {
+		_, err := database.ExecContext(ctx, `TRUNCATE service_scans, service_scan_history`)
+		require.NoError(t, err)
+		return NewPostgresRepository(database)
+	})
+}
+
+// openTestDatabase connects to TEST_DATABASE_DSN and migrates it, or skips
+// the test when it is not set
+func openTestDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	ctx := context.Background()
+	database, err := db.Open(ctx, db.Config{DSN: dsn})
+	require.NoError(t, err)
+	t.Cleanup(func() { database.Close() })
+
+	migrator, err := db.NewMigrator(database)
+	require.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	return database
+}
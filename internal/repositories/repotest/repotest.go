@@ -0,0 +1,462 @@
+// Package repotest is the conformance suite every scan repository must pass,
+// so the in-memory store and the databases behave the same for the worker and
+// the query API
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/censys/scan-takehome/internal/api"
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/services"
+)
+
+// Repository is what the suite exercises: the writes of the consumer and the
+// reads of the query API
+type Repository interface {
+	services.ScanRepository
+	api.ScanReader
+}
+
+// base is the time scans in the suite are taken relative to. Times are whole
+// UTC microseconds so every store can hold them exactly.
+var base = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// Run runs the suite. newRepository must return an empty repository on every
+// call; subtests do not run in parallel, so it may reset a shared database.
+func Run(t *testing.T, newRepository func(t *testing.T) Repository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo Repository)
+	}{
+		{"UpsertInsertsNewService", testUpsertInserts},
+		{"NewerScanWins", testNewerScanWins},
+		{"OlderScanIsStale", testOlderScanIsStale},
+		{"SameTimestampIsStale", testSameTimestampIsStale},
+		{"IdenticalResponseRefreshesTimestamp", testIdenticalRefreshes},
+		{"GetLatestScanMissing", testGetLatestScanMissing},
+		{"LookupsMatchAnySpellingOfTheAddress", testLookupSpellings},
+		{"UpsertScansEmpty", testUpsertScansEmpty},
+		{"UpsertScansOutcomesInInputOrder", testUpsertScansOutcomes},
+		{"HistoryFollowsResponseChanges", testHistory},
+		{"HistoryMissing", testHistoryMissing},
+		{"ListScansOrderAndPagination", testListScansPagination},
+		{"ListScansOrdersKeysByteByByte", testListScansByteOrder},
+		{"ListScansFilters", testListScansFilters},
+		{"ListScansRejectsInvalidFilter", testListScansInvalidFilter},
+		{"ConcurrentUpsertsKeepNewest", testConcurrentUpserts},
+		{"ConcurrentBatchesClassifyAgainstStoredRecord", testConcurrentBatchOutcomes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepository(t))
+		})
+	}
+}
+
+func scanAt(ip string, port uint32, service, response string, offset time.Duration) *domain.ServiceScan {
+	return &domain.ServiceScan{
+		IP:          ip,
+		Port:        port,
+		Service:     service,
+		Response:    response,
+		LastScanned: base.Add(offset),
+	}
+}
+
+func upsert(t *testing.T, repo Repository, scan *domain.ServiceScan) domain.UpsertOutcome {
+	t.Helper()
+	outcome, err := repo.UpsertScan(context.Background(), scan)
+	require.NoError(t, err)
+	return outcome
+}
+
+// assertStored checks the record for want's key holds want's response and time
+func assertStored(t *testing.T, repo Repository, want *domain.ServiceScan) {
+	t.Helper()
+	got, err := repo.GetLatestScan(context.Background(), want.IP, want.Port, want.Service)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, want.Key(), got.Key())
+	assert.Equal(t, want.Response, got.Response)
+	assert.True(t, want.LastScanned.Equal(got.LastScanned), "last scanned %s, want %s", got.LastScanned, want.LastScanned)
+}
+
+func keys(scans []domain.ServiceScan) []domain.ServiceKey {
+	result := make([]domain.ServiceKey, len(scans))
+	for i := range scans {
+		result[i] = scans[i].Key()
+	}
+	return result
+}
+
+func testUpsertInserts(t *testing.T, repo Repository) {
+	scan := scanAt("10.0.0.1", 80, "HTTP", "hello", 0)
+
+	assert.Equal(t, domain.OutcomeInserted, upsert(t, repo, scan))
+	assertStored(t, repo, scan)
+}
+
+func testNewerScanWins(t *testing.T, repo Repository) {
+	upsert(t, repo, scanAt("10.0.0.1", 80, "HTTP", "old", 0))
+	newer := scanAt("10.0.0.1", 80, "HTTP", "new", time.Minute)
+
+	assert.Equal(t, domain.OutcomeUpdated, upsert(t, repo, newer))
+	assertStored(t, repo, newer)
+}
+
+func testOlderScanIsStale(t *testing.T, repo Repository) {
+	current := scanAt("10.0.0.1", 80, "HTTP", "current", time.Minute)
+	upsert(t, repo, current)
+
+	assert.Equal(t, domain.OutcomeStale, upsert(t, repo, scanAt("10.0.0.1", 80, "HTTP", "older", 0)))
+	assertStored(t, repo, current)
+}
+
+func testSameTimestampIsStale(t *testing.T, repo Repository) {
+	current := scanAt("10.0.0.1", 80, "HTTP", "first", 0)
+	upsert(t, repo, current)
+
+	assert.Equal(t, domain.OutcomeStale, upsert(t, repo, scanAt("10.0.0.1", 80, "HTTP", "second", 0)))
+	assertStored(t, repo, current)
+}
+
+func testIdenticalRefreshes(t *testing.T, repo Repository) {
+	upsert(t, repo, scanAt("10.0.0.1", 80, "HTTP", "same", 0))
+	refreshed := scanAt("10.0.0.1", 80, "HTTP", "same", time.Hour)
+
+	assert.Equal(t, domain.OutcomeIdentical, upsert(t, repo, refreshed))
+	assertStored(t, repo, refreshed)
+}
+
+func testGetLatestScanMissing(t *testing.T, repo Repository) {
+	upsert(t, repo, scanAt("10.0.0.1", 80, "HTTP", "hello", 0))
+
+	for _, key := range []domain.ServiceKey{
+		{IP: "10.0.0.2", Port: 80, Service: "HTTP"},
+		{IP: "10.0.0.1", Port: 443, Service: "HTTP"},
+		{IP: "10.0.0.1", Port: 80, Service: "SSH"},
+	} {
+		scan, err := repo.GetLatestScan(context.Background(), key.IP, key.Port, key.Service)
+		require.NoError(t, err)
+		assert.Nil(t, scan, "scan for %+v", key)
+	}
+}
+
+func testLookupSpellings(t *testing.T, repo Repository) {
+	upsert(t, repo, scanAt("10.0.0.1", 80, "HTTP", "v4", 0))
+	upsert(t, repo, scanAt("2001:db8::1", 80, "HTTP", "v6", 0))
+
+	for ip, want := range map[string]string{"::ffff:10.0.0.1": "10.0.0.1", "2001:DB8:0::1": "2001:db8::1"} {
+		got, err := repo.GetLatestScan(context.Background(), ip, 80, "HTTP")
+		require.NoError(t, err)
+		require.NotNil(t, got, ip)
+		assert.Equal(t, want, got.IP)
+
+		history, err := repo.GetScanHistory(context.Background(), ip, 80, "HTTP")
+		require.NoError(t, err)
+		assert.Len(t, history, 1, ip)
+	}
+
+	got, err := repo.GetLatestScan(context.Background(), "not-an-ip", 80, "HTTP")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func testUpsertScansEmpty(t *testing.T, repo Repository) {
+	outcomes, err := repo.UpsertScans(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, outcomes)
+}
+
+func testUpsertScansOutcomes(t *testing.T, repo Repository) {
+	upsert(t, repo, scanAt("10.0.0.1", 80, "HTTP", "a", time.Minute))
+	upsert(t, repo, scanAt("10.0.0.2", 80, "HTTP", "b", 0))
+	upsert(t, repo, scanAt("10.0.0.3", 80, "HTTP", "c", 0))
+
+	outcomes, err := repo.UpsertScans(context.Background(), []*domain.ServiceScan{
+		scanAt("10.0.0.4", 80, "HTTP", "d", 0),
+		scanAt("10.0.0.1", 80, "HTTP", "a2", 0),
+		scanAt("10.0.0.2", 80, "HTTP", "b2", time.Minute),
+		scanAt("10.0.0.3", 80, "HTTP", "c", time.Minute),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []domain.UpsertOutcome{
+		domain.OutcomeInserted,
+		domain.OutcomeStale,
+		domain.OutcomeUpdated,
+		domain.OutcomeIdentical,
+	}, outcomes)
+
+	assertStored(t, repo, scanAt("10.0.0.1", 80, "HTTP", "a", time.Minute))
+	assertStored(t, repo, scanAt("10.0.0.2", 80, "HTTP", "b2", time.Minute))
+	assertStored(t, repo, scanAt("10.0.0.4", 80, "HTTP", "d", 0))
+}
+
+func testHistory(t *testing.T, repo Repository) {
+	upsert(t, repo, scanAt("10.0.0.1", 80, "HTTP", "v1", 0))
+	upsert(t, repo, scanAt("10.0.0.1", 80, "HTTP", "v1", time.Hour))
+	upsert(t, repo, scanAt("10.0.0.1", 80, "HTTP", "v2", 2*time.Hour))
+	// Neither a stale scan nor an older identical one touches the history
+	upsert(t, repo, scanAt("10.0.0.1", 80, "HTTP", "v3", 30*time.Minute))
+	upsert(t, repo, scanAt("10.0.0.1", 80, "HTTP", "v2", 90*time.Minute))
+	upsert(t, repo, scanAt("10.0.0.1", 80, "HTTP", "v2", 3*time.Hour))
+	upsert(t, repo, scanAt("10.0.0.2", 80, "HTTP", "other", 0))
+
+	history, err := repo.GetScanHistory(context.Background(), "10.0.0.1", 80, "HTTP")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+
+	first, second := history[0], history[1]
+	assert.Equal(t, "v1", first.Response)
+	assert.Equal(t, domain.HashResponse("v1"), first.ResponseHash)
+	assert.Empty(t, first.PreviousResponseHash)
+	assert.True(t, base.Equal(first.FirstSeen), "first seen %s", first.FirstSeen)
+	assert.True(t, base.Add(time.Hour).Equal(first.LastSeen), "last seen %s", first.LastSeen)
+
+	assert.Equal(t, "10.0.0.1", second.IP)
+	assert.Equal(t, uint32(80), second.Port)
+	assert.Equal(t, "HTTP", second.Service)
+	assert.Equal(t, "v2", second.Response)
+	assert.Equal(t, domain.HashResponse("v2"), second.ResponseHash)
+	assert.Equal(t, domain.HashResponse("v1"), second.PreviousResponseHash)
+	assert.True(t, base.Add(2*time.Hour).Equal(second.FirstSeen), "first seen %s", second.FirstSeen)
+	assert.True(t, base.Add(3*time.Hour).Equal(second.LastSeen), "last seen %s", second.LastSeen)
+}
+
+func testHistoryMissing(t *testing.T, repo Repository) {
+	history, err := repo.GetScanHistory(context.Background(), "10.0.0.1", 80, "HTTP")
+	require.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func testListScansPagination(t *testing.T, repo Repository) {
+	// Inserted out of order; the listing sorts by (ip, port, service)
+	for _, scan := range []*domain.ServiceScan{
+		scanAt("10.0.0.2", 22, "SSH", "r", 0),
+		scanAt("10.0.0.1", 443, "HTTP", "r", 0),
+		scanAt("10.0.0.1", 80, "HTTP", "r", 0),
+		scanAt("10.0.0.1", 80, "DNS", "r", 0),
+		scanAt("192.168.0.1", 53, "DNS", "r", 0),
+	} {
+		upsert(t, repo, scan)
+	}
+	want := []domain.ServiceKey{
+		{IP: "10.0.0.1", Port: 80, Service: "DNS"},
+		{IP: "10.0.0.1", Port: 80, Service: "HTTP"},
+		{IP: "10.0.0.1", Port: 443, Service: "HTTP"},
+		{IP: "10.0.0.2", Port: 22, Service: "SSH"},
+		{IP: "192.168.0.1", Port: 53, Service: "DNS"},
+	}
+
+	all, err := repo.ListScans(context.Background(), domain.ScanFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, want, keys(all))
+
+	var pages [][]domain.ServiceKey
+	filter := domain.ScanFilter{Limit: 2}
+	for {
+		page, err := repo.ListScans(context.Background(), filter)
+		require.NoError(t, err)
+		if len(page) == 0 {
+			break
+		}
+		pages = append(pages, keys(page))
+		last := page[len(page)-1].Key()
+		filter.After = &last
+	}
+	assert.Equal(t, [][]domain.ServiceKey{want[0:2], want[2:4], want[4:5]}, pages)
+}
+
+// testListScansByteOrder uses keys that a linguistic collation, which skips
+// punctuation and folds case at first, would order differently than bytes
+func testListScansByteOrder(t *testing.T, repo Repository) {
+	for _, scan := range []*domain.ServiceScan{
+		scanAt("1.1.11.0", 80, "HTTP", "r", 0),
+		scanAt("1.1.1.2", 80, "HTTP", "r", 0),
+		scanAt("1.1.1.10", 80, "dns", "r", 0),
+		scanAt("1.1.1.10", 80, "HTTP", "r", 0),
+	} {
+		upsert(t, repo, scan)
+	}
+	want := []domain.ServiceKey{
+		{IP: "1.1.1.10", Port: 80, Service: "HTTP"},
+		{IP: "1.1.1.10", Port: 80, Service: "dns"},
+		{IP: "1.1.1.2", Port: 80, Service: "HTTP"},
+		{IP: "1.1.11.0", Port: 80, Service: "HTTP"},
+	}
+
+	var listed []domain.ServiceKey
+	filter := domain.ScanFilter{Limit: 1}
+	for {
+		page, err := repo.ListScans(context.Background(), filter)
+		require.NoError(t, err)
+		if len(page) == 0 {
+			break
+		}
+		listed = append(listed, keys(page)...)
+		last := page[len(page)-1].Key()
+		filter.After = &last
+	}
+	assert.Equal(t, want, listed)
+}
+
+func testListScansFilters(t *testing.T, repo Repository) {
+	for _, scan := range []*domain.ServiceScan{
+		scanAt("10.0.0.1", 80, "HTTP", "r", 0),
+		scanAt("10.0.0.2", 22, "SSH", "r", time.Hour),
+		scanAt("10.0.1.1", 80, "HTTP", "r", 2*time.Hour),
+		scanAt("192.168.0.1", 53, "DNS", "r", 3*time.Hour),
+		scanAt("2001:db8::1", 80, "HTTP", "r", 4*time.Hour),
+		scanAt("::ffff:10.0.0.3", 80, "HTTP", "r", 5*time.Hour),
+	} {
+		upsert(t, repo, scan)
+	}
+
+	tests := []struct {
+		filter domain.ScanFilter
+		want   []string
+	}{
+		{domain.ScanFilter{IP: "10.0.0.2"}, []string{"10.0.0.2"}},
+		{domain.ScanFilter{Port: 80}, []string{"10.0.0.1", "10.0.1.1", "2001:db8::1", "::ffff:10.0.0.3"}},
+		{domain.ScanFilter{Service: "DNS"}, []string{"192.168.0.1"}},
+		{domain.ScanFilter{Port: 80, Service: "SSH"}, nil},
+		{domain.ScanFilter{Network: netip.MustParsePrefix("10.0.0.0/24")}, []string{"10.0.0.1", "10.0.0.2"}},
+		{domain.ScanFilter{Network: netip.MustParsePrefix("10.0.0.0/8")}, []string{"10.0.0.1", "10.0.0.2", "10.0.1.1"}},
+		{domain.ScanFilter{Network: netip.MustParsePrefix("2001:db8::/32")}, []string{"2001:db8::1"}},
+		{
+			domain.ScanFilter{RangeStart: netip.MustParseAddr("10.0.0.2"), RangeEnd: netip.MustParseAddr("192.168.0.1")},
+			[]string{"10.0.0.2", "10.0.1.1", "192.168.0.1"},
+		},
+		{domain.ScanFilter{Family: domain.IPv4}, []string{"10.0.0.1", "10.0.0.2", "10.0.1.1", "192.168.0.1"}},
+		{domain.ScanFilter{Family: domain.IPv6}, []string{"2001:db8::1", "::ffff:10.0.0.3"}},
+		{domain.ScanFilter{ScannedAfter: base.Add(time.Hour)}, []string{"10.0.0.2", "10.0.1.1", "192.168.0.1", "2001:db8::1", "::ffff:10.0.0.3"}},
+		{domain.ScanFilter{ScannedBefore: base.Add(time.Hour)}, []string{"10.0.0.1"}},
+		{
+			domain.ScanFilter{Family: domain.IPv4, Port: 80, ScannedAfter: base.Add(time.Minute), ScannedBefore: base.Add(4 * time.Hour)},
+			[]string{"10.0.1.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%+v", tt.filter), func(t *testing.T) {
+			scans, err := repo.ListScans(context.Background(), tt.filter)
+			require.NoError(t, err)
+
+			var ips []string
+			for _, scan := range scans {
+				ips = append(ips, scan.IP)
+			}
+			assert.Equal(t, tt.want, ips)
+		})
+	}
+}
+
+func testListScansInvalidFilter(t *testing.T, repo Repository) {
+	_, err := repo.ListScans(context.Background(), domain.ScanFilter{RangeStart: netip.MustParseAddr("10.0.0.1")})
+	assert.ErrorIs(t, err, domain.ErrInvalidFilter)
+}
+
+func testConcurrentUpserts(t *testing.T, repo Repository) {
+	const writers = 8
+	const scansPerWriter = 10
+
+	// Writers interleave timestamps for the same keys, so the stored record
+	// must be the newest no matter which write lands last
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < scansPerWriter; i++ {
+				offset := time.Duration(i*writers+w) * time.Second
+				for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+					scan := scanAt(ip, 80, "HTTP", fmt.Sprintf("writer %d scan %d", w, i), offset)
+					if _, err := repo.UpsertScan(context.Background(), scan); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	newest := time.Duration(scansPerWriter*writers-1) * time.Second
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		assertStored(t, repo, scanAt(ip, 80, "HTTP", fmt.Sprintf("writer %d scan %d", writers-1, scansPerWriter-1), newest))
+	}
+}
+
+func testConcurrentBatchOutcomes(t *testing.T, repo Repository) {
+	const rounds = 20
+
+	for round := 0; round < rounds; round++ {
+		ip := fmt.Sprintf("10.1.0.%d", round)
+		upsert(t, repo, scanAt(ip, 22, "SSH", "old", 0))
+
+		// Both batches write the same responses, so whichever commits second
+		// must be classified against the first one's record: port 80 is
+		// inserted once and port 22 updated once, then identical or stale
+		start := make(chan struct{})
+		outcomes := make([][]domain.UpsertOutcome, 2)
+		errs := make([]error, 2)
+		var wg sync.WaitGroup
+		for w := range outcomes {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				<-start
+				offset := time.Duration(w+1) * time.Second
+				outcomes[w], errs[w] = repo.UpsertScans(context.Background(), []*domain.ServiceScan{
+					scanAt(ip, 22, "SSH", "new", offset),
+					scanAt(ip, 80, "HTTP", "banner", offset),
+				})
+			}(w)
+		}
+		close(start)
+		wg.Wait()
+		require.NoError(t, errs[0])
+		require.NoError(t, errs[1])
+
+		for i, first := range []domain.UpsertOutcome{domain.OutcomeUpdated, domain.OutcomeInserted} {
+			got := []domain.UpsertOutcome{outcomes[0][i], outcomes[1][i]}
+			assert.Contains(t, got, first, "round %d scan %d", round, i)
+			assert.Condition(t, func() bool {
+				return (got[0] == first) != (got[1] == first)
+			}, "round %d scan %d: outcomes %v", round, i, got)
+			for _, outcome := range got {
+				assert.Contains(t, []domain.UpsertOutcome{first, domain.OutcomeIdentical, domain.OutcomeStale}, outcome,
+					"round %d scan %d", round, i)
+			}
+		}
+
+		// The history records each response once, chained to the one before
+		history, err := repo.GetScanHistory(context.Background(), ip, 22, "SSH")
+		require.NoError(t, err)
+		require.Len(t, history, 2, "round %d", round)
+		assert.Equal(t, "new", history[1].Response)
+		assert.Equal(t, domain.HashResponse("old"), history[1].PreviousResponseHash)
+		assert.True(t, base.Add(2*time.Second).Equal(history[1].LastSeen), "round %d last seen %s", round, history[1].LastSeen)
+
+		history, err = repo.GetScanHistory(context.Background(), ip, 80, "HTTP")
+		require.NoError(t, err)
+		require.Len(t, history, 1, "round %d", round)
+		assert.Empty(t, history[0].PreviousResponseHash)
+		assert.True(t, base.Add(2*time.Second).Equal(history[0].LastSeen), "round %d last seen %s", round, history[0].LastSeen)
+	}
+}
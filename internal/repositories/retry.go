@@ -0,0 +1,159 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/logging"
+	"github.com/censys/scan-takehome/internal/metrics"
+)
+
+// RetryPolicy retries operations that failed with a transient error, waiting
+// an exponentially growing, jittered backoff between attempts
+type RetryPolicy struct {
+	// MaxAttempts includes the first try; 0 or 1 disables retries
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy rides out a typical failover of a few seconds
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+}
+
+// WithRetry retries reads and writes that fail with a retryable error.
+// Writes run in one transaction, so a retry repeats the whole upsert. A
+// failed COMMIT is never retried: the transaction may have been applied with
+// only its acknowledgement lost, and the retry would then report the scans it
+// wrote as stale.
+func WithRetry(policy RetryPolicy) PostgresOption {
+	return func(r *PostgresRepository) {
+		r.retry = policy
+	}
+}
+
+// SQLSTATEs after which the same statement may succeed
+var retryableCodes = map[pq.ErrorCode]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"53300": true, // too_many_connections
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// SQLSTATEs that mean the server is going away or not accepting connections
+var unavailableCodes = map[pq.ErrorCode]bool{
+	"57P01": true,
+	"57P02": true,
+	"57P03": true,
+}
+
+// commitError marks an error returned by COMMIT, after which the outcome of
+// the transaction is unknown
+type commitError struct {
+	err error
+}
+
+func (e *commitError) Error() string { return e.err.Error() }
+func (e *commitError) Unwrap() error { return e.err }
+
+// IsRetryable reports whether err is transient: a serialization failure,
+// deadlock, or a lost or refused connection, except during COMMIT
+func IsRetryable(err error) bool {
+	var commitErr *commitError
+	if errors.As(err, &commitErr) {
+		return false
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return retryableCodes[pqErr.Code] || pqErr.Code.Class() == "08"
+	}
+	return isConnectionError(err)
+}
+
+// IsUnavailable reports whether err means the database cannot be reached at all
+func IsUnavailable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return unavailableCodes[pqErr.Code] || pqErr.Code.Class() == "08"
+	}
+	return isConnectionError(err)
+}
+
+// isConnectionError matches the errors lib/pq and database/sql return when a
+// connection is reset, refused or closed under them
+func isConnectionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr *net.OpError
+	return errors.As(err, &netErr)
+}
+
+// withRetry runs fn until it succeeds, fails permanently or runs out of
+// attempts. A final error that means the database is down is marked with
+// domain.ErrStoreUnavailable.
+func withRetry[T any](ctx context.Context, policy RetryPolicy, operation string, fn func(ctx context.Context) (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := fn(ctx)
+		if err == nil {
+			return result, nil
+		}
+		if attempt >= policy.MaxAttempts || !IsRetryable(err) || ctx.Err() != nil {
+			if IsUnavailable(err) {
+				err = fmt.Errorf("%w: %w", domain.ErrStoreUnavailable, err)
+			}
+			return result, err
+		}
+
+		backoff := policy.backoff(attempt)
+		logging.FromContext(ctx).Warn("Retrying database operation",
+			"operation", operation, "attempt", attempt, "backoff", backoff.String(), "error", err)
+		metrics.DBRetries.WithLabelValues(operation).Inc()
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff doubles InitialBackoff for every attempt up to MaxBackoff and picks
+// a random wait in the upper half, so workers that failed together spread out
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(backoff-half)+1)) //nolint:gosec // jitter needs no crypto randomness
+}
@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		retryable   bool
+		unavailable bool
+	}{
+		{"serialization failure", &pq.Error{Code: "40001"}, true, false},
+		{"deadlock", &pq.Error{Code: "40P01"}, true, false},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, true, true},
+		{"connection failure", &pq.Error{Code: "08006"}, true, true},
+		{"wrapped bad conn", fmt.Errorf("failed to upsert scans: %w", driver.ErrBadConn), true, true},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true, true},
+		{"connection reset during commit", fmt.Errorf("failed to commit upsert: %w", &commitError{err: fmt.Errorf("read: %w", syscall.ECONNRESET)}), false, true},
+		{"unique violation", &pq.Error{Code: "23505"}, false, false},
+		{"canceled", context.Canceled, false, false},
+		{"other", errors.New("boom"), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.retryable, IsRetryable(tt.err))
+			assert.Equal(t, tt.unavailable, IsUnavailable(tt.err))
+		})
+	}
+}
+
+var fastRetry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+func TestWithRetryRecovers(t *testing.T) {
+	attempts := 0
+	result, err := withRetry(context.Background(), fastRetry, "test", func(context.Context) (int, error) {
+		attempts++
+		if attempts < 3 {
+			return 0, &pq.Error{Code: "40001"}
+		}
+		return 42, nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 42, result)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestWithRetryGivesUp(t *testing.T) {
+	attempts := 0
+	_, err := withRetry(context.Background(), fastRetry, "test", func(context.Context) (int, error) {
+		attempts++
+		return 0, &pq.Error{Code: "57P01"}
+	})
+
+	assert.Equal(t, 3, attempts)
+	assert.ErrorIs(t, err, domain.ErrStoreUnavailable)
+}
+
+func TestWithRetrySkipsPermanentErrors(t *testing.T) {
+	attempts := 0
+	_, err := withRetry(context.Background(), fastRetry, "test", func(context.Context) (int, error) {
+		attempts++
+		return 0, &pq.Error{Code: "23505"}
+	})
+
+	assert.Equal(t, 1, attempts)
+	assert.NotErrorIs(t, err, domain.ErrStoreUnavailable)
+}
+
+func TestWithRetryStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+
+	attempts := 0
+	_, err := withRetry(ctx, policy, "test", func(context.Context) (int, error) {
+		attempts++
+		cancel()
+		return 0, driver.ErrBadConn
+	})
+
+	assert.Equal(t, 1, attempts)
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	for attempt, ceiling := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		5: time.Second,
+		9: time.Second,
+	} {
+		for i := 0; i < 20; i++ {
+			backoff := policy.backoff(attempt)
+			assert.GreaterOrEqual(t, backoff, ceiling/2)
+			assert.LessOrEqual(t, backoff, ceiling)
+		}
+	}
+}
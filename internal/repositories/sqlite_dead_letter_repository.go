@@ -0,0 +1,37 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+type SQLiteDeadLetterRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteDeadLetterRepository(db *sql.DB) *SQLiteDeadLetterRepository {
+	return &SQLiteDeadLetterRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteDeadLetterRepository) SendDeadLetter(ctx context.Context, deadLetter *domain.DeadLetter) error {
+	query := `
+		INSERT INTO dead_letters (message_id, reason, error, delivery_attempt, payload, failed_at)
+		VALUES (?, ?, ?, ?, ?, ?)`
+
+	ctx, done := startSQLiteQuery(ctx, "insert_dead_letter")
+	_, err := r.db.ExecContext(ctx, query,
+		deadLetter.MessageID, deadLetter.Reason, deadLetter.Error,
+		deadLetter.DeliveryAttempt, deadLetter.Payload, formatSQLiteTime(deadLetter.FailedAt))
+	done(err)
+
+	if err != nil {
+		return fmt.Errorf("failed to insert dead letter: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,346 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/censys/scan-takehome/internal/domain"
+)
+
+// sqliteTime is how SQLite columns hold timestamps: UTC and fixed width, so
+// comparing them as text orders them by time. Microseconds match Postgres.
+const sqliteTime = "2006-01-02 15:04:05.000000"
+
+func formatSQLiteTime(t time.Time) string {
+	return t.UTC().Round(time.Microsecond).Format(sqliteTime)
+}
+
+func parseSQLiteTime(value string) (time.Time, error) {
+	return time.ParseInLocation(sqliteTime, value, time.UTC)
+}
+
+// SQLiteRepository stores scans in SQLite with the same schema and
+// newest-timestamp-wins upsert as PostgresRepository, for edge deployments
+// and development without a database server. Open the database with
+// db.OpenSQLite and migrate it with db.NewSQLiteMigrator.
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRepository(db *sql.DB) *SQLiteRepository {
+	return &SQLiteRepository{
+		db: db,
+	}
+}
+
+// Ping reports whether the database is usable
+func (r *SQLiteRepository) Ping(ctx context.Context) error {
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to reach database: %w", err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) GetLatestScan(ctx context.Context, ip string, port uint32, service string) (_ *domain.ServiceScan, err error) {
+	ctx, done := startSQLiteQuery(ctx, "get_latest_scan")
+	defer func() { done(err) }()
+
+	query := `
+		SELECT ip, port, service, response, last_scanned
+		FROM service_scans
+		WHERE ip = ? AND port = ? AND service = ?`
+
+	var scan domain.ServiceScan
+	var lastScanned string
+	err = r.db.QueryRowContext(ctx, query, domain.CanonicalIP(ip), port, service).Scan(
+		&scan.IP, &scan.Port, &scan.Service, &scan.Response, &lastScanned,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest scan: %w", err)
+	}
+	if scan.LastScanned, err = parseSQLiteTime(lastScanned); err != nil {
+		return nil, fmt.Errorf("failed to get latest scan: %w", err)
+	}
+
+	return &scan, nil
+}
+
+// UpsertScan writes the scan if it is newer than the stored record and reports
+// what happened
+func (r *SQLiteRepository) UpsertScan(ctx context.Context, scan *domain.ServiceScan) (domain.UpsertOutcome, error) {
+	outcomes, err := r.UpsertScans(ctx, []*domain.ServiceScan{scan})
+	if err != nil {
+		return 0, err
+	}
+
+	return outcomes[0], nil
+}
+
+// UpsertScans writes the scans and their history in one transaction and
+// returns the outcome of each in input order. The transaction holds SQLite's
+// write lock from the start, so reading the stored record and then writing
+// behaves like the single conditional upsert of Postgres.
+func (r *SQLiteRepository) UpsertScans(ctx context.Context, scans []*domain.ServiceScan) (_ []domain.UpsertOutcome, err error) {
+	if len(scans) == 0 {
+		return nil, nil
+	}
+
+	ctx, done := startSQLiteQuery(ctx, "upsert_scans")
+	defer func() { done(err) }()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin upsert: %w", err)
+	}
+	defer func() {
+		// Rollback is a no-op once the transaction has been committed
+		_ = tx.Rollback()
+	}()
+
+	writer, err := newSQLiteWriter(ctx, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare upsert: %w", err)
+	}
+	defer writer.close()
+
+	outcomes := make([]domain.UpsertOutcome, len(scans))
+	for i, scan := range scans {
+		if outcomes[i], err = writer.upsert(ctx, scan); err != nil {
+			return nil, fmt.Errorf("failed to upsert scans: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit upsert: %w", err)
+	}
+	return outcomes, nil
+}
+
+// sqliteWriter holds the statements of one upsert transaction
+type sqliteWriter struct {
+	selectScan     *sql.Stmt
+	upsertScan     *sql.Stmt
+	insertHistory  *sql.Stmt
+	refreshHistory *sql.Stmt
+}
+
+func newSQLiteWriter(ctx context.Context, tx *sql.Tx) (*sqliteWriter, error) {
+	w := &sqliteWriter{}
+	for _, statement := range []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&w.selectScan, `
+			SELECT response, last_scanned FROM service_scans
+			WHERE ip = ? AND port = ? AND service = ?`},
+		{&w.upsertScan, `
+			INSERT INTO service_scans (ip, port, service, response, last_scanned)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (ip, port, service)
+			DO UPDATE SET
+				response = excluded.response,
+				last_scanned = excluded.last_scanned
+			WHERE service_scans.last_scanned < excluded.last_scanned`},
+		{&w.insertHistory, `
+			INSERT INTO service_scan_history
+				(ip, port, service, response, response_hash, previous_response_hash, first_seen, last_seen)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`},
+		{&w.refreshHistory, `
+			UPDATE service_scan_history
+			SET last_seen = ?1
+			WHERE id = (
+				SELECT latest.id FROM service_scan_history AS latest
+				WHERE latest.ip = ?2 AND latest.port = ?3 AND latest.service = ?4
+				ORDER BY latest.first_seen DESC, latest.id DESC
+				LIMIT 1)
+			AND last_seen < ?1`},
+	} {
+		stmt, err := tx.PrepareContext(ctx, statement.query)
+		if err != nil {
+			w.close()
+			return nil, err
+		}
+		*statement.stmt = stmt
+	}
+	return w, nil
+}
+
+func (w *sqliteWriter) close() {
+	for _, stmt := range []*sql.Stmt{w.selectScan, w.upsertScan, w.insertHistory, w.refreshHistory} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
+
+// upsert applies one scan and records its history like recordHistory does
+// for Postgres: a changed response starts a new entry, an identical one
+// extends last_seen and a stale scan changes nothing
+func (w *sqliteWriter) upsert(ctx context.Context, scan *domain.ServiceScan) (domain.UpsertOutcome, error) {
+	scanned := formatSQLiteTime(scan.LastScanned)
+
+	var previousResponse, previousScanned string
+	err := w.selectScan.QueryRowContext(ctx, scan.IP, scan.Port, scan.Service).Scan(&previousResponse, &previousScanned)
+	exists := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	if exists && previousScanned >= scanned {
+		return domain.OutcomeStale, nil
+	}
+
+	if _, err := w.upsertScan.ExecContext(ctx, scan.IP, scan.Port, scan.Service, scan.Response, scanned); err != nil {
+		return 0, err
+	}
+
+	outcome := domain.ClassifyUpsert(true, !exists, previousResponse, scan.Response)
+	switch outcome {
+	case domain.OutcomeInserted, domain.OutcomeUpdated:
+		var previousHash sql.NullString
+		if outcome == domain.OutcomeUpdated {
+			previousHash = sql.NullString{String: domain.HashResponse(previousResponse), Valid: true}
+		}
+		_, err = w.insertHistory.ExecContext(ctx, scan.IP, scan.Port, scan.Service, scan.Response,
+			domain.HashResponse(scan.Response), previousHash, scanned, scanned)
+	case domain.OutcomeIdentical:
+		_, err = w.refreshHistory.ExecContext(ctx, scanned, scan.IP, scan.Port, scan.Service)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to record scan history: %w", err)
+	}
+	return outcome, nil
+}
+
+// ListScans returns records matching filter ordered by (ip, port, service),
+// using the key in filter.After for keyset pagination. Keys are compared
+// with the BINARY collation, which matches the "C" collation Postgres lists
+// with and the memory store, so every backend pages in the same order. SQLite
+// has no inet type, so address criteria are applied to the rows as they are
+// read.
+func (r *SQLiteRepository) ListScans(ctx context.Context, filter domain.ScanFilter) (_ []domain.ServiceScan, err error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	ctx, done := startSQLiteQuery(ctx, "list_scans")
+	defer func() { done(err) }()
+
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, values ...interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, values...)
+	}
+
+	if filter.IP != "" {
+		addCondition("ip = ?", filter.IP)
+	}
+	if filter.Port != 0 {
+		addCondition("port = ?", filter.Port)
+	}
+	if filter.Service != "" {
+		addCondition("service = ?", filter.Service)
+	}
+	if !filter.ScannedAfter.IsZero() {
+		addCondition("last_scanned >= ?", formatSQLiteTime(filter.ScannedAfter))
+	}
+	if !filter.ScannedBefore.IsZero() {
+		addCondition("last_scanned < ?", formatSQLiteTime(filter.ScannedBefore))
+	}
+	if filter.After != nil {
+		addCondition("(ip COLLATE BINARY, port, service COLLATE BINARY) > (?, ?, ?)", filter.After.IP, filter.After.Port, filter.After.Service)
+	}
+
+	var query strings.Builder
+	query.WriteString(`
+		SELECT ip, port, service, response, last_scanned
+		FROM service_scans`)
+	if len(conditions) > 0 {
+		query.WriteString("\n\t\tWHERE ")
+		query.WriteString(strings.Join(conditions, " AND "))
+	}
+	query.WriteString("\n\t\tORDER BY ip COLLATE BINARY, port, service COLLATE BINARY")
+	filterAddresses := hasAddressCriteria(filter)
+	if filter.Limit > 0 && !filterAddresses {
+		args = append(args, filter.Limit)
+		query.WriteString("\n\t\tLIMIT ?")
+	}
+
+	rows, err := r.db.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scans: %w", err)
+	}
+	defer rows.Close()
+
+	var scans []domain.ServiceScan
+	for (filter.Limit <= 0 || len(scans) < filter.Limit) && rows.Next() {
+		var scan domain.ServiceScan
+		var lastScanned string
+		if err := rows.Scan(&scan.IP, &scan.Port, &scan.Service, &scan.Response, &lastScanned); err != nil {
+			return nil, fmt.Errorf("failed to scan record: %w", err)
+		}
+		if filterAddresses && !matchesAddress(filter, scan.IP) {
+			continue
+		}
+		if scan.LastScanned, err = parseSQLiteTime(lastScanned); err != nil {
+			return nil, fmt.Errorf("failed to scan record: %w", err)
+		}
+		scans = append(scans, scan)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list scans: %w", err)
+	}
+
+	return scans, nil
+}
+
+// GetScanHistory returns every response period recorded for a service, oldest first
+func (r *SQLiteRepository) GetScanHistory(
+	ctx context.Context, ip string, port uint32, service string,
+) (_ []domain.ScanHistoryEntry, err error) {
+	ctx, done := startSQLiteQuery(ctx, "get_scan_history")
+	defer func() { done(err) }()
+
+	query := `
+		SELECT ip, port, service, response, response_hash,
+			COALESCE(previous_response_hash, ''), first_seen, last_seen
+		FROM service_scan_history
+		WHERE ip = ? AND port = ? AND service = ?
+		ORDER BY first_seen, id`
+
+	rows, err := r.db.QueryContext(ctx, query, domain.CanonicalIP(ip), port, service)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scan history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []domain.ScanHistoryEntry
+	for rows.Next() {
+		var entry domain.ScanHistoryEntry
+		var firstSeen, lastSeen string
+		if err := rows.Scan(&entry.IP, &entry.Port, &entry.Service, &entry.Response, &entry.ResponseHash,
+			&entry.PreviousResponseHash, &firstSeen, &lastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan history entry: %w", err)
+		}
+		if entry.FirstSeen, err = parseSQLiteTime(firstSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan history entry: %w", err)
+		}
+		if entry.LastSeen, err = parseSQLiteTime(lastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan history entry: %w", err)
+		}
+		history = append(history, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get scan history: %w", err)
+	}
+
+	return history, nil
+}
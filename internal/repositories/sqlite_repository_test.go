@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/censys/scan-takehome/internal/db"
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/repositories/repotest"
+)
+
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	database, err := db.OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "scans.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { database.Close() })
+
+	migrator, err := db.NewSQLiteMigrator(database)
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+	return database
+}
+
+func TestSQLiteRepository_Conformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repository {
+		return NewSQLiteRepository(openSQLite(t))
+	})
+}
+
+func TestSQLiteRepository_StoresTimesInUTC(t *testing.T) {
+	repo := NewSQLiteRepository(openSQLite(t))
+	ctx := context.Background()
+
+	// 13:00 in UTC+2 is older than 12:30 UTC, whatever their text says
+	zone := time.FixedZone("UTC+2", 2*60*60)
+	_, err := repo.UpsertScan(ctx, &domain.ServiceScan{
+		IP: "10.0.0.1", Port: 80, Service: "HTTP", Response: "utc", LastScanned: time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC),
+	})
+	require.NoError(t, err)
+	outcome, err := repo.UpsertScan(ctx, &domain.ServiceScan{
+		IP: "10.0.0.1", Port: 80, Service: "HTTP", Response: "zoned", LastScanned: time.Date(2024, 3, 1, 13, 0, 0, 0, zone),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, domain.OutcomeStale, outcome)
+}
+
+func TestSQLiteDeadLetterRepository(t *testing.T) {
+	database := openSQLite(t)
+	failedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	err := NewSQLiteDeadLetterRepository(database).SendDeadLetter(context.Background(), &domain.DeadLetter{
+		MessageID: "m1", Reason: "decode", Error: "bad json", DeliveryAttempt: 3, Payload: []byte("{"), FailedAt: failedAt,
+	})
+	require.NoError(t, err)
+
+	var reason, stored string
+	var payload []byte
+	require.NoError(t, database.QueryRow(`SELECT reason, payload, failed_at FROM dead_letters WHERE message_id = 'm1'`).
+		Scan(&reason, &payload, &stored))
+	assert.Equal(t, "decode", reason)
+	assert.Equal(t, []byte("{"), payload)
+	assert.Equal(t, "2024-03-01 12:00:00.000000", stored)
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/logging"
+	"github.com/censys/scan-takehome/internal/tracing"
+)
+
+// ErrBatchProcessorClosed is returned for scans submitted after Close
+var ErrBatchProcessorClosed = errors.New("batch processor closed")
+
+type BatchConfig struct {
+	// MaxSize is the number of scans that triggers a flush
+	MaxSize int
+	// MaxWait is the longest a scan waits for its batch to fill before it is flushed anyway
+	MaxWait time.Duration
+	// Concurrency is the number of batches that may be written at the same time
+	Concurrency int
+}
+
+// BatchProcessor accumulates scans from concurrent callers and writes them
+// with a single UpsertScans call. ProcessScanResult blocks until the batch
+// containing the scan has been committed, so callers can keep acking only
+// after a successful write.
+type BatchProcessor struct {
+	repository ScanRepository
+	config     BatchConfig
+
+	requests chan *batchRequest
+	done     chan struct{}
+	stopped  chan struct{}
+	flushes  sync.WaitGroup
+	slots    chan struct{}
+	// after starts the MaxWait countdown of a new batch
+	after func(time.Duration) <-chan time.Time
+
+	closeOnce sync.Once
+}
+
+type batchRequest struct {
+	scan *domain.ServiceScan
+	// spanContext links the batch's span back to the caller's trace
+	spanContext trace.SpanContext
+	result      chan batchResult
+}
+
+type batchResult struct {
+	outcome domain.UpsertOutcome
+	err     error
+}
+
+func NewBatchProcessor(repository ScanRepository, config BatchConfig) *BatchProcessor {
+	return newBatchProcessor(repository, config, time.After)
+}
+
+func newBatchProcessor(repository ScanRepository, config BatchConfig, after func(time.Duration) <-chan time.Time) *BatchProcessor {
+	if config.MaxSize < 1 {
+		config.MaxSize = 1
+	}
+	if config.MaxWait <= 0 {
+		config.MaxWait = 50 * time.Millisecond
+	}
+	if config.Concurrency < 1 {
+		config.Concurrency = 1
+	}
+
+	bp := &BatchProcessor{
+		repository: repository,
+		config:     config,
+		requests:   make(chan *batchRequest),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+		slots:      make(chan struct{}, config.Concurrency),
+		after:      after,
+	}
+	go bp.run()
+
+	return bp
+}
+
+// ProcessScanResult returns OutcomeStale for a scan that was collapsed into a
+// newer scan for the same key within its batch. Like ScanProcessor it traces
+// and logs the outcome of each scan, with the caller's logger and span, on
+// top of the per-batch span and log of the flush.
+func (bp *BatchProcessor) ProcessScanResult(ctx context.Context, scan *domain.ServiceScan) (domain.UpsertOutcome, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "BatchProcessor.ProcessScanResult")
+
+	req := &batchRequest{scan: scan, spanContext: span.SpanContext(), result: make(chan batchResult, 1)}
+	outcome, err := bp.submit(ctx, req)
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to upsert scan", "error", err)
+		tracing.End(span, err)
+		return 0, err
+	}
+
+	span.SetAttributes(outcomeAttribute(outcome))
+	logOutcome(ctx, scan, outcome)
+	span.End()
+	return outcome, nil
+}
+
+// submit hands req to the batching loop and waits for its batch to commit
+func (bp *BatchProcessor) submit(ctx context.Context, req *batchRequest) (domain.UpsertOutcome, error) {
+	select {
+	case bp.requests <- req:
+	case <-bp.done:
+		return 0, ErrBatchProcessorClosed
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
+	select {
+	case result := <-req.result:
+		return result.outcome, result.err
+	case <-ctx.Done():
+		// The scan may still be written; a redelivery is harmless because
+		// the upsert only ever keeps the newest scan.
+		return 0, ctx.Err()
+	}
+}
+
+// Close flushes any pending scans and waits for in-flight batches to commit
+func (bp *BatchProcessor) Close() error {
+	bp.closeOnce.Do(func() {
+		close(bp.done)
+	})
+	<-bp.stopped
+	return nil
+}
+
+func (bp *BatchProcessor) run() {
+	defer close(bp.stopped)
+
+	var pending []*batchRequest
+	// Each batch gets its own deadline channel. A shared timer would keep a
+	// tick that fired while a full batch was being flushed, since Stop does
+	// not drain it before Go 1.23, and cut the next batch short.
+	var deadline <-chan time.Time
+
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		deadline = nil
+		bp.flush(pending)
+		pending = nil
+	}
+
+	for {
+		select {
+		case req := <-bp.requests:
+			pending = append(pending, req)
+			if len(pending) == 1 {
+				deadline = bp.after(bp.config.MaxWait)
+			}
+			if len(pending) >= bp.config.MaxSize {
+				flush()
+			}
+		case <-deadline:
+			flush()
+		case <-bp.done:
+			flush()
+			bp.flushes.Wait()
+			return
+		}
+	}
+}
+
+// flush writes a batch on its own goroutine once a concurrency slot is free
+func (bp *BatchProcessor) flush(batch []*batchRequest) {
+	bp.slots <- struct{}{}
+	bp.flushes.Add(1)
+
+	go func() {
+		defer func() {
+			<-bp.slots
+			bp.flushes.Done()
+		}()
+
+		scans := make([]*domain.ServiceScan, len(batch))
+		for i, req := range batch {
+			scans[i] = req.scan
+		}
+		collapsed := collapseScans(scans)
+
+		// The batch outlives any single caller, so it is not bound to their
+		// contexts; its span links to theirs instead
+		links := make([]trace.Link, 0, len(batch))
+		for _, req := range batch {
+			if req.spanContext.IsValid() {
+				links = append(links, trace.Link{SpanContext: req.spanContext})
+			}
+		}
+		ctx, span := tracing.Tracer().Start(context.Background(), "BatchProcessor.flush",
+			trace.WithLinks(links...), trace.WithAttributes(attribute.Int("scan.batch_size", len(batch))))
+
+		outcomes, err := bp.repository.UpsertScans(ctx, collapsed)
+		tracing.End(span, err)
+		if err != nil {
+			slog.Error("Failed to upsert batch", "scans", len(collapsed), "error", err)
+			for _, req := range batch {
+				req.result <- batchResult{err: err}
+			}
+			return
+		}
+
+		written := make(map[*domain.ServiceScan]domain.UpsertOutcome, len(collapsed))
+		counts := make(map[domain.UpsertOutcome]int)
+		for i, scan := range collapsed {
+			written[scan] = outcomes[i]
+		}
+		for _, req := range batch {
+			outcome, ok := written[req.scan]
+			if !ok {
+				outcome = domain.OutcomeStale
+			}
+			counts[outcome]++
+			recordOutcome(outcome)
+			req.result <- batchResult{outcome: outcome}
+		}
+
+		slog.Info("Upserted batch", "scans", len(batch),
+			"inserted", counts[domain.OutcomeInserted], "updated", counts[domain.OutcomeUpdated],
+			"identical", counts[domain.OutcomeIdentical], "stale", counts[domain.OutcomeStale])
+	}()
+}
+
+// collapseScans keeps only the newest scan for each (ip, port, service) and
+// orders the result by key so concurrent batches lock rows in the same order
+func collapseScans(scans []*domain.ServiceScan) []*domain.ServiceScan {
+	latest := make(map[domain.ServiceKey]*domain.ServiceScan, len(scans))
+	for _, scan := range scans {
+		existing, ok := latest[scan.Key()]
+		if !ok || scan.IsNewerThan(existing.LastScanned) {
+			latest[scan.Key()] = scan
+		}
+	}
+
+	collapsed := make([]*domain.ServiceScan, 0, len(latest))
+	for _, scan := range latest {
+		collapsed = append(collapsed, scan)
+	}
+	sort.Slice(collapsed, func(i, j int) bool { return collapsed[i].Key().Less(collapsed[j].Key()) })
+
+	return collapsed
+}
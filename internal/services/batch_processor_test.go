@@ -0,0 +1,216 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/logging"
+	"github.com/censys/scan-takehome/internal/mocks"
+)
+
+func processConcurrently(processor *BatchProcessor, scans ...*domain.ServiceScan) ([]domain.UpsertOutcome, []error) {
+	outcomes := make([]domain.UpsertOutcome, len(scans))
+	errs := make([]error, len(scans))
+
+	var wg sync.WaitGroup
+	for i, scan := range scans {
+		wg.Add(1)
+		go func(i int, scan *domain.ServiceScan) {
+			defer wg.Done()
+			outcomes[i], errs[i] = processor.ProcessScanResult(context.Background(), scan)
+		}(i, scan)
+	}
+	wg.Wait()
+
+	return outcomes, errs
+}
+
+func TestBatchProcessor_ProcessScanResult_FlushesFullBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockScanRepository(ctrl)
+	processor := NewBatchProcessor(mockRepo, BatchConfig{MaxSize: 2, MaxWait: time.Hour})
+	defer processor.Close()
+
+	now := time.Now()
+	first := &domain.ServiceScan{IP: "1.1.1.1", Port: 80, Service: "HTTP", LastScanned: now}
+	second := &domain.ServiceScan{IP: "1.1.1.2", Port: 22, Service: "SSH", LastScanned: now}
+
+	mockRepo.EXPECT().
+		UpsertScans(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, scans []*domain.ServiceScan) ([]domain.UpsertOutcome, error) {
+			assert.ElementsMatch(t, []*domain.ServiceScan{first, second}, scans)
+			return []domain.UpsertOutcome{domain.OutcomeInserted, domain.OutcomeInserted}, nil
+		})
+
+	outcomes, errs := processConcurrently(processor, first, second)
+
+	assert.Equal(t, []error{nil, nil}, errs)
+	assert.Equal(t, []domain.UpsertOutcome{domain.OutcomeInserted, domain.OutcomeInserted}, outcomes)
+}
+
+func TestBatchProcessor_ProcessScanResult_FlushesAfterMaxWait(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockScanRepository(ctrl)
+	processor := NewBatchProcessor(mockRepo, BatchConfig{MaxSize: 100, MaxWait: 10 * time.Millisecond})
+	defer processor.Close()
+
+	scan := &domain.ServiceScan{IP: "1.1.1.1", Port: 80, Service: "HTTP", LastScanned: time.Now()}
+
+	mockRepo.EXPECT().
+		UpsertScans(gomock.Any(), []*domain.ServiceScan{scan}).
+		Return([]domain.UpsertOutcome{domain.OutcomeUpdated}, nil)
+
+	outcome, err := processor.ProcessScanResult(context.Background(), scan)
+
+	assert.NoError(t, err)
+	assert.Equal(t, domain.OutcomeUpdated, outcome)
+}
+
+func TestBatchProcessor_ProcessScanResult_FullBatchDoesNotCutTheNextShort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	deadlines := make(chan chan time.Time, 2)
+	after := func(time.Duration) <-chan time.Time {
+		deadline := make(chan time.Time, 1)
+		deadlines <- deadline
+		return deadline
+	}
+	mockRepo := mocks.NewMockScanRepository(ctrl)
+	processor := newBatchProcessor(mockRepo, BatchConfig{MaxSize: 2, MaxWait: time.Minute}, after)
+	defer processor.Close()
+
+	now := time.Now()
+	first := &domain.ServiceScan{IP: "1.1.1.1", Port: 80, Service: "HTTP", LastScanned: now}
+	second := &domain.ServiceScan{IP: "1.1.1.2", Port: 80, Service: "HTTP", LastScanned: now}
+	next := &domain.ServiceScan{IP: "1.1.1.3", Port: 80, Service: "HTTP", LastScanned: now}
+
+	mockRepo.EXPECT().
+		UpsertScans(gomock.Any(), gomock.Len(2)).
+		Return([]domain.UpsertOutcome{domain.OutcomeInserted, domain.OutcomeInserted}, nil)
+	_, errs := processConcurrently(processor, first, second)
+	assert.Equal(t, []error{nil, nil}, errs)
+
+	// The full batch's deadline fires after it was flushed
+	(<-deadlines) <- now
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := processor.ProcessScanResult(context.Background(), next)
+		result <- err
+	}()
+	nextDeadline := <-deadlines
+	select {
+	case err := <-result:
+		t.Fatalf("next batch was flushed before its own deadline: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	mockRepo.EXPECT().
+		UpsertScans(gomock.Any(), []*domain.ServiceScan{next}).
+		Return([]domain.UpsertOutcome{domain.OutcomeInserted}, nil)
+	nextDeadline <- now
+	assert.NoError(t, <-result)
+}
+
+func TestBatchProcessor_ProcessScanResult_CollapsesDuplicatesKeepingNewest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockScanRepository(ctrl)
+	processor := NewBatchProcessor(mockRepo, BatchConfig{MaxSize: 3, MaxWait: time.Hour})
+	defer processor.Close()
+
+	now := time.Now()
+	older := &domain.ServiceScan{IP: "1.1.1.1", Port: 80, Service: "HTTP", Response: "old", LastScanned: now.Add(-time.Hour)}
+	newer := &domain.ServiceScan{IP: "1.1.1.1", Port: 80, Service: "HTTP", Response: "new", LastScanned: now}
+	other := &domain.ServiceScan{IP: "1.1.1.1", Port: 443, Service: "HTTP", Response: "tls", LastScanned: now}
+
+	mockRepo.EXPECT().
+		UpsertScans(gomock.Any(), []*domain.ServiceScan{newer, other}).
+		Return([]domain.UpsertOutcome{domain.OutcomeUpdated, domain.OutcomeInserted}, nil)
+
+	outcomes, errs := processConcurrently(processor, older, newer, other)
+
+	assert.Equal(t, []error{nil, nil, nil}, errs)
+	assert.Equal(t, []domain.UpsertOutcome{domain.OutcomeStale, domain.OutcomeUpdated, domain.OutcomeInserted}, outcomes)
+}
+
+func TestBatchProcessor_ProcessScanResult_LogsOutcomeOfEachScan(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockScanRepository(ctrl)
+	processor := NewBatchProcessor(mockRepo, BatchConfig{MaxSize: 100, MaxWait: time.Millisecond})
+	defer processor.Close()
+
+	var logs bytes.Buffer
+	ctx := logging.WithLogger(context.Background(), slog.New(slog.NewTextHandler(&logs, nil)).With("message_id", "m-1"))
+	scan := &domain.ServiceScan{IP: "1.1.1.1", Port: 80, Service: "HTTP", LastScanned: time.Now()}
+
+	mockRepo.EXPECT().
+		UpsertScans(gomock.Any(), []*domain.ServiceScan{scan}).
+		Return([]domain.UpsertOutcome{domain.OutcomeStale}, nil)
+
+	_, err := processor.ProcessScanResult(ctx, scan)
+
+	assert.NoError(t, err)
+	assert.Contains(t, logs.String(), `msg="Ignoring older scan" message_id=m-1`)
+}
+
+func TestBatchProcessor_ProcessScanResult_ReturnsBatchErrorToEveryScan(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockScanRepository(ctrl)
+	processor := NewBatchProcessor(mockRepo, BatchConfig{MaxSize: 2, MaxWait: time.Hour})
+	defer processor.Close()
+
+	now := time.Now()
+	first := &domain.ServiceScan{IP: "1.1.1.1", Port: 80, Service: "HTTP", LastScanned: now}
+	second := &domain.ServiceScan{IP: "1.1.1.2", Port: 80, Service: "HTTP", LastScanned: now}
+
+	mockRepo.EXPECT().
+		UpsertScans(gomock.Any(), gomock.Any()).
+		Return(nil, assert.AnError)
+
+	_, errs := processConcurrently(processor, first, second)
+
+	assert.Equal(t, []error{assert.AnError, assert.AnError}, errs)
+}
+
+func TestBatchProcessor_Close_FlushesPendingScans(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockScanRepository(ctrl)
+	processor := NewBatchProcessor(mockRepo, BatchConfig{MaxSize: 100, MaxWait: time.Hour})
+
+	scan := &domain.ServiceScan{IP: "1.1.1.1", Port: 80, Service: "HTTP", LastScanned: time.Now()}
+
+	mockRepo.EXPECT().
+		UpsertScans(gomock.Any(), []*domain.ServiceScan{scan}).
+		Return([]domain.UpsertOutcome{domain.OutcomeInserted}, nil)
+
+	// Hand the scan straight to the batching loop so it is pending when Close runs
+	req := &batchRequest{scan: scan, result: make(chan batchResult, 1)}
+	processor.requests <- req
+
+	assert.NoError(t, processor.Close())
+	assert.Equal(t, batchResult{outcome: domain.OutcomeInserted}, <-req.result)
+
+	_, err := processor.ProcessScanResult(context.Background(), scan)
+	assert.ErrorIs(t, err, ErrBatchProcessorClosed)
+}
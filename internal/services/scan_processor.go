@@ -2,14 +2,23 @@ package services
 
 import (
 	"context"
-	"log"
+
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/logging"
+	"github.com/censys/scan-takehome/internal/metrics"
+	"github.com/censys/scan-takehome/internal/tracing"
 )
 
+//go:generate mockgen -source=scan_processor.go -destination=../mocks/mock_scan_repository.go -package=mocks
+
 type ScanRepository interface {
-	GetLatestScan(ctx context.Context, ip string, port uint32, service string) (*domain.ServiceScan, error)
-	UpsertScan(ctx context.Context, scan *domain.ServiceScan) error
+	// UpsertScan writes the scan only if it is newer than the stored record
+	UpsertScan(ctx context.Context, scan *domain.ServiceScan) (domain.UpsertOutcome, error)
+	// UpsertScans writes scans with unique (ip, port, service) keys in a single
+	// statement and returns their outcomes in input order
+	UpsertScans(ctx context.Context, scans []*domain.ServiceScan) ([]domain.UpsertOutcome, error)
 }
 
 type ScanProcessor struct {
@@ -22,28 +31,42 @@ func NewScanProcessor(repository ScanRepository) *ScanProcessor {
 	}
 }
 
-func (sp *ScanProcessor) ProcessScanResult(ctx context.Context, scan *domain.ServiceScan) error {
-	latestScan, err := sp.repository.GetLatestScan(ctx, scan.IP, scan.Port, scan.Service)
+// ProcessScanResult relies on the conditional upsert to decide whether the
+// scan wins, so concurrent consumers never race between a read and a write
+func (sp *ScanProcessor) ProcessScanResult(ctx context.Context, scan *domain.ServiceScan) (domain.UpsertOutcome, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "ScanProcessor.ProcessScanResult")
+
+	outcome, err := sp.repository.UpsertScan(ctx, scan)
 	if err != nil {
-		log.Printf("Failed to get latest scan for %s:%d/%s: %v",
-			scan.IP, scan.Port, scan.Service, err)
-		return err
+		logging.FromContext(ctx).Error("Failed to upsert scan", "error", err)
+		tracing.End(span, err)
+		return 0, err
 	}
 
-	if latestScan != nil && !scan.IsNewerThan(latestScan.LastScanned) {
-		log.Printf("Ignoring older scan for %s:%d/%s (latest: %v, received: %v)",
-			scan.IP, scan.Port, scan.Service,
-			latestScan.LastScanned, scan.LastScanned)
-		return nil
-	}
+	span.SetAttributes(outcomeAttribute(outcome))
+	logOutcome(ctx, scan, outcome)
+	recordOutcome(outcome)
+	span.End()
+	return outcome, nil
+}
 
-	if err := sp.repository.UpsertScan(ctx, scan); err != nil {
-		log.Printf("Failed to upsert scan for %s:%d/%s: %v",
-			scan.IP, scan.Port, scan.Service, err)
-		return err
-	}
+func outcomeAttribute(outcome domain.UpsertOutcome) attribute.KeyValue {
+	return attribute.String("scan.upsert_outcome", outcome.String())
+}
 
-	log.Printf("Updated scan for %s:%d/%s with timestamp %v",
-		scan.IP, scan.Port, scan.Service, scan.LastScanned)
-	return nil
+func recordOutcome(outcome domain.UpsertOutcome) {
+	metrics.UpsertOutcomes.WithLabelValues(outcome.String()).Inc()
+}
+
+// logOutcome relies on the logger in ctx to identify the scan
+func logOutcome(ctx context.Context, scan *domain.ServiceScan, outcome domain.UpsertOutcome) {
+	logger := logging.FromContext(ctx)
+	switch outcome {
+	case domain.OutcomeStale:
+		logger.Info("Ignoring older scan", "last_scanned", scan.LastScanned)
+	case domain.OutcomeIdentical:
+		logger.Info("Refreshed unchanged scan", "last_scanned", scan.LastScanned)
+	default:
+		logger.Info("Updated scan", "last_scanned", scan.LastScanned, "outcome", outcome.String())
+	}
 }
@@ -27,17 +27,14 @@ func TestScanProcessor_ProcessScanResult_NewScan(t *testing.T) {
 		LastScanned: time.Now(),
 	}
 
-	mockRepo.EXPECT().
-		GetLatestScan(gomock.Any(), "192.168.1.1", uint32(8080), "HTTP").
-		Return(nil, nil)
-
 	mockRepo.EXPECT().
 		UpsertScan(gomock.Any(), scan).
-		Return(nil)
+		Return(domain.OutcomeInserted, nil)
 
-	err := processor.ProcessScanResult(context.Background(), scan)
+	outcome, err := processor.ProcessScanResult(context.Background(), scan)
 
 	assert.NoError(t, err)
+	assert.Equal(t, domain.OutcomeInserted, outcome)
 }
 
 func TestScanProcessor_ProcessScanResult_NewerScan(t *testing.T) {
@@ -47,36 +44,22 @@ func TestScanProcessor_ProcessScanResult_NewerScan(t *testing.T) {
 	mockRepo := mocks.NewMockScanRepository(ctrl)
 	processor := NewScanProcessor(mockRepo)
 
-	now := time.Now()
-	olderTime := now.Add(-time.Hour)
-
 	scan := &domain.ServiceScan{
 		IP:          "192.168.1.1",
 		Port:        8080,
 		Service:     "HTTP",
 		Response:    "New Response",
-		LastScanned: now,
-	}
-
-	existingScan := &domain.ServiceScan{
-		IP:          "192.168.1.1",
-		Port:        8080,
-		Service:     "HTTP",
-		Response:    "Old Response",
-		LastScanned: olderTime,
+		LastScanned: time.Now(),
 	}
 
-	mockRepo.EXPECT().
-		GetLatestScan(gomock.Any(), "192.168.1.1", uint32(8080), "HTTP").
-		Return(existingScan, nil)
-
 	mockRepo.EXPECT().
 		UpsertScan(gomock.Any(), scan).
-		Return(nil)
+		Return(domain.OutcomeUpdated, nil)
 
-	err := processor.ProcessScanResult(context.Background(), scan)
+	outcome, err := processor.ProcessScanResult(context.Background(), scan)
 
 	assert.NoError(t, err)
+	assert.Equal(t, domain.OutcomeUpdated, outcome)
 }
 
 func TestScanProcessor_ProcessScanResult_OlderScan(t *testing.T) {
@@ -86,30 +69,44 @@ func TestScanProcessor_ProcessScanResult_OlderScan(t *testing.T) {
 	mockRepo := mocks.NewMockScanRepository(ctrl)
 	processor := NewScanProcessor(mockRepo)
 
-	now := time.Now()
-	newerTime := now.Add(time.Hour)
-
 	scan := &domain.ServiceScan{
 		IP:          "192.168.1.1",
 		Port:        8080,
 		Service:     "HTTP",
 		Response:    "Old Response",
-		LastScanned: now,
+		LastScanned: time.Now().Add(-24 * time.Hour),
 	}
 
-	existingScan := &domain.ServiceScan{
+	mockRepo.EXPECT().
+		UpsertScan(gomock.Any(), scan).
+		Return(domain.OutcomeStale, nil)
+
+	outcome, err := processor.ProcessScanResult(context.Background(), scan)
+
+	assert.NoError(t, err)
+	assert.Equal(t, domain.OutcomeStale, outcome)
+}
+
+func TestScanProcessor_ProcessScanResult_RepositoryError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockScanRepository(ctrl)
+	processor := NewScanProcessor(mockRepo)
+
+	scan := &domain.ServiceScan{
 		IP:          "192.168.1.1",
 		Port:        8080,
 		Service:     "HTTP",
-		Response:    "Newer Response",
-		LastScanned: newerTime,
+		Response:    "Hello World",
+		LastScanned: time.Now(),
 	}
 
 	mockRepo.EXPECT().
-		GetLatestScan(gomock.Any(), "192.168.1.1", uint32(8080), "HTTP").
-		Return(existingScan, nil)
+		UpsertScan(gomock.Any(), scan).
+		Return(domain.UpsertOutcome(0), assert.AnError)
 
-	err := processor.ProcessScanResult(context.Background(), scan)
+	_, err := processor.ProcessScanResult(context.Background(), scan)
 
-	assert.NoError(t, err)
+	assert.ErrorIs(t, err, assert.AnError)
 }
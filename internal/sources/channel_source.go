@@ -0,0 +1,99 @@
+package sources
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ChannelSource delivers messages published in-process. Nacked messages are
+// redelivered, mirroring the behavior of a real queue.
+type ChannelSource struct {
+	messages chan *channelMessage
+	done     chan struct{}
+
+	mu     sync.Mutex
+	nextID int
+	closed bool
+}
+
+func NewChannelSource(bufferSize int) *ChannelSource {
+	return &ChannelSource{
+		messages: make(chan *channelMessage, bufferSize),
+		done:     make(chan struct{}),
+	}
+}
+
+// Publish enqueues data for delivery and returns the assigned message ID
+func (s *ChannelSource) Publish(data []byte) string {
+	s.mu.Lock()
+	s.nextID++
+	id := strconv.Itoa(s.nextID)
+	s.mu.Unlock()
+
+	s.enqueue(&channelMessage{source: s, id: id, data: data, published: time.Now()})
+	return id
+}
+
+func (s *ChannelSource) Receive(ctx context.Context, handler HandlerFunc) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.done:
+			return nil
+		case msg := <-s.messages:
+			msg.attempts++
+			handler(ctx, msg)
+		}
+	}
+}
+
+// DeliversSerially reports that the handler is called for one message at a time
+func (s *ChannelSource) DeliversSerially() bool {
+	return true
+}
+
+func (s *ChannelSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	return nil
+}
+
+func (s *ChannelSource) String() string {
+	return "channel"
+}
+
+func (s *ChannelSource) enqueue(msg *channelMessage) {
+	select {
+	case s.messages <- msg:
+	case <-s.done:
+	}
+}
+
+type channelMessage struct {
+	source    *ChannelSource
+	id        string
+	data      []byte
+	attempts  int
+	published time.Time
+}
+
+func (m *channelMessage) ID() string                    { return m.id }
+func (m *channelMessage) Data() []byte                  { return m.data }
+func (m *channelMessage) PublishTime() time.Time        { return m.published }
+func (m *channelMessage) Attributes() map[string]string { return nil }
+func (m *channelMessage) DeliveryAttempt() int          { return m.attempts }
+func (m *channelMessage) Ack()                          {}
+
+func (m *channelMessage) Nack() {
+	// Requeue asynchronously so a handler running inside Receive never blocks
+	// on a full buffer.
+	go m.source.enqueue(m)
+}
@@ -0,0 +1,71 @@
+package sources
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelSource_Receive_DeliversPublishedMessages(t *testing.T) {
+	source := NewChannelSource(10)
+	defer source.Close()
+
+	id := source.Publish([]byte("hello"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var received []string
+	err := source.Receive(ctx, func(ctx context.Context, msg Message) {
+		received = append(received, msg.ID()+"="+string(msg.Data()))
+		msg.Ack()
+		cancel()
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{id + "=hello"}, received)
+}
+
+func TestChannelSource_Receive_RedeliversNackedMessages(t *testing.T) {
+	source := NewChannelSource(10)
+	defer source.Close()
+
+	source.Publish([]byte("retry me"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	deliveries := 0
+	err := source.Receive(ctx, func(ctx context.Context, msg Message) {
+		deliveries++
+		if deliveries == 1 {
+			msg.Nack()
+			return
+		}
+		msg.Ack()
+		cancel()
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deliveries)
+}
+
+func TestChannelSource_Receive_ReturnsOnClose(t *testing.T) {
+	source := NewChannelSource(1)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- source.Receive(context.Background(), func(ctx context.Context, msg Message) {})
+	}()
+
+	assert.NoError(t, source.Close())
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Receive did not return after Close")
+	}
+}
@@ -0,0 +1,105 @@
+package sources
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const maxFileLineBytes = 10 * 1024 * 1024
+
+// FileSource delivers each non-empty line of a JSONL file as a message. The
+// file is read once, so nacked lines are reported rather than redelivered.
+type FileSource struct {
+	path   string
+	file   *os.File
+	nacked atomic.Int64
+}
+
+func NewFileSource(path string) (*FileSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open message file: %w", err)
+	}
+
+	return &FileSource{
+		path: path,
+		file: file,
+	}, nil
+}
+
+func (s *FileSource) Receive(ctx context.Context, handler HandlerFunc) error {
+	scanner := bufio.NewScanner(s.file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxFileLineBytes)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		lineNumber++
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		data := make([]byte, len(line))
+		copy(data, line)
+
+		handler(ctx, &fileMessage{
+			source: s,
+			id:     fmt.Sprintf("%s:%d", s.path, lineNumber),
+			data:   data,
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read message file: %w", err)
+	}
+
+	if nacked := s.nacked.Load(); nacked > 0 {
+		slog.Warn("Finished reading message file with nacked messages", "path", s.path, "nacked", nacked)
+	}
+	return nil
+}
+
+// DeliversSerially reports that the handler is called for one line at a time
+func (s *FileSource) DeliversSerially() bool {
+	return true
+}
+
+// Nacked returns the number of lines that were nacked by the handler
+func (s *FileSource) Nacked() int64 {
+	return s.nacked.Load()
+}
+
+func (s *FileSource) Close() error {
+	return s.file.Close()
+}
+
+func (s *FileSource) String() string {
+	return "file:" + s.path
+}
+
+type fileMessage struct {
+	source *FileSource
+	id     string
+	data   []byte
+}
+
+func (m *fileMessage) ID() string                    { return m.id }
+func (m *fileMessage) Data() []byte                  { return m.data }
+func (m *fileMessage) DeliveryAttempt() int          { return 1 }
+func (m *fileMessage) PublishTime() time.Time        { return time.Time{} }
+func (m *fileMessage) Attributes() map[string]string { return nil }
+func (m *fileMessage) Ack()                          {}
+
+func (m *fileMessage) Nack() {
+	slog.Warn("Message was nacked and will not be redelivered", "message_id", m.id)
+	m.source.nacked.Add(1)
+}
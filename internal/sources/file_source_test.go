@@ -0,0 +1,58 @@
+package sources
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSource_Receive_DeliversEachLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scans.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{\"a\":1}\n\n{\"b\":2}\n"), 0o600))
+
+	source, err := NewFileSource(path)
+	require.NoError(t, err)
+	defer source.Close()
+
+	var ids, payloads []string
+	err = source.Receive(context.Background(), func(ctx context.Context, msg Message) {
+		ids = append(ids, msg.ID())
+		payloads = append(payloads, string(msg.Data()))
+		msg.Ack()
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{path + ":1", path + ":3"}, ids)
+	assert.Equal(t, []string{`{"a":1}`, `{"b":2}`}, payloads)
+	assert.Equal(t, int64(0), source.Nacked())
+}
+
+func TestFileSource_Receive_CountsNackedLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scans.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("good\nbad\n"), 0o600))
+
+	source, err := NewFileSource(path)
+	require.NoError(t, err)
+	defer source.Close()
+
+	err = source.Receive(context.Background(), func(ctx context.Context, msg Message) {
+		if string(msg.Data()) == "bad" {
+			msg.Nack()
+			return
+		}
+		msg.Ack()
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), source.Nacked())
+}
+
+func TestNewFileSource_MissingFile(t *testing.T) {
+	_, err := NewFileSource(filepath.Join(t.TempDir(), "missing.jsonl"))
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,147 @@
+package sources
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// DefaultMaxOutstandingMessages is the limit Pub/Sub applies when
+// ReceiveSettings.MaxOutstandingMessages is zero
+var DefaultMaxOutstandingMessages = pubsub.DefaultReceiveSettings.MaxOutstandingMessages
+
+// ReceiveSettings tunes Pub/Sub flow control. Zero values use the client
+// library defaults.
+type ReceiveSettings struct {
+	MaxOutstandingMessages int
+	MaxOutstandingBytes    int
+	NumGoroutines          int
+	// MaxExtension caps how long the ack deadline of a message is extended
+	MaxExtension time.Duration
+	// Synchronous uses unary Pull instead of StreamingPull
+	Synchronous bool
+}
+
+type PubSubSource struct {
+	client       *pubsub.Client
+	subscription *pubsub.Subscription
+	// ownsClient is false when the client was handed in and is closed by its owner
+	ownsClient bool
+
+	mu       sync.Mutex
+	settings ReceiveSettings
+	// restart is closed to make Receive reopen its pull with new settings
+	restart chan struct{}
+}
+
+func NewPubSubSource(ctx context.Context, projectID, subscriptionID string) (*PubSubSource, error) {
+	client, err := pubsub.NewClient(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	source := NewPubSubSourceFromClient(client, subscriptionID)
+	source.ownsClient = true
+	return source, nil
+}
+
+// NewPubSubSourceFromClient receives from a subscription through an existing
+// client, such as one connected to pstest. Close leaves the client open.
+func NewPubSubSourceFromClient(client *pubsub.Client, subscriptionID string) *PubSubSource {
+	return &PubSubSource{
+		client:       client,
+		subscription: client.Subscription(subscriptionID),
+	}
+}
+
+// SetReceiveSettings applies settings to the next pull. If Receive is running
+// it reopens the pull, which first waits for in-flight handlers to return.
+func (s *PubSubSource) SetReceiveSettings(settings ReceiveSettings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if settings == s.settings {
+		return
+	}
+	s.settings = settings
+	if s.restart != nil {
+		close(s.restart)
+		s.restart = nil
+	}
+}
+
+func (s *PubSubSource) Receive(ctx context.Context, handler HandlerFunc) error {
+	for {
+		pullCtx, stopPull := context.WithCancel(ctx)
+		restart := s.prepareReceive()
+		go func() {
+			select {
+			case <-restart:
+				stopPull()
+			case <-pullCtx.Done():
+			}
+		}()
+
+		err := s.subscription.Receive(pullCtx, func(ctx context.Context, msg *pubsub.Message) {
+			handler(ctx, &pubSubMessage{msg: msg})
+		})
+		stopPull()
+
+		if err != nil || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+// prepareReceive copies the current settings onto the subscription and
+// returns the channel that signals a change to them
+func (s *PubSubSource) prepareReceive() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings := pubsub.DefaultReceiveSettings
+	settings.MaxOutstandingMessages = s.settings.MaxOutstandingMessages
+	settings.MaxOutstandingBytes = s.settings.MaxOutstandingBytes
+	settings.NumGoroutines = s.settings.NumGoroutines
+	if s.settings.MaxExtension != 0 {
+		settings.MaxExtension = s.settings.MaxExtension
+	}
+	settings.Synchronous = s.settings.Synchronous //nolint:staticcheck // kept for emulators and debugging
+	s.subscription.ReceiveSettings = settings
+
+	s.restart = make(chan struct{})
+	return s.restart
+}
+
+func (s *PubSubSource) Close() error {
+	if !s.ownsClient {
+		return nil
+	}
+	return s.client.Close()
+}
+
+func (s *PubSubSource) String() string {
+	return "pubsub:" + s.subscription.String()
+}
+
+type pubSubMessage struct {
+	msg *pubsub.Message
+}
+
+func (m *pubSubMessage) ID() string                    { return m.msg.ID }
+func (m *pubSubMessage) Data() []byte                  { return m.msg.Data }
+func (m *pubSubMessage) PublishTime() time.Time        { return m.msg.PublishTime }
+func (m *pubSubMessage) Attributes() map[string]string { return m.msg.Attributes }
+func (m *pubSubMessage) Ack()                          { m.msg.Ack() }
+func (m *pubSubMessage) Nack()                         { m.msg.Nack() }
+
+// DeliveryAttempt is only populated by Pub/Sub when the subscription has a
+// dead-letter policy
+func (m *pubSubMessage) DeliveryAttempt() int {
+	if m.msg.DeliveryAttempt == nil {
+		return 0
+	}
+	return *m.msg.DeliveryAttempt
+}
@@ -0,0 +1,76 @@
+package sources
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPubSubSource_Receive_RestartsWithNewSettings(t *testing.T) {
+	server := pstest.NewServer()
+	defer server.Close()
+	t.Setenv("PUBSUB_EMULATOR_HOST", server.Addr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	source, err := NewPubSubSource(ctx, "test", "scans-sub")
+	require.NoError(t, err)
+	defer source.Close()
+
+	topic, err := source.client.CreateTopic(ctx, "scans")
+	require.NoError(t, err)
+	_, err = source.client.CreateSubscription(ctx, "scans-sub", pubsub.SubscriptionConfig{Topic: topic})
+	require.NoError(t, err)
+
+	_, err = topic.Publish(ctx, &pubsub.Message{Data: []byte("scan")}).Get(ctx)
+	require.NoError(t, err)
+	topic.Stop()
+
+	reopened := func() bool {
+		source.mu.Lock()
+		defer source.mu.Unlock()
+		return source.restart != nil
+	}
+
+	var received []string
+	err = source.Receive(ctx, func(ctx context.Context, msg Message) {
+		msg.Ack()
+		received = append(received, string(msg.Data()))
+
+		source.SetReceiveSettings(ReceiveSettings{MaxOutstandingMessages: 1, NumGoroutines: 1})
+		go func() {
+			// Stop once the pull has been reopened with the new settings
+			assert.Eventually(t, reopened, 5*time.Second, 10*time.Millisecond)
+			cancel()
+		}()
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"scan"}, received)
+	assert.Equal(t, 1, source.subscription.ReceiveSettings.MaxOutstandingMessages)
+	assert.Equal(t, 1, source.subscription.ReceiveSettings.NumGoroutines)
+}
+
+func TestPubSubSource_CloseLeavesInjectedClientOpen(t *testing.T) {
+	server := pstest.NewServer()
+	defer server.Close()
+	t.Setenv("PUBSUB_EMULATOR_HOST", server.Addr)
+
+	ctx := context.Background()
+	client, err := pubsub.NewClient(ctx, "test")
+	require.NoError(t, err)
+	defer client.Close()
+
+	source := NewPubSubSourceFromClient(client, "scans-sub")
+	require.NoError(t, source.Close())
+
+	// The client still works after the source is closed
+	_, err = client.CreateTopic(ctx, "scans")
+	assert.NoError(t, err)
+}
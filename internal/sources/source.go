@@ -0,0 +1,26 @@
+package sources
+
+import (
+	"context"
+	"time"
+)
+
+// Message is a single delivery from a message source
+type Message interface {
+	ID() string
+	Data() []byte
+	// DeliveryAttempt is the 1-based delivery count, or 0 when the source
+	// does not track redeliveries
+	DeliveryAttempt() int
+	// PublishTime is when the message was published, or the zero time when
+	// the source does not know
+	PublishTime() time.Time
+	// Attributes are the metadata published with the message, such as trace
+	// context; nil when the source has none
+	Attributes() map[string]string
+	Ack()
+	Nack()
+}
+
+// HandlerFunc processes a single message and is responsible for acking or nacking it
+type HandlerFunc func(ctx context.Context, msg Message)
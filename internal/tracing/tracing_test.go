@@ -0,0 +1,51 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSetup_FileExporterWritesSpans(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := Setup(context.Background(), "test", Config{Exporter: "file", File: path, SampleRatio: 1})
+	require.NoError(t, err)
+
+	_, span := Tracer().Start(context.Background(), "test-span")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	written, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(written), `"Name":"test-span"`)
+}
+
+func TestSetup_RejectsUnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), "test", Config{Exporter: "jaeger"})
+	assert.Error(t, err)
+}
+
+func TestInjectExtract_RoundTripsTraceContext(t *testing.T) {
+	_, err := Setup(context.Background(), "test", Config{Exporter: "none"})
+	require.NoError(t, err)
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3},
+		SpanID:     trace.SpanID{4, 5, 6},
+		TraceFlags: trace.FlagsSampled,
+	})
+	attributes := make(map[string]string)
+	Inject(trace.ContextWithSpanContext(context.Background(), spanContext), attributes)
+
+	require.Contains(t, attributes, "traceparent")
+
+	extracted := trace.SpanContextFromContext(Extract(context.Background(), attributes))
+	assert.Equal(t, spanContext.TraceID(), extracted.TraceID())
+	assert.Equal(t, spanContext.SpanID(), extracted.SpanID())
+	assert.True(t, extracted.IsRemote())
+}
@@ -0,0 +1,207 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/metrics"
+	"github.com/censys/scan-takehome/internal/services"
+	"github.com/censys/scan-takehome/internal/sources"
+)
+
+// FlowControlledSource is a MessageSource whose receive settings can be
+// changed
+type FlowControlledSource interface {
+	SetReceiveSettings(settings sources.ReceiveSettings)
+}
+
+// AdaptiveConfig enables backpressure: while the average database write
+// latency is above TargetLatency the number of messages handled at once is
+// halved, and once it recovers the limit grows back towards the configured
+// MaxOutstandingMessages.
+type AdaptiveConfig struct {
+	Enabled        bool
+	TargetLatency  time.Duration
+	MinOutstanding int
+	// Interval is how often latency is sampled and the limit adjusted
+	Interval time.Duration
+}
+
+const defaultAdaptiveInterval = 5 * time.Second
+
+// adaptiveFlowControl limits the messages handled at once from the latency
+// of the writes made through its repository. The limit is enforced in the
+// worker rather than through the source's MaxOutstandingMessages, which stays
+// at its ceiling: changing that reopens the Pub/Sub pull and waits for every
+// in-flight handler, which would stall the worker on every adjustment.
+type adaptiveFlowControl struct {
+	settings sources.ReceiveSettings
+	config   AdaptiveConfig
+
+	mu      sync.Mutex
+	total   time.Duration
+	samples int
+	limit   int
+	active  int
+	// changed is closed and replaced when a slot frees up or the limit
+	// changes, waking waiting handlers
+	changed chan struct{}
+}
+
+func newAdaptiveFlowControl(settings sources.ReceiveSettings, config AdaptiveConfig) *adaptiveFlowControl {
+	limit := settings.MaxOutstandingMessages
+	if limit <= 0 {
+		limit = sources.DefaultMaxOutstandingMessages
+	}
+	if config.MinOutstanding < 1 {
+		config.MinOutstanding = 1
+	}
+	if config.MinOutstanding > limit {
+		config.MinOutstanding = limit
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultAdaptiveInterval
+	}
+	settings.MaxOutstandingMessages = limit
+
+	return &adaptiveFlowControl{
+		settings: settings,
+		config:   config,
+		limit:    limit,
+		changed:  make(chan struct{}),
+	}
+}
+
+// observe records the latency of one database write
+func (a *adaptiveFlowControl) observe(latency time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.total += latency
+	a.samples++
+}
+
+// acquire blocks until fewer than limit messages are being handled, returning
+// early when ctx is done. Every successful acquire must be released.
+func (a *adaptiveFlowControl) acquire(ctx context.Context) error {
+	for {
+		a.mu.Lock()
+		if a.active < a.limit {
+			a.active++
+			a.mu.Unlock()
+			return nil
+		}
+		changed := a.changed
+		a.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (a *adaptiveFlowControl) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.active--
+	a.broadcast()
+}
+
+func (a *adaptiveFlowControl) broadcast() {
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+// run adjusts the limit every Interval until ctx is canceled
+func (a *adaptiveFlowControl) run(ctx context.Context) {
+	metrics.MaxOutstandingMessages.Set(float64(a.currentLimit()))
+
+	ticker := time.NewTicker(a.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.adjust()
+		}
+	}
+}
+
+func (a *adaptiveFlowControl) adjust() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	total, samples := a.total, a.samples
+	a.total, a.samples = 0, 0
+	if samples == 0 {
+		return
+	}
+	average := total / time.Duration(samples)
+
+	current := a.limit
+	next := nextLimit(current, average, a.config.TargetLatency, a.config.MinOutstanding, a.settings.MaxOutstandingMessages)
+	if next == current {
+		return
+	}
+
+	slog.Info("Adjusting outstanding message limit",
+		"average_latency", average.String(), "target_latency", a.config.TargetLatency.String(), "from", current, "to", next)
+	a.limit = next
+	a.broadcast()
+	metrics.MaxOutstandingMessages.Set(float64(next))
+}
+
+func (a *adaptiveFlowControl) currentLimit() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.limit
+}
+
+// nextLimit halves the limit when latency is over target and otherwise adds a
+// tenth of upper, staying within [lower, upper]
+func nextLimit(current int, latency, target time.Duration, lower, upper int) int {
+	var next int
+	if latency > target {
+		next = current / 2
+	} else {
+		step := upper / 10
+		if step < 1 {
+			step = 1
+		}
+		next = current + step
+	}
+
+	if next < lower {
+		return lower
+	}
+	if next > upper {
+		return upper
+	}
+	return next
+}
+
+// timedRepository reports the latency of every write to observe
+type timedRepository struct {
+	services.ScanRepository
+	observe func(time.Duration)
+}
+
+func (r *timedRepository) UpsertScan(ctx context.Context, scan *domain.ServiceScan) (domain.UpsertOutcome, error) {
+	start := time.Now()
+	outcome, err := r.ScanRepository.UpsertScan(ctx, scan)
+	r.observe(time.Since(start))
+	return outcome, err
+}
+
+func (r *timedRepository) UpsertScans(ctx context.Context, scans []*domain.ServiceScan) ([]domain.UpsertOutcome, error) {
+	start := time.Now()
+	outcomes, err := r.ScanRepository.UpsertScans(ctx, scans)
+	r.observe(time.Since(start))
+	return outcomes, err
+}
@@ -0,0 +1,111 @@
+package workers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/censys/scan-takehome/internal/sources"
+)
+
+type settingsRecorder struct {
+	*sources.ChannelSource
+	applied []sources.ReceiveSettings
+}
+
+func (s *settingsRecorder) SetReceiveSettings(settings sources.ReceiveSettings) {
+	s.applied = append(s.applied, settings)
+}
+
+func TestNextLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		current int
+		latency time.Duration
+		want    int
+	}{
+		{name: "halves over target", current: 800, latency: 300 * time.Millisecond, want: 400},
+		{name: "stops at minimum", current: 15, latency: time.Second, want: 10},
+		{name: "grows under target", current: 400, latency: 50 * time.Millisecond, want: 500},
+		{name: "stops at maximum", current: 950, latency: 50 * time.Millisecond, want: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, nextLimit(tt.current, tt.latency, 100*time.Millisecond, 10, 1000))
+		})
+	}
+}
+
+func TestAdaptiveFlowControl_Adjust(t *testing.T) {
+	adaptive := newAdaptiveFlowControl(sources.ReceiveSettings{MaxOutstandingMessages: 100, NumGoroutines: 2},
+		AdaptiveConfig{Enabled: true, TargetLatency: 100 * time.Millisecond, MinOutstanding: 10})
+
+	adaptive.adjust()
+	assert.Equal(t, 100, adaptive.currentLimit(), "no samples leaves the limit alone")
+
+	adaptive.observe(200 * time.Millisecond)
+	adaptive.observe(400 * time.Millisecond)
+	adaptive.adjust()
+	assert.Equal(t, 50, adaptive.currentLimit())
+
+	adaptive.observe(10 * time.Millisecond)
+	adaptive.adjust()
+	assert.Equal(t, 60, adaptive.currentLimit())
+	assert.Equal(t, 100, adaptive.settings.MaxOutstandingMessages, "the source keeps the ceiling")
+}
+
+func TestAdaptiveFlowControl_LimitChangeDoesNotRestartPull(t *testing.T) {
+	source := &settingsRecorder{ChannelSource: sources.NewChannelSource(1)}
+	settings := sources.ReceiveSettings{MaxOutstandingMessages: 2}
+	worker, err := NewScanWorker(Config{
+		Source:   source,
+		Receive:  settings,
+		Adaptive: AdaptiveConfig{Enabled: true, TargetLatency: 100 * time.Millisecond},
+	})
+	require.NoError(t, err)
+	adaptive := worker.adaptive
+
+	require.NoError(t, adaptive.acquire(context.Background()))
+	adaptive.observe(time.Second)
+	adaptive.adjust()
+
+	assert.Equal(t, []sources.ReceiveSettings{settings}, source.applied, "only the ceiling is ever applied to the source")
+
+	// The halved limit of 1 is taken, so the next handler waits for a release
+	acquired := make(chan error, 1)
+	go func() { acquired <- adaptive.acquire(context.Background()) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquired a slot above the limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+	adaptive.release()
+	require.NoError(t, <-acquired)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, adaptive.acquire(ctx), context.DeadlineExceeded)
+}
+
+func TestNewScanWorker_AppliesReceiveSettings(t *testing.T) {
+	source := &settingsRecorder{ChannelSource: sources.NewChannelSource(1)}
+	settings := sources.ReceiveSettings{MaxOutstandingMessages: 20, MaxExtension: time.Minute}
+
+	_, err := NewScanWorker(Config{Source: source, Receive: settings})
+
+	require.NoError(t, err)
+	assert.Equal(t, []sources.ReceiveSettings{settings}, source.applied)
+}
+
+func TestNewScanWorker_AdaptiveNeedsFlowControlledSource(t *testing.T) {
+	_, err := NewScanWorker(Config{
+		Source:   sources.NewChannelSource(1),
+		Adaptive: AdaptiveConfig{Enabled: true, TargetLatency: time.Second},
+	})
+
+	assert.Error(t, err)
+}
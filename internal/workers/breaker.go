@@ -0,0 +1,144 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/metrics"
+	"github.com/censys/scan-takehome/internal/services"
+)
+
+// BreakerConfig pauses message handling after FailureThreshold consecutive
+// writes fail with domain.ErrStoreUnavailable. While the breaker is open,
+// handlers wait instead of nacking, so the source stops pulling once its
+// outstanding limit is reached. Every Cooldown one message is let through to
+// probe the database; its success closes the breaker.
+type BreakerConfig struct {
+	// FailureThreshold of 0 disables the breaker
+	FailureThreshold int
+	Cooldown         time.Duration
+}
+
+const defaultBreakerCooldown = 5 * time.Second
+
+type circuitBreaker struct {
+	config BreakerConfig
+	now    func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+	// probeAt is when the next message may go through while open
+	probeAt time.Time
+	// changed is closed and replaced when the breaker closes, waking waiting
+	// handlers
+	changed chan struct{}
+}
+
+func newCircuitBreaker(config BreakerConfig) *circuitBreaker {
+	if config.Cooldown <= 0 {
+		config.Cooldown = defaultBreakerCooldown
+	}
+	return &circuitBreaker{
+		config:  config,
+		now:     time.Now,
+		changed: make(chan struct{}),
+	}
+}
+
+// wait blocks while the breaker is open, returning early when ctx is done
+func (b *circuitBreaker) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		if !b.open {
+			b.mu.Unlock()
+			return nil
+		}
+		now := b.now()
+		if !now.Before(b.probeAt) {
+			// This caller is the probe; the next one waits another cooldown
+			b.probeAt = now.Add(b.config.Cooldown)
+			b.mu.Unlock()
+			return nil
+		}
+		changed := b.changed
+		timer := time.NewTimer(b.probeAt.Sub(now))
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-changed:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// record counts the result of one database write
+func (b *circuitBreaker) record(err error) {
+	unavailable := errors.Is(err, domain.ErrStoreUnavailable)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !unavailable {
+		if err == nil {
+			b.failures = 0
+			if b.open {
+				b.open = false
+				b.broadcast()
+				metrics.CircuitBreakerOpen.Set(0)
+				slog.Info("Database available again, resuming message handling")
+			}
+		}
+		return
+	}
+
+	b.failures++
+	if b.open {
+		return
+	}
+	if b.failures >= b.config.FailureThreshold {
+		b.open = true
+		b.probeAt = b.now().Add(b.config.Cooldown)
+		metrics.CircuitBreakerOpen.Set(1)
+		slog.Warn("Database unavailable, pausing message handling",
+			"consecutive_failures", b.failures, "cooldown", b.config.Cooldown.String(), "error", err)
+	}
+}
+
+func (b *circuitBreaker) broadcast() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// isOpen reports whether message handling is paused
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+// breakerRepository reports the result of every write to record
+type breakerRepository struct {
+	services.ScanRepository
+	record func(error)
+}
+
+func (r *breakerRepository) UpsertScan(ctx context.Context, scan *domain.ServiceScan) (domain.UpsertOutcome, error) {
+	outcome, err := r.ScanRepository.UpsertScan(ctx, scan)
+	r.record(err)
+	return outcome, err
+}
+
+func (r *breakerRepository) UpsertScans(ctx context.Context, scans []*domain.ServiceScan) ([]domain.UpsertOutcome, error) {
+	outcomes, err := r.ScanRepository.UpsertScans(ctx, scans)
+	r.record(err)
+	return outcomes, err
+}
@@ -0,0 +1,119 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/censys/scan-takehome/internal/cache"
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/mocks"
+)
+
+var errUnavailable = fmt.Errorf("%w: connection refused", domain.ErrStoreUnavailable)
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	breaker := newCircuitBreaker(BreakerConfig{FailureThreshold: 3, Cooldown: time.Hour})
+
+	breaker.record(errUnavailable)
+	breaker.record(errors.New("constraint violation"))
+	breaker.record(errUnavailable)
+	assert.False(t, breaker.isOpen())
+
+	breaker.record(errUnavailable)
+	assert.True(t, breaker.isOpen())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, breaker.wait(ctx), context.DeadlineExceeded)
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	breaker := newCircuitBreaker(BreakerConfig{FailureThreshold: 2, Cooldown: time.Hour})
+
+	breaker.record(errUnavailable)
+	breaker.record(nil)
+	breaker.record(errUnavailable)
+	assert.False(t, breaker.isOpen())
+}
+
+func TestCircuitBreakerProbesAfterCooldown(t *testing.T) {
+	now := time.Now()
+	breaker := newCircuitBreaker(BreakerConfig{FailureThreshold: 1, Cooldown: time.Minute})
+	breaker.now = func() time.Time { return now }
+
+	breaker.record(errUnavailable)
+	require.True(t, breaker.isOpen())
+
+	// One caller may probe once the cooldown has passed; the next waits again
+	now = now.Add(time.Minute)
+	require.NoError(t, breaker.wait(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Error(t, breaker.wait(ctx))
+
+	// A failed probe keeps it open
+	breaker.record(errUnavailable)
+	assert.True(t, breaker.isOpen())
+}
+
+func TestCircuitBreakerCloseWakesWaiters(t *testing.T) {
+	breaker := newCircuitBreaker(BreakerConfig{FailureThreshold: 1, Cooldown: time.Hour})
+	breaker.record(errUnavailable)
+
+	done := make(chan error, 1)
+	go func() { done <- breaker.wait(context.Background()) }()
+
+	select {
+	case <-done:
+		t.Fatal("wait returned while the breaker was open")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	breaker.record(nil)
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("wait did not return after the breaker closed")
+	}
+	assert.False(t, breaker.isOpen())
+}
+
+func TestScanWorker_CacheStaleScanKeepsBreakerOpen(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	store := cache.NewLRU(10, 0)
+	cached := &domain.ServiceScan{IP: "1.1.1.1", Port: 80, Service: "HTTP", LastScanned: time.Unix(200, 0).UTC()}
+	require.NoError(t, store.Set(ctx, cached))
+
+	backend := mocks.NewMockBackend(ctrl)
+	worker, err := NewScanWorker(Config{
+		Repository: backend,
+		Cache:      store,
+		Breaker:    BreakerConfig{FailureThreshold: 1, Cooldown: time.Hour},
+	})
+	require.NoError(t, err)
+
+	backend.EXPECT().UpsertScans(gomock.Any(), gomock.Any()).Return(nil, errUnavailable)
+	err = worker.messageHandler.HandleMessage(ctx,
+		[]byte(`{"ip":"2.2.2.2","port":80,"service":"HTTP","timestamp":100,"data_version":2,"data":{"response_str":"ok"}}`))
+	require.Error(t, err)
+	require.True(t, worker.breaker.isOpen())
+
+	// The cache answers this probe without reaching the database, which
+	// says nothing about whether it is back
+	err = worker.messageHandler.HandleMessage(ctx,
+		[]byte(`{"ip":"1.1.1.1","port":80,"service":"HTTP","timestamp":100,"data_version":2,"data":{"response_str":"ok"}}`))
+	require.NoError(t, err)
+	assert.True(t, worker.breaker.isOpen())
+}
@@ -2,74 +2,409 @@ package workers
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"cloud.google.com/go/pubsub"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/censys/scan-takehome/internal/cache"
+	"github.com/censys/scan-takehome/internal/domain"
 	"github.com/censys/scan-takehome/internal/handlers"
+	"github.com/censys/scan-takehome/internal/logging"
+	"github.com/censys/scan-takehome/internal/metrics"
 	"github.com/censys/scan-takehome/internal/services"
+	"github.com/censys/scan-takehome/internal/sources"
+	"github.com/censys/scan-takehome/internal/tracing"
 )
 
+//go:generate mockgen -destination=../mocks/mock_message_handler.go -package=mocks github.com/censys/scan-takehome/internal/workers MessageHandler
+//go:generate mockgen -destination=../mocks/mock_message_source.go -package=mocks github.com/censys/scan-takehome/internal/workers MessageSource
+//go:generate mockgen -destination=../mocks/mock_dead_letter_sink.go -package=mocks github.com/censys/scan-takehome/internal/workers DeadLetterSink
+
 type MessageHandler interface {
 	HandleMessage(ctx context.Context, msgData []byte) error
 }
 
+// MessageSource abstracts the queue the worker pulls scans from so the same
+// pipeline can run on Pub/Sub, a local file or an in-process channel
+type MessageSource interface {
+	Receive(ctx context.Context, handler sources.HandlerFunc) error
+	Close() error
+}
+
+// SerialSource is a MessageSource that waits for each message to be handled
+// before delivering the next. A batch can never fill from such a source, so
+// every scan would wait out Batch.MaxWait on its own.
+type SerialSource interface {
+	DeliversSerially() bool
+}
+
+// DeadLetterSink stores messages that failed permanently so they can be
+// inspected instead of being redelivered forever
+type DeadLetterSink interface {
+	SendDeadLetter(ctx context.Context, deadLetter *domain.DeadLetter) error
+}
+
 type Config struct {
-	ProjectID      string
-	SubscriptionID string
-	Repository     services.ScanRepository
+	Source     MessageSource
+	Repository services.ScanRepository
+	// DeadLetters is optional; without it permanent failures are nacked
+	DeadLetters DeadLetterSink
+	// Batch enables batched writes when Batch.MaxSize is greater than 1
+	Batch services.BatchConfig
+	// Receive tunes flow control for sources that support it, such as Pub/Sub
+	Receive sources.ReceiveSettings
+	// Adaptive lowers Receive.MaxOutstandingMessages while database latency
+	// is high; it requires a FlowControlledSource
+	Adaptive AdaptiveConfig
+	// ShutdownGrace is how long in-flight messages may keep running after a
+	// shutdown starts before they are abandoned
+	ShutdownGrace time.Duration
+	// Breaker pauses message handling while the database is unavailable
+	Breaker BreakerConfig
+	// Cache is optional; it answers stale scans in front of the breaker and
+	// adaptive flow control, so those only see writes that reach Repository.
+	// Repository must then also be a cache.Backend.
+	Cache cache.Store
+}
+
+// DrainResult counts the messages that were in flight when a shutdown began
+type DrainResult struct {
+	// Completed messages finished and were acked
+	Completed int64
+	// Abandoned messages were nacked, either because they failed, ran past the
+	// grace period or arrived after the drain began
+	Abandoned int64
 }
 
 type ScanWorker struct {
-	config         Config
-	client         *pubsub.Client
-	subscription   *pubsub.Subscription
+	source         MessageSource
 	messageHandler MessageHandler
+	deadLetters    DeadLetterSink
+	batcher        *services.BatchProcessor
+	shutdownGrace  time.Duration
+	adaptive       *adaptiveFlowControl
+	breaker        *circuitBreaker
+
+	receiving atomic.Bool
+	exited    atomic.Bool
+	draining  atomic.Bool
+	completed atomic.Int64
+	abandoned atomic.Int64
 }
 
+var (
+	errNotReceiving = errors.New("receive loop is not running")
+	errDraining     = errors.New("worker is draining")
+	errExited       = errors.New("receive loop exited unexpectedly")
+	errBreakerOpen  = errors.New("database is unavailable, message handling is paused")
+)
+
 func NewScanWorker(config Config) (*ScanWorker, error) {
-	ctx := context.Background()
+	repository := config.Repository
+	if config.Adaptive.Enabled && config.Adaptive.TargetLatency <= 0 {
+		return nil, errors.New("adaptive flow control needs a positive target latency")
+	}
 
-	client, err := pubsub.NewClient(ctx, config.ProjectID)
-	if err != nil {
-		return nil, err
+	var adaptive *adaptiveFlowControl
+	if source, ok := config.Source.(FlowControlledSource); ok {
+		if config.Adaptive.Enabled {
+			adaptive = newAdaptiveFlowControl(config.Receive, config.Adaptive)
+			repository = &timedRepository{ScanRepository: repository, observe: adaptive.observe}
+			source.SetReceiveSettings(adaptive.settings)
+		} else {
+			source.SetReceiveSettings(config.Receive)
+		}
+	} else if config.Adaptive.Enabled {
+		return nil, fmt.Errorf("adaptive flow control is not supported by source %v", config.Source)
 	}
 
-	subscription := client.Subscription(config.SubscriptionID)
+	var breaker *circuitBreaker
+	if config.Breaker.FailureThreshold > 0 {
+		breaker = newCircuitBreaker(config.Breaker)
+		repository = &breakerRepository{ScanRepository: repository, record: breaker.record}
+	}
+
+	if config.Cache != nil {
+		backend, ok := config.Repository.(cache.Backend)
+		if !ok {
+			return nil, fmt.Errorf("caching needs a repository that reads scans, got %T", config.Repository)
+		}
+		repository = cache.NewRepository(&cacheBackend{Backend: backend, writes: repository}, config.Cache)
+	}
+
+	var processor handlers.ScanProcessor = services.NewScanProcessor(repository)
+
+	if source, ok := config.Source.(SerialSource); ok && source.DeliversSerially() && config.Batch.MaxSize > 1 {
+		slog.Info("Source delivers one message at a time, writing scans without batching", "source", fmt.Sprint(config.Source))
+		config.Batch.MaxSize = 1
+	}
+
+	var batcher *services.BatchProcessor
+	if config.Batch.MaxSize > 1 {
+		batcher = services.NewBatchProcessor(repository, config.Batch)
+		processor = batcher
+	}
 
-	processor := services.NewScanProcessor(config.Repository)
 	messageHandler := handlers.NewMessageHandler(processor)
 
 	return &ScanWorker{
-		config:         config,
-		client:         client,
-		subscription:   subscription,
+		source:         config.Source,
 		messageHandler: messageHandler,
+		deadLetters:    config.DeadLetters,
+		batcher:        batcher,
+		shutdownGrace:  config.ShutdownGrace,
+		adaptive:       adaptive,
+		breaker:        breaker,
 	}, nil
 }
 
+// cacheBackend reads from the store directly but writes through the breaker
+// and latency wrappers
+type cacheBackend struct {
+	cache.Backend
+	writes services.ScanRepository
+}
+
+func (b *cacheBackend) UpsertScan(ctx context.Context, scan *domain.ServiceScan) (domain.UpsertOutcome, error) {
+	return b.writes.UpsertScan(ctx, scan)
+}
+
+func (b *cacheBackend) UpsertScans(ctx context.Context, scans []*domain.ServiceScan) ([]domain.UpsertOutcome, error) {
+	return b.writes.UpsertScans(ctx, scans)
+}
+
+// NewPubSubScanWorker builds a worker that receives from subscriptionID
+// through client, which stays open when the worker stops. It lets tests and
+// embedders supply their own client, such as one connected to pstest;
+// config.Source is ignored.
+func NewPubSubScanWorker(client *pubsub.Client, subscriptionID string, config Config) (*ScanWorker, error) {
+	config.Source = sources.NewPubSubSourceFromClient(client, subscriptionID)
+	return NewScanWorker(config)
+}
+
+// Start receives until ctx is canceled and then drains: no new messages are
+// handled, and in-flight handlers get the shutdown grace period to finish
+// before their context is canceled and their messages are nacked
 func (sw *ScanWorker) Start(ctx context.Context) error {
-	log.Printf("Starting worker for subscription: %s", sw.config.SubscriptionID)
-	log.Println("Worker is running... (Press Ctrl+C to stop)")
+	slog.Info("Starting worker", "source", fmt.Sprint(sw.source))
+
+	// Handlers run on their own context so a shutdown does not cut them off
+	// mid-upsert; it is only canceled once the grace period runs out
+	workCtx, abandon := context.WithCancel(context.Background())
+	defer abandon()
+
+	received := make(chan struct{})
+	defer close(received)
+	go sw.watchShutdown(ctx, received, abandon)
 
-	return sw.subscription.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
-		log.Printf("Received message ID: %s", msg.ID)
+	if sw.adaptive != nil {
+		go sw.adaptive.run(ctx)
+	}
+
+	sw.receiving.Store(true)
+	defer func() {
+		sw.receiving.Store(false)
+		sw.exited.Store(true)
+	}()
 
-		if err := sw.messageHandler.HandleMessage(ctx, msg.Data); err != nil {
-			log.Printf("Failed to process message: %v", err)
-			msg.Nack()
+	err := sw.source.Receive(ctx, func(_ context.Context, msg sources.Message) {
+		// Counted before anything can nack it, so nacked never exceeds received
+		metrics.MessagesReceived.Inc()
+		if sw.breaker != nil && sw.breaker.wait(ctx) != nil {
+			// Shutdown began while waiting for the database to come back
+			nack(msg)
+			sw.abandoned.Add(1)
+			return
+		}
+		if sw.adaptive != nil {
+			if sw.adaptive.acquire(ctx) != nil {
+				// Shutdown began while waiting for the database to catch up
+				nack(msg)
+				sw.abandoned.Add(1)
+				return
+			}
+			defer sw.adaptive.release()
+		}
+		if sw.draining.Load() {
+			// Delivered after the drain began; hand it back untouched
+			nack(msg)
+			sw.abandoned.Add(1)
 			return
 		}
 
-		msg.Ack()
+		acked := sw.handle(workCtx, msg)
+		if sw.draining.Load() {
+			if acked {
+				sw.completed.Add(1)
+			} else {
+				sw.abandoned.Add(1)
+			}
+		}
 	})
+
+	if sw.draining.Load() {
+		result := sw.DrainResult()
+		slog.Info("Drain finished", "completed", result.Completed, "abandoned", result.Abandoned)
+	}
+	return err
+}
+
+// watchShutdown starts the drain when ctx is canceled and abandons in-flight
+// handlers if they are still running once the grace period has passed
+func (sw *ScanWorker) watchShutdown(ctx context.Context, received <-chan struct{}, abandon context.CancelFunc) {
+	select {
+	case <-ctx.Done():
+	case <-received:
+		return
+	}
+
+	sw.draining.Store(true)
+	slog.Info("Draining in-flight messages", "grace_period", sw.shutdownGrace.String())
+
+	timer := time.NewTimer(sw.shutdownGrace)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		slog.Warn("Shutdown grace period expired, abandoning in-flight messages", "grace_period", sw.shutdownGrace.String())
+		abandon()
+	case <-received:
+	}
+}
+
+// DrainResult reports how the messages in flight during shutdown ended
+func (sw *ScanWorker) DrainResult() DrainResult {
+	return DrainResult{
+		Completed: sw.completed.Load(),
+		Abandoned: sw.abandoned.Load(),
+	}
+}
+
+// handle processes one message and reports whether it was acked. The context
+// handed down carries the message's trace and a logger tagged with its
+// delivery details.
+func (sw *ScanWorker) handle(ctx context.Context, msg sources.Message) (acked bool) {
+	ctx, span := tracing.Tracer().Start(tracing.Extract(ctx, msg.Attributes()), "ScanWorker.receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingOperationReceive,
+			semconv.MessagingMessageID(msg.ID()),
+			attribute.Int("messaging.delivery_attempt", msg.DeliveryAttempt()),
+		))
+	defer func() {
+		span.SetAttributes(attribute.Bool("messaging.acked", acked))
+		span.End()
+	}()
+
+	attrs := []any{"message_id", msg.ID(), "delivery_attempt", msg.DeliveryAttempt()}
+	if published := msg.PublishTime(); !published.IsZero() {
+		attrs = append(attrs, "publish_time", published)
+	}
+	if spanContext := span.SpanContext(); spanContext.IsValid() {
+		attrs = append(attrs, "trace_id", spanContext.TraceID().String())
+	}
+	ctx = logging.With(ctx, attrs...)
+	logger := logging.FromContext(ctx)
+	logger.Debug("Received message")
+
+	start := time.Now()
+	metrics.MessagesInFlight.Inc()
+	defer func() {
+		metrics.MessagesInFlight.Dec()
+		metrics.HandlerDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	if err := sw.messageHandler.HandleMessage(ctx, msg.Data()); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		if handlers.IsPermanent(err) && sw.deadLetters != nil {
+			return sw.deadLetter(ctx, msg, err)
+		}
+
+		logger.Warn("Failed to process message", "error", err)
+		nack(msg)
+		return false
+	}
+
+	ack(msg)
+	return true
+}
+
+func (sw *ScanWorker) deadLetter(ctx context.Context, msg sources.Message, cause error) bool {
+	deadLetter := &domain.DeadLetter{
+		MessageID:       msg.ID(),
+		Reason:          handlers.PermanentReason(cause),
+		Error:           cause.Error(),
+		DeliveryAttempt: msg.DeliveryAttempt(),
+		Payload:         msg.Data(),
+		FailedAt:        time.Now(),
+	}
+
+	if err := sw.deadLetters.SendDeadLetter(ctx, deadLetter); err != nil {
+		logging.FromContext(ctx).Error("Failed to dead-letter message, will retry", "error", err)
+		nack(msg)
+		return false
+	}
+
+	logging.FromContext(ctx).Warn("Dead-lettered message", "reason", deadLetter.Reason, "error", cause)
+	metrics.MessagesDeadLettered.WithLabelValues(deadLetter.Reason).Inc()
+	ack(msg)
+	return true
+}
+
+func ack(msg sources.Message) {
+	metrics.MessagesAcked.Inc()
+	msg.Ack()
+}
+
+func nack(msg sources.Message) {
+	metrics.MessagesNacked.Inc()
+	msg.Nack()
+}
+
+// CheckReady fails unless the receive loop is running and the worker is not
+// draining, so an orchestrator only routes work to a worker that can take it
+func (sw *ScanWorker) CheckReady(ctx context.Context) error {
+	if sw.draining.Load() {
+		return errDraining
+	}
+	if !sw.receiving.Load() {
+		return errNotReceiving
+	}
+	if sw.breaker != nil && sw.breaker.isOpen() {
+		return errBreakerOpen
+	}
+	return nil
+}
+
+// CheckLive fails once the receive loop has exited without a shutdown being
+// requested, which only a restart can recover from
+func (sw *ScanWorker) CheckLive(ctx context.Context) error {
+	if sw.exited.Load() && !sw.draining.Load() {
+		return errExited
+	}
+	return nil
 }
 
 func (sw *ScanWorker) Stop() error {
-	return sw.client.Close()
+	if sw.batcher != nil {
+		if err := sw.batcher.Close(); err != nil {
+			slog.Error("Failed to flush scan batches", "error", err)
+		}
+	}
+	return sw.source.Close()
 }
 
 func (sw *ScanWorker) Run() error {
@@ -80,7 +415,7 @@ func (sw *ScanWorker) Run() error {
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		<-sigChan
-		log.Println("Received shutdown signal, stopping worker...")
+		slog.Info("Received shutdown signal, stopping worker")
 		cancel()
 	}()
 
@@ -89,6 +424,6 @@ func (sw *ScanWorker) Run() error {
 		return err
 	}
 
-	log.Println("Worker stopped")
+	slog.Info("Worker stopped")
 	return nil
 }
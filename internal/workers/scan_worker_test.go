@@ -0,0 +1,428 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/censys/scan-takehome/internal/domain"
+	"github.com/censys/scan-takehome/internal/handlers"
+	"github.com/censys/scan-takehome/internal/metrics"
+	"github.com/censys/scan-takehome/internal/mocks"
+	"github.com/censys/scan-takehome/internal/repositories"
+	"github.com/censys/scan-takehome/internal/services"
+	"github.com/censys/scan-takehome/internal/sources"
+)
+
+type recordingMessage struct {
+	data       []byte
+	attributes map[string]string
+	acked      bool
+	nacked     bool
+}
+
+func (m *recordingMessage) ID() string                    { return "test-message" }
+func (m *recordingMessage) Data() []byte                  { return m.data }
+func (m *recordingMessage) DeliveryAttempt() int          { return 3 }
+func (m *recordingMessage) PublishTime() time.Time        { return time.Time{} }
+func (m *recordingMessage) Attributes() map[string]string { return m.attributes }
+func (m *recordingMessage) Ack()                          { m.acked = true }
+func (m *recordingMessage) Nack()                         { m.nacked = true }
+
+func receiveOnce(msg sources.Message) func(ctx context.Context, handler sources.HandlerFunc) error {
+	return func(ctx context.Context, handler sources.HandlerFunc) error {
+		handler(ctx, msg)
+		return nil
+	}
+}
+
+func TestScanWorker_Start_AcksHandledMessage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSource := mocks.NewMockMessageSource(ctrl)
+	mockHandler := mocks.NewMockMessageHandler(ctrl)
+	worker := &ScanWorker{source: mockSource, messageHandler: mockHandler}
+
+	msg := &recordingMessage{data: []byte(`{"ip":"1.1.1.1"}`)}
+
+	mockSource.EXPECT().Receive(gomock.Any(), gomock.Any()).DoAndReturn(receiveOnce(msg))
+	mockHandler.EXPECT().
+		HandleMessage(gomock.Any(), msg.data).
+		Return(nil)
+
+	err := worker.Start(context.Background())
+
+	assert.NoError(t, err)
+	assert.True(t, msg.acked)
+	assert.False(t, msg.nacked)
+}
+
+func TestScanWorker_Start_NacksFailedMessage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSource := mocks.NewMockMessageSource(ctrl)
+	mockHandler := mocks.NewMockMessageHandler(ctrl)
+	worker := &ScanWorker{source: mockSource, messageHandler: mockHandler}
+
+	msg := &recordingMessage{data: []byte(`{"ip":"1.1.1.1"}`)}
+
+	mockSource.EXPECT().Receive(gomock.Any(), gomock.Any()).DoAndReturn(receiveOnce(msg))
+	mockHandler.EXPECT().
+		HandleMessage(gomock.Any(), msg.data).
+		Return(assert.AnError)
+
+	err := worker.Start(context.Background())
+
+	assert.NoError(t, err)
+	assert.False(t, msg.acked)
+	assert.True(t, msg.nacked)
+}
+
+func TestScanWorker_Start_RecordsMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSource := mocks.NewMockMessageSource(ctrl)
+	mockHandler := mocks.NewMockMessageHandler(ctrl)
+	worker := &ScanWorker{source: mockSource, messageHandler: mockHandler}
+
+	msg := &recordingMessage{data: []byte(`{"ip":"1.1.1.1"}`)}
+	received := testutil.ToFloat64(metrics.MessagesReceived)
+	nacked := testutil.ToFloat64(metrics.MessagesNacked)
+
+	mockSource.EXPECT().Receive(gomock.Any(), gomock.Any()).DoAndReturn(receiveOnce(msg))
+	mockHandler.EXPECT().
+		HandleMessage(gomock.Any(), msg.data).
+		Return(assert.AnError)
+
+	err := worker.Start(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, received+1, testutil.ToFloat64(metrics.MessagesReceived))
+	assert.Equal(t, nacked+1, testutil.ToFloat64(metrics.MessagesNacked))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.MessagesInFlight))
+}
+
+func TestScanWorker_Start_WithChannelSource(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	source := sources.NewChannelSource(10)
+	mockHandler := mocks.NewMockMessageHandler(ctrl)
+	worker := &ScanWorker{source: source, messageHandler: mockHandler}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	source.Publish([]byte("scan"))
+
+	mockHandler.EXPECT().
+		HandleMessage(gomock.Any(), []byte("scan")).
+		DoAndReturn(func(ctx context.Context, msgData []byte) error {
+			cancel()
+			return nil
+		})
+
+	err := worker.Start(ctx)
+
+	assert.NoError(t, err)
+	assert.NoError(t, worker.Stop())
+}
+
+func TestScanWorker_Start_FileSourceIsNotHeldByBatching(t *testing.T) {
+	const messages = 200
+	var lines []byte
+	for i := 0; i < messages; i++ {
+		lines = append(lines, fmt.Sprintf(`{"ip":"10.0.0.%d","port":80,"service":"HTTP","timestamp":100,"data_version":2,"data":{"response_str":"ok"}}`+"\n", i)...)
+	}
+	path := filepath.Join(t.TempDir(), "scans.jsonl")
+	require.NoError(t, os.WriteFile(path, lines, 0o600))
+
+	source, err := sources.NewFileSource(path)
+	require.NoError(t, err)
+	repo := repositories.NewMemoryRepository()
+	// The consumer's default batch settings
+	worker, err := NewScanWorker(Config{
+		Source:     source,
+		Repository: repo,
+		Batch:      services.BatchConfig{MaxSize: 100, MaxWait: 50 * time.Millisecond, Concurrency: 4},
+	})
+	require.NoError(t, err)
+
+	start := time.Now()
+	require.NoError(t, worker.Start(context.Background()))
+	elapsed := time.Since(start)
+	require.NoError(t, worker.Stop())
+
+	// Waiting out MaxWait for every message would take 10s
+	assert.Less(t, elapsed, 2*time.Second)
+	assert.Zero(t, source.Nacked())
+	scans, err := repo.ListScans(context.Background(), domain.ScanFilter{})
+	require.NoError(t, err)
+	assert.Len(t, scans, messages)
+}
+
+func TestScanWorker_Start_DeadLettersPermanentFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSource := mocks.NewMockMessageSource(ctrl)
+	mockHandler := mocks.NewMockMessageHandler(ctrl)
+	mockSink := mocks.NewMockDeadLetterSink(ctrl)
+	worker := &ScanWorker{source: mockSource, messageHandler: mockHandler, deadLetters: mockSink}
+
+	msg := &recordingMessage{data: []byte(`{"invalid": json}`)}
+	handlerErr := &handlers.PermanentError{Reason: handlers.ReasonMalformedJSON, Err: assert.AnError}
+
+	mockSource.EXPECT().Receive(gomock.Any(), gomock.Any()).DoAndReturn(receiveOnce(msg))
+	mockHandler.EXPECT().HandleMessage(gomock.Any(), msg.data).Return(handlerErr)
+	mockSink.EXPECT().
+		SendDeadLetter(gomock.Any(), gomock.Any()).
+		Do(func(ctx context.Context, deadLetter *domain.DeadLetter) {
+			assert.Equal(t, "test-message", deadLetter.MessageID)
+			assert.Equal(t, handlers.ReasonMalformedJSON, deadLetter.Reason)
+			assert.Equal(t, handlerErr.Error(), deadLetter.Error)
+			assert.Equal(t, 3, deadLetter.DeliveryAttempt)
+			assert.Equal(t, msg.data, deadLetter.Payload)
+		}).
+		Return(nil)
+
+	err := worker.Start(context.Background())
+
+	assert.NoError(t, err)
+	assert.True(t, msg.acked)
+	assert.False(t, msg.nacked)
+}
+
+func TestScanWorker_Start_NacksWhenDeadLetterFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSource := mocks.NewMockMessageSource(ctrl)
+	mockHandler := mocks.NewMockMessageHandler(ctrl)
+	mockSink := mocks.NewMockDeadLetterSink(ctrl)
+	worker := &ScanWorker{source: mockSource, messageHandler: mockHandler, deadLetters: mockSink}
+
+	msg := &recordingMessage{data: []byte(`{"invalid": json}`)}
+
+	mockSource.EXPECT().Receive(gomock.Any(), gomock.Any()).DoAndReturn(receiveOnce(msg))
+	mockHandler.EXPECT().
+		HandleMessage(gomock.Any(), msg.data).
+		Return(&handlers.PermanentError{Reason: handlers.ReasonMalformedJSON, Err: assert.AnError})
+	mockSink.EXPECT().SendDeadLetter(gomock.Any(), gomock.Any()).Return(assert.AnError)
+
+	err := worker.Start(context.Background())
+
+	assert.NoError(t, err)
+	assert.False(t, msg.acked)
+	assert.True(t, msg.nacked)
+}
+
+func TestScanWorker_Start_NacksTransientFailureWithDeadLetterSink(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSource := mocks.NewMockMessageSource(ctrl)
+	mockHandler := mocks.NewMockMessageHandler(ctrl)
+	mockSink := mocks.NewMockDeadLetterSink(ctrl)
+	worker := &ScanWorker{source: mockSource, messageHandler: mockHandler, deadLetters: mockSink}
+
+	msg := &recordingMessage{data: []byte(`{"ip":"1.1.1.1"}`)}
+
+	mockSource.EXPECT().Receive(gomock.Any(), gomock.Any()).DoAndReturn(receiveOnce(msg))
+	mockHandler.EXPECT().HandleMessage(gomock.Any(), msg.data).Return(assert.AnError)
+
+	err := worker.Start(context.Background())
+
+	assert.NoError(t, err)
+	assert.False(t, msg.acked)
+	assert.True(t, msg.nacked)
+}
+
+func TestScanWorker_Probes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSource := mocks.NewMockMessageSource(ctrl)
+	worker := &ScanWorker{source: mockSource}
+	ctx := context.Background()
+
+	assert.Error(t, worker.CheckReady(ctx), "not ready before the receive loop starts")
+	assert.NoError(t, worker.CheckLive(ctx))
+
+	mockSource.EXPECT().Receive(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, handler sources.HandlerFunc) error {
+			assert.NoError(t, worker.CheckReady(ctx))
+			assert.NoError(t, worker.CheckLive(ctx))
+			return nil
+		})
+
+	assert.NoError(t, worker.Start(ctx))
+
+	assert.Error(t, worker.CheckReady(ctx))
+	assert.Error(t, worker.CheckLive(ctx), "receive loop exited without a shutdown")
+
+	worker.draining.Store(true)
+	assert.Error(t, worker.CheckReady(ctx))
+	assert.NoError(t, worker.CheckLive(ctx))
+}
+
+func TestScanWorker_Start_DrainCompletesInFlightMessage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSource := mocks.NewMockMessageSource(ctrl)
+	mockHandler := mocks.NewMockMessageHandler(ctrl)
+	worker := &ScanWorker{source: mockSource, messageHandler: mockHandler, shutdownGrace: time.Minute}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msg := &recordingMessage{data: []byte("scan")}
+
+	mockSource.EXPECT().Receive(gomock.Any(), gomock.Any()).DoAndReturn(receiveOnce(msg))
+	mockHandler.EXPECT().
+		HandleMessage(gomock.Any(), msg.data).
+		DoAndReturn(func(handlerCtx context.Context, msgData []byte) error {
+			cancel()
+			assert.Eventually(t, worker.draining.Load, time.Second, time.Millisecond)
+			assert.NoError(t, handlerCtx.Err(), "shutdown must not cancel in-flight handlers")
+			return nil
+		})
+
+	err := worker.Start(ctx)
+
+	assert.NoError(t, err)
+	assert.True(t, msg.acked)
+	assert.Equal(t, DrainResult{Completed: 1}, worker.DrainResult())
+}
+
+func TestScanWorker_Start_DrainAbandonsMessageAfterGracePeriod(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSource := mocks.NewMockMessageSource(ctrl)
+	mockHandler := mocks.NewMockMessageHandler(ctrl)
+	worker := &ScanWorker{source: mockSource, messageHandler: mockHandler, shutdownGrace: 10 * time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msg := &recordingMessage{data: []byte("scan")}
+
+	mockSource.EXPECT().Receive(gomock.Any(), gomock.Any()).DoAndReturn(receiveOnce(msg))
+	mockHandler.EXPECT().
+		HandleMessage(gomock.Any(), msg.data).
+		DoAndReturn(func(handlerCtx context.Context, msgData []byte) error {
+			cancel()
+			<-handlerCtx.Done()
+			return handlerCtx.Err()
+		})
+
+	err := worker.Start(ctx)
+
+	assert.NoError(t, err)
+	assert.True(t, msg.nacked)
+	assert.Equal(t, DrainResult{Abandoned: 1}, worker.DrainResult())
+}
+
+func TestScanWorker_Start_DrainNacksMessagesDeliveredAfterShutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSource := mocks.NewMockMessageSource(ctrl)
+	mockHandler := mocks.NewMockMessageHandler(ctrl)
+	worker := &ScanWorker{source: mockSource, messageHandler: mockHandler, shutdownGrace: time.Minute}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	msg := &recordingMessage{data: []byte("scan")}
+	received := testutil.ToFloat64(metrics.MessagesReceived)
+	nacked := testutil.ToFloat64(metrics.MessagesNacked)
+
+	mockSource.EXPECT().Receive(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, handler sources.HandlerFunc) error {
+			cancel()
+			assert.Eventually(t, worker.draining.Load, time.Second, time.Millisecond)
+			handler(ctx, msg)
+			return nil
+		})
+
+	err := worker.Start(ctx)
+
+	assert.NoError(t, err)
+	assert.True(t, msg.nacked)
+	assert.Equal(t, DrainResult{Abandoned: 1}, worker.DrainResult())
+	assert.Equal(t, received+1, testutil.ToFloat64(metrics.MessagesReceived))
+	assert.Equal(t, nacked+1, testutil.ToFloat64(metrics.MessagesNacked))
+}
+
+func TestScanWorker_Start_OpenBreakerHoldsMessagesUntilShutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSource := mocks.NewMockMessageSource(ctrl)
+	mockHandler := mocks.NewMockMessageHandler(ctrl)
+	breaker := newCircuitBreaker(BreakerConfig{FailureThreshold: 1, Cooldown: time.Hour})
+	worker := &ScanWorker{source: mockSource, messageHandler: mockHandler, breaker: breaker, shutdownGrace: time.Minute}
+	breaker.record(errUnavailable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	msg := &recordingMessage{data: []byte("scan")}
+
+	mockSource.EXPECT().Receive(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, handler sources.HandlerFunc) error {
+			assert.ErrorIs(t, worker.CheckReady(ctx), errBreakerOpen)
+			time.AfterFunc(20*time.Millisecond, cancel)
+			handler(ctx, msg)
+			return nil
+		})
+
+	err := worker.Start(ctx)
+
+	assert.NoError(t, err)
+	assert.True(t, msg.nacked, "a message held by the breaker is handed back on shutdown")
+	assert.Equal(t, DrainResult{Abandoned: 1}, worker.DrainResult())
+}
+
+func TestScanWorker_Start_ContinuesTraceFromMessageAttributes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	mockSource := mocks.NewMockMessageSource(ctrl)
+	mockHandler := mocks.NewMockMessageHandler(ctrl)
+	worker := &ScanWorker{source: mockSource, messageHandler: mockHandler}
+
+	msg := &recordingMessage{
+		data:       []byte("scan"),
+		attributes: map[string]string{"traceparent": "00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01"},
+	}
+
+	mockSource.EXPECT().Receive(gomock.Any(), gomock.Any()).DoAndReturn(receiveOnce(msg))
+	mockHandler.EXPECT().HandleMessage(gomock.Any(), msg.data).Return(nil)
+
+	require.NoError(t, worker.Start(context.Background()))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "ScanWorker.receive", spans[0].Name())
+	assert.Equal(t, "0102030405060708090a0b0c0d0e0f10", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "0102030405060708", spans[0].Parent().SpanID().String())
+}